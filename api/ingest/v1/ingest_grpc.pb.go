@@ -0,0 +1,249 @@
+// gRPC API приема сообщений. Токен пользователя передается в метаданных:
+// authorization: Bearer <token>.
+//
+// Код Go в этом каталоге сгенерирован из этого файла (см. go:generate в internal/rpc).
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ingest/v1/ingest.proto
+
+package ingestv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Ingest_AddUser_FullMethodName      = "/ingest.v1.Ingest/AddUser"
+	Ingest_SendMessage_FullMethodName  = "/ingest.v1.Ingest/SendMessage"
+	Ingest_SendMessages_FullMethodName = "/ingest.v1.Ingest/SendMessages"
+	Ingest_TailFile_FullMethodName     = "/ingest.v1.Ingest/TailFile"
+)
+
+// IngestClient is the client API for Ingest service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type IngestClient interface {
+	// AddUser закрепляет файл за токеном вызова. Тенант файла определяется по
+	// токену в настройках сервера.
+	AddUser(ctx context.Context, in *AddUserRequest, opts ...grpc.CallOption) (*AddUserResponse, error)
+	// SendMessage принимает одно сообщение.
+	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error)
+	// SendMessages принимает поток сообщений. Ошибка отдельного сообщения не
+	// прерывает поток и возвращается в списке отклоненных, кроме ошибки токена.
+	SendMessages(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SendMessageRequest, SendMessagesResponse], error)
+	// TailFile передает строки, дописываемые в файл пользователя.
+	TailFile(ctx context.Context, in *TailFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TailFileResponse], error)
+}
+
+type ingestClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIngestClient(cc grpc.ClientConnInterface) IngestClient {
+	return &ingestClient{cc}
+}
+
+func (c *ingestClient) AddUser(ctx context.Context, in *AddUserRequest, opts ...grpc.CallOption) (*AddUserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AddUserResponse)
+	err := c.cc.Invoke(ctx, Ingest_AddUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestClient) SendMessage(ctx context.Context, in *SendMessageRequest, opts ...grpc.CallOption) (*SendMessageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendMessageResponse)
+	err := c.cc.Invoke(ctx, Ingest_SendMessage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *ingestClient) SendMessages(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[SendMessageRequest, SendMessagesResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ingest_ServiceDesc.Streams[0], Ingest_SendMessages_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SendMessageRequest, SendMessagesResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_SendMessagesClient = grpc.ClientStreamingClient[SendMessageRequest, SendMessagesResponse]
+
+func (c *ingestClient) TailFile(ctx context.Context, in *TailFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TailFileResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Ingest_ServiceDesc.Streams[1], Ingest_TailFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TailFileRequest, TailFileResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_TailFileClient = grpc.ServerStreamingClient[TailFileResponse]
+
+// IngestServer is the server API for Ingest service.
+// All implementations must embed UnimplementedIngestServer
+// for forward compatibility.
+type IngestServer interface {
+	// AddUser закрепляет файл за токеном вызова. Тенант файла определяется по
+	// токену в настройках сервера.
+	AddUser(context.Context, *AddUserRequest) (*AddUserResponse, error)
+	// SendMessage принимает одно сообщение.
+	SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error)
+	// SendMessages принимает поток сообщений. Ошибка отдельного сообщения не
+	// прерывает поток и возвращается в списке отклоненных, кроме ошибки токена.
+	SendMessages(grpc.ClientStreamingServer[SendMessageRequest, SendMessagesResponse]) error
+	// TailFile передает строки, дописываемые в файл пользователя.
+	TailFile(*TailFileRequest, grpc.ServerStreamingServer[TailFileResponse]) error
+	mustEmbedUnimplementedIngestServer()
+}
+
+// UnimplementedIngestServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedIngestServer struct{}
+
+func (UnimplementedIngestServer) AddUser(context.Context, *AddUserRequest) (*AddUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddUser not implemented")
+}
+func (UnimplementedIngestServer) SendMessage(context.Context, *SendMessageRequest) (*SendMessageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
+}
+func (UnimplementedIngestServer) SendMessages(grpc.ClientStreamingServer[SendMessageRequest, SendMessagesResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method SendMessages not implemented")
+}
+func (UnimplementedIngestServer) TailFile(*TailFileRequest, grpc.ServerStreamingServer[TailFileResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method TailFile not implemented")
+}
+func (UnimplementedIngestServer) mustEmbedUnimplementedIngestServer() {}
+func (UnimplementedIngestServer) testEmbeddedByValue()                {}
+
+// UnsafeIngestServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IngestServer will
+// result in compilation errors.
+type UnsafeIngestServer interface {
+	mustEmbedUnimplementedIngestServer()
+}
+
+func RegisterIngestServer(s grpc.ServiceRegistrar, srv IngestServer) {
+	// If the following call pancis, it indicates UnimplementedIngestServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Ingest_ServiceDesc, srv)
+}
+
+func _Ingest_AddUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServer).AddUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ingest_AddUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServer).AddUser(ctx, req.(*AddUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ingest_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendMessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IngestServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Ingest_SendMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IngestServer).SendMessage(ctx, req.(*SendMessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Ingest_SendMessages_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).SendMessages(&grpc.GenericServerStream[SendMessageRequest, SendMessagesResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_SendMessagesServer = grpc.ClientStreamingServer[SendMessageRequest, SendMessagesResponse]
+
+func _Ingest_TailFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TailFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IngestServer).TailFile(m, &grpc.GenericServerStream[TailFileRequest, TailFileResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Ingest_TailFileServer = grpc.ServerStreamingServer[TailFileResponse]
+
+// Ingest_ServiceDesc is the grpc.ServiceDesc for Ingest service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Ingest_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ingest.v1.Ingest",
+	HandlerType: (*IngestServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AddUser",
+			Handler:    _Ingest_AddUser_Handler,
+		},
+		{
+			MethodName: "SendMessage",
+			Handler:    _Ingest_SendMessage_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SendMessages",
+			Handler:       _Ingest_SendMessages_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "TailFile",
+			Handler:       _Ingest_TailFile_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ingest/v1/ingest.proto",
+}
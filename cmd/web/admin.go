@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/quota"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/webhook"
+)
+
+type pendingMessage struct {
+	ID   string `json:"id"`
+	Data string `json:"data"`
+}
+
+func registerAdminHandlers(application *app.App, adminToken string) {
+	http.HandleFunc("/admin/flush", adminOnly(adminToken, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		n, err := application.Flush(r.URL.Query().Get("fileID"))
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"flushed": n})
+	}))
+
+	http.HandleFunc("/admin/pending", adminOnly(adminToken, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		pending, err := application.Pending(r.URL.Query().Get("fileID"))
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+
+		// токены пользователей наружу не отдаются
+		result := make(map[string][]pendingMessage, len(pending))
+		for fileID, messages := range pending {
+			for _, msg := range messages {
+				result[fileID] = append(result[fileID], pendingMessage{ID: msg.ID, Data: msg.Data})
+			}
+		}
+		writeJSON(w, http.StatusOK, result)
+	}))
+
+	http.HandleFunc("/admin/tenants", adminOnly(adminToken, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, application.Tenants())
+	}))
+
+	http.HandleFunc("/admin/files", adminOnly(adminToken, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		files, err := application.TenantFiles(r.URL.Query().Get("tenant"))
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, files)
+	}))
+
+	http.HandleFunc("/admin/usage", adminOnly(adminToken, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, application.FileUsage())
+	}))
+	http.HandleFunc("/admin/usage/reset", adminOnly(adminToken, http.MethodPost, fileAction(application.ResetUsage)))
+
+	http.HandleFunc("/admin/pause", adminOnly(adminToken, http.MethodPost, fileAction(application.PauseFile)))
+	http.HandleFunc("/admin/resume", adminOnly(adminToken, http.MethodPost, fileAction(application.ResumeFile)))
+
+	http.HandleFunc("/admin/drop", adminOnly(adminToken, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		n, err := application.DropFile(r.URL.Query().Get("fileID"))
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"dropped": n})
+	}))
+
+	http.HandleFunc("/admin/deadletter", adminOnly(adminToken, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		files, err := application.DeadLetters()
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, files)
+	}))
+	http.HandleFunc("/admin/deadletter/replay", adminOnly(adminToken, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+		n, err := application.ReplayDeadLetters(r.URL.Query().Get("fileID"))
+		if err != nil {
+			adminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"replayed": n})
+	}))
+}
+
+// registerWebhookHandlers отдает журнал доставки webhook.
+func registerWebhookHandlers(webhooks *webhook.Dispatcher, adminToken string) {
+	http.HandleFunc("/admin/webhooks", adminOnly(adminToken, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, webhooks.Deliveries())
+	}))
+}
+
+func fileAction(action func(fileID string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := action(r.URL.Query().Get("fileID")); err != nil {
+			adminError(w, err)
+			return
+		}
+		w.Write([]byte("ok"))
+	}
+}
+
+// adminOnly пропускает запросы с заданным методом и токеном администратора
+// в заголовке Authorization: Bearer <token>.
+func adminOnly(adminToken, method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			http.Error(w, "недействительный токен администратора", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "метод не поддерживается", http.StatusMethodNotAllowed)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func adminError(w http.ResponseWriter, err error) {
+	if errors.Is(err, app.ErrUnknownFile) || errors.Is(err, app.ErrUnknownTenant) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, quota.ErrExceeded) {
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	}
+	if errors.Is(err, app.ErrShuttingDown) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
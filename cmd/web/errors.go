@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+)
+
+var ingestStatus = map[ingest.Code]int{
+	ingest.CodeInvalidArgument: http.StatusBadRequest,
+	ingest.CodeUnauthenticated: http.StatusUnauthorized,
+	ingest.CodeForbidden:       http.StatusForbidden,
+	ingest.CodeNotFound:        http.StatusNotFound,
+	ingest.CodeRateLimited:     http.StatusTooManyRequests,
+	ingest.CodeQuotaExceeded:   http.StatusInsufficientStorage,
+	ingest.CodeUnavailable:     http.StatusServiceUnavailable,
+}
+
+// writeIngestError отвечает HTTP-статусом, соответствующим коду ошибки приема.
+func writeIngestError(w http.ResponseWriter, err error) {
+	var rateErr *handler.RateLimitError
+	if errors.As(err, &rateErr) {
+		writeRateLimited(w, rateErr)
+		return
+	}
+
+	status, exists := ingestStatus[ingest.CodeOf(err)]
+	if !exists {
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, err.Error(), status)
+}
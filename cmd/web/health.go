@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+)
+
+func registerHealthHandlers(application *app.App) {
+	// процесс жив и обслуживает HTTP
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		checks, ready := application.Readiness()
+
+		status := http.StatusOK
+		if !ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, map[string]any{
+			"ready":  ready,
+			"checks": checks,
+		})
+	})
+
+	http.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, application.Status())
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("не удалось отправить ответ", logger.KeyError, err)
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -11,38 +11,126 @@ import (
 
 	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/events"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/lifecycle"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/lineproto"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/metrics"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/process"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/route"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/rpc"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/schema"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/source"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/storage"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/syslog"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/tracing"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/webhook"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ws"
 )
 
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	cfg := config.LoadConfig()
 
+	l, err := logger.New(cfg, os.Stderr)
+	if err != nil {
+		slog.Error("не удалось настроить логирование", logger.KeyError, err)
+		return lifecycle.ExitFailure
+	}
+	slog.SetDefault(l)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg)
+	if err != nil {
+		slog.Error("не удалось настроить трассировку", logger.KeyError, err)
+		return lifecycle.ExitFailure
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Error("не удалось выгрузить трассировку", logger.KeyError, err)
+		}
+	}()
+
+	// служебные файлы в каталоге файлов попадали бы под ротацию, хранение и квоты
+	if insideDir(cfg.StateDir, cfg.FilesDir) {
+		slog.Error("каталог служебных файлов не должен находиться в каталоге файлов", "state_dir", cfg.StateDir, "files_dir", cfg.FilesDir)
+		return lifecycle.ExitFailure
+	}
+
 	userRepo := repository.NewUserRepository(cfg.ValidTokens)
-	writer := &types.DefaultFileWriter{}
+	writer := storage.NewRotatingFileWriter(cfg.FilesDir, storage.Rotation{
+		MaxBytes: cfg.RotationMaxBytes,
+		Interval: cfg.RotationInterval,
+		Compress: cfg.RotationCompress,
+	})
 	application := app.NewApp(cfg, writer, userRepo)
 	msgHandler := handler.NewMessageHandler(userRepo, application, cfg)
+	processors, err := process.NewPipeline(cfg.Processors)
+	if err != nil {
+		slog.Error("не удалось настроить обработку сообщений", logger.KeyError, err)
+		return lifecycle.ExitFailure
+	}
+	msgHandler.SetProcessors(processors)
+	schemas, err := schema.NewRegistry(cfg.Schemas)
+	if err != nil {
+		slog.Error("не удалось настроить схемы данных", logger.KeyError, err)
+		return lifecycle.ExitFailure
+	}
+	msgHandler.SetSchemas(schemas)
+	router, err := route.NewRouter(cfg.Routes)
+	if err != nil {
+		slog.Error("не удалось настроить маршрутизацию сообщений", logger.KeyError, err)
+		return lifecycle.ExitFailure
+	}
+	application.SetRouter(router)
+	webhooks, err := webhook.NewDispatcher(cfg)
+	if err != nil {
+		slog.Error("не удалось настроить webhook", logger.KeyError, err)
+		return lifecycle.ExitFailure
+	}
+	webhooks.Subscribe(events.Default)
+	if webhooks != nil {
+		// номера и смещения записанных батчей нужны только получателям webhook
+		application.TrackSequences()
+	}
+	ingestSvc := ingest.NewService(application, msgHandler, userRepo)
+
+	metrics.Default.SetLabelLimit(cfg.MetricsMaxFileLabels)
+	application.RegisterMetrics(metrics.Default)
+	http.Handle("/metrics", metrics.Default)
+	registerHealthHandlers(application)
+	if cfg.AdminToken == "" {
+		slog.Info("административные эндпоинты отключены, токен задается в ADMIN_TOKEN")
+	}
+	registerAdminHandlers(application, cfg.AdminToken)
+	registerWebhookHandlers(webhooks, cfg.AdminToken)
 
-	http.HandleFunc("/add-user", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("/usage", func(w http.ResponseWriter, r *http.Request) {
 		token := r.URL.Query().Get("token")
-		fileID := r.URL.Query().Get("fileID")
-
-		if token == "" || fileID == "" {
-			http.Error(w, "отсутствуют параметры", http.StatusBadRequest)
+		user, exists := userRepo.GetUserByToken(token)
+		if token == "" || !exists {
+			http.Error(w, "пользователь не найден", http.StatusUnauthorized)
 			return
 		}
+		writeJSON(w, http.StatusOK, application.Usage(token, types.FileKey(user.Tenant, user.FileID)))
+	})
 
-		log.Printf("Добавление пользователя: token=%s, fileID=%s", token, fileID)
-		err := application.AddUser(types.User{
-			Token:  token,
-			FileID: fileID,
+	http.HandleFunc("/add-user", func(w http.ResponseWriter, r *http.Request) {
+		_, err := ingestSvc.AddUser(r.Context(), ingest.NewUser{
+			Token:  r.URL.Query().Get("token"),
+			FileID: r.URL.Query().Get("fileID"),
 		})
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			writeIngestError(w, err)
 			return
 		}
 
@@ -50,69 +138,73 @@ func main() {
 	})
 
 	http.HandleFunc("/add-message", func(w http.ResponseWriter, r *http.Request) {
-		token := r.URL.Query().Get("token")
-		fileID := r.URL.Query().Get("fileID")
-		data := r.URL.Query().Get("data")
-
-		if token == "" || fileID == "" || data == "" {
-			http.Error(w, "отсутствуют параметры", http.StatusBadRequest)
-			return
-		}
-
-		log.Printf("добавление сообщения: token=%s, fileID=%s, data=%s", token, fileID, data)
-
-		if !userRepo.IsValidToken(token) {
-			http.Error(w, "недействительный токен", http.StatusUnauthorized)
-			return
-		}
-
-		user, exists := userRepo.GetUserByToken(token)
-		if !exists {
-			http.Error(w, "пользователь не найден", http.StatusUnauthorized)
+		query := r.URL.Query()
+		msg, err := ingestSvc.SendMessage(r.Context(), query.Get("token"), query.Get("fileID"), query.Get("data"))
+		if err != nil {
+			writeIngestError(w, err)
 			return
 		}
 
-		if user.FileID != fileID {
-			http.Error(w, "неверный fileID файла для данного токена", http.StatusBadRequest)
-			return
+		if ingestSvc.QuotaWarning(msg) {
+			w.Header().Set("X-Quota-Warning", "превышена мягкая квота на объем данных, см. /usage")
 		}
+		w.Write([]byte("сообщение добавлено"))
+	})
 
-		if _, exists := application.GetFileCh(fileID); !exists {
-			http.Error(w, "канал для файла не существует", http.StatusBadRequest)
-			return
-		}
+	// соединения WebSocket не отслеживаются http.Server, поэтому закрываются отдельно
+	wsHandler := ws.NewHandler(ingestSvc, cfg)
+	http.Handle("/ws", wsHandler)
 
-		msgHandler.HandleMessage(types.Message{
-			Token:  token,
-			FileID: fileID,
-			Data:   data,
-		})
+	server := &http.Server{Addr: ":8080", Handler: logger.HTTPMiddleware(tracing.HTTPMiddleware(http.DefaultServeMux))}
+	server.RegisterOnShutdown(wsHandler.Shutdown)
 
-		filePath := filepath.Join(cfg.FilesDir, fileID+".txt")
-		absoluteFilePath, err := filepath.Abs(filePath)
+	manager := lifecycle.NewManager(server, application, cfg.ShutdownGracePeriod)
+	if cfg.GRPCAddr != "" {
+		manager.AddListener(rpc.NewServer(cfg.GRPCAddr, ingestSvc, cfg.FilesDir))
+	}
+	if lineproto.Enabled(cfg) {
+		manager.AddListener(lineproto.NewServer(ingestSvc, cfg))
+	}
+	if syslog.Enabled(cfg) {
+		syslogServer, err := syslog.NewServer(ingestSvc, cfg)
 		if err != nil {
-			log.Fatalf("не удалось получить абсолютный путь для файла: %v", err)
+			slog.Error("не удалось настроить прием syslog", logger.KeyError, err)
+			return lifecycle.ExitFailure
 		}
-		log.Printf("cообщение добавлено и сохранено в файл: %s", absoluteFilePath)
-		w.Write([]byte("сообщение добавлено"))
-	})
-
-	server := &http.Server{Addr: ":8080"}
-
-	go func() {
-		log.Println("сервер запущен на порту 8080")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Не удалось запустить сервер: %s\n", err)
+		manager.AddListener(syslogServer)
+	}
+	if source.Enabled(cfg) {
+		fileSource, err := source.NewSource(ingestSvc, cfg)
+		if err != nil {
+			slog.Error("не удалось настроить локальные источники", logger.KeyError, err)
+			return lifecycle.ExitFailure
 		}
-	}()
+		manager.AddListener(fileSource)
+	}
 
-	go application.Start(ctx)
+	webhooks.Start()
+	code := manager.Run(ctx)
 
-	<-ctx.Done()
+	// уведомления о последней записи при остановке приложения доставляются после нее
+	webhookCtx, cancel := context.WithTimeout(context.Background(), cfg.WebhookTimeout)
+	defer cancel()
+	webhooks.Shutdown(webhookCtx)
+	return code
+}
 
-	log.Println("завершение работы сервера")
-	if err := server.Shutdown(context.Background()); err != nil {
-		log.Fatalf("Ошибка завершения работы сервера:%+v", err)
+// insideDir сообщает, находится ли каталог dir внутри parent или совпадает с ним.
+func insideDir(dir, parent string) bool {
+	if dir == "" {
+		return false
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absParent, err := filepath.Abs(parent)
+	if err != nil {
+		return false
 	}
-	log.Println("сервер успешно завершил работу")
+	rel, err := filepath.Rel(absParent, absDir)
+	return err == nil && filepath.IsLocal(rel)
 }
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+)
+
+// writeRateLimited отвечает 429 с заголовками, по которым отправитель
+// может понять, когда повторить запрос.
+func writeRateLimited(w http.ResponseWriter, err *handler.RateLimitError) {
+	h := w.Header()
+	h.Set("Retry-After", strconv.Itoa(ceilSeconds(err.RetryAfter.Seconds())))
+	h.Set("X-RateLimit-Limit", strconv.FormatFloat(err.Limit, 'f', -1, 64))
+	h.Set("X-RateLimit-Remaining", strconv.FormatFloat(math.Floor(err.Remaining), 'f', -1, 64))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(err.Reset.Seconds())))
+	h.Set("X-RateLimit-Scope", err.Scope)
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
+
+func ceilSeconds(s float64) int {
+	return int(math.Ceil(s))
+}
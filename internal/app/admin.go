@@ -0,0 +1,79 @@
+package app
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+var ErrUnknownFile = errors.New("файл не зарегистрирован")
+
+func (a *App) fileExists(fileID string) bool {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	_, exists := a.pools[fileID]
+	return exists
+}
+
+// Flush запускает запись кеша всех файлов (или одного, если fileID не пустой)
+// и дожидается ее завершения. Приостановленные оператором файлы пропускаются,
+// приостановка после серии ошибок игнорируется - это решение оператора.
+// Возвращает количество отправленных на запись сообщений.
+func (a *App) Flush(fileID string) (int, error) {
+	if fileID != "" && !a.fileExists(fileID) {
+		return 0, ErrUnknownFile
+	}
+
+	n := a.flushCache(func(id string, _ *fileBatch) bool {
+		return (fileID == "" || id == fileID) && !a.isPaused(id)
+	})
+	a.writeWg.Wait()
+
+	slog.Info("ручной сброс кеша", logger.KeyFileID, fileID, "messages", n)
+	return n, nil
+}
+
+// Pending возвращает сообщения, ожидающие записи, по всем файлам или по одному.
+func (a *App) Pending(fileID string) (map[string][]types.Message, error) {
+	if fileID != "" && !a.fileExists(fileID) {
+		return nil, ErrUnknownFile
+	}
+	return a.cache.peek(fileID), nil
+}
+
+// PauseFile приостанавливает запись файла: сообщения продолжают приниматься и копятся в кеше.
+func (a *App) PauseFile(fileID string) error {
+	return a.setPaused(fileID, true)
+}
+
+func (a *App) ResumeFile(fileID string) error {
+	return a.setPaused(fileID, false)
+}
+
+func (a *App) setPaused(fileID string, paused bool) error {
+	if !a.fileExists(fileID) {
+		return ErrUnknownFile
+	}
+
+	a.statsMu.Lock()
+	a.statsLocked(fileID).paused = paused
+	a.statsMu.Unlock()
+
+	slog.Info("изменена приостановка записи файла", logger.KeyFileID, fileID, "paused", paused)
+	return nil
+}
+
+// DropFile удаляет из кеша сообщения файла, не записывая их. Возвращает количество удаленных сообщений.
+func (a *App) DropFile(fileID string) (int, error) {
+	if !a.fileExists(fileID) {
+		return 0, ErrUnknownFile
+	}
+
+	messages := a.cache.take(fileID)
+	a.releaseUsage(fileID, messages)
+	n := len(messages)
+	slog.Warn("сообщения файла удалены из кеша без записи", logger.KeyFileID, fileID, "messages", n)
+	return n, nil
+}
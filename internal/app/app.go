@@ -2,210 +2,514 @@ package app
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/deadletter"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/events"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/fileid"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/quota"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/route"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/tracing"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
 )
 
+var errUnroutable = errors.New("канал для файла не существует")
+
 type App struct {
-	cfg         *config.Config
-	cache       map[string][]types.Message
-	channels    map[string]chan types.Message
-	queue       chan types.Message
-	mutex       sync.Mutex
-	wg          sync.WaitGroup
-	writeWg     sync.WaitGroup // добавлен новый WaitGroup для записи в файл
-	workerCount map[string]int
-	writer      types.FileWriter
-	userRepo    *repository.UserRepository
+	cfg      *config.Config
+	cache    *shardedCache
+	pools    map[string]*filePool
+	queue    chan types.Message
+	mutex    sync.RWMutex    // защищает pools и ctx, кеш блокируется по шардам
+	ctx      context.Context // контекст обработчиков каналов файлов, nil до вызова Start
+	queueWg  sync.WaitGroup
+	wg       sync.WaitGroup
+	flushWg  sync.WaitGroup
+	writeWg  writeCounter // незавершенные записи батчей в файлы
+	intakeMu sync.RWMutex // защищает closing от гонки с отправкой в очередь
+	closing  bool
+	statsMu  sync.Mutex
+	stats    map[string]*fileStats
+	usage    *quota.Store
+	router   *route.Router
+	writer   types.FileWriter
+	userRepo *repository.UserRepository
+
+	addUserMu sync.Mutex // упорядочивает добавление пользователей, см. AddUser
+
+	sequences   bool              // нумерация записанных сообщений, см. TrackSequences
+	deadLetters *deadletter.Store // батчи, не записанные после всех попыток
+
+	// очереди батчей на запись по файлам; файл есть в карте, пока его очередь разбирается
+	writesMu sync.Mutex
+	writes   map[string][]pendingWrite
 }
 
 func NewApp(cfg *config.Config, writer types.FileWriter, userRepo *repository.UserRepository) *App {
 	return &App{
-		cfg:         cfg,
-		cache:       make(map[string][]types.Message),
-		channels:    make(map[string]chan types.Message),
-		queue:       make(chan types.Message, 1000),
-		workerCount: make(map[string]int),
-		writer:      writer,
-		userRepo:    userRepo,
+		cfg:      cfg,
+		cache:    newShardedCache(cfg.CacheShards),
+		pools:    make(map[string]*filePool),
+		queue:    make(chan types.Message, 1000),
+		writes:   make(map[string][]pendingWrite),
+		stats:    make(map[string]*fileStats),
+		usage:    loadUsage(cfg.UsageFile),
+		writer:   writer,
+		userRepo: userRepo,
+
+		deadLetters: deadletter.NewStore(stateDir(cfg, "deadletter")),
 	}
 }
 
-func (a *App) Start(ctx context.Context) {
-	log.Println("запуск приложения")
+// Start запускает конвейер и блокируется до отмены ctx, после чего
+// останавливает его по порядку и возвращает отчет о незаписанных сообщениях.
+func (a *App) Start(ctx context.Context) ShutdownReport {
+	slog.Info("запуск приложения")
+
+	// у каждой ступени свой контекст, чтобы останавливать их по очереди
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	flusherCtx, stopFlusher := context.WithCancel(context.Background())
 
 	// Запуск воркеров для обработки общей очереди
 	for i := 0; i < a.cfg.NumWorkers; i++ {
-		a.wg.Add(1)
-		go a.processQueue(ctx)
+		a.queueWg.Add(1)
+		go a.processQueue(queueCtx)
 	}
 
 	// Запуск воркеров для каждого канала файла
-	for fileID, ch := range a.channels {
-		a.wg.Add(1)
-		go a.writeMsgsToCache(ctx, ch)
-		a.workerCount[fileID]++
-		log.Printf("запущен обработчик сообщений для файла: %s", fileID)
+	a.mutex.Lock()
+	a.ctx = workersCtx
+	for fileID, pool := range a.pools {
+		for i := 0; i < a.minFileWorkers(); i++ {
+			a.startFileWorkerLocked(fileID, pool)
+		}
+		slog.Debug("запущены обработчики сообщений файла", logger.KeyFileID, fileID)
 	}
+	a.mutex.Unlock()
 
-	a.wg.Add(1)
-	go a.writeFiles(ctx)
+	a.flushWg.Add(1)
+	go a.writeFiles(flusherCtx)
+
+	if a.cfg.RetentionInterval > 0 && a.retentionEnabled() {
+		a.flushWg.Add(1)
+		go a.janitor(flusherCtx)
+	}
+
+	if a.cfg.UsageFile != "" && a.cfg.UsageSaveInterval > 0 {
+		a.flushWg.Add(1)
+		go a.usageSaver(flusherCtx)
+	}
+
+	if a.cfg.ScaleInterval > 0 {
+		a.wg.Add(1)
+		go a.autoscale(workersCtx)
+	}
 
 	<-ctx.Done()
 
-	a.wg.Wait()
-	a.writeWg.Wait() // ожидание завершения всех горутин записи
+	report := a.shutdown(stages{
+		stopQueue:   stopQueue,
+		stopWorkers: stopWorkers,
+		stopFlusher: stopFlusher,
+	})
 
-	log.Println("завершение приложения")
+	slog.Info("завершение приложения")
+
+	return report
 }
 
 func (a *App) processQueue(ctx context.Context) {
-	defer a.wg.Done()
+	defer a.queueWg.Done()
 	for {
 		select {
 		case msg := <-a.queue:
-			a.mutex.Lock()
-
-			if ch, exists := a.channels[msg.FileID]; exists {
+			a.routeMsg(msg)
+		case <-ctx.Done():
+			// прием к этому моменту остановлен, доразбираем то, что осталось в очереди
+			for {
 				select {
-				case ch <- msg:
+				case msg := <-a.queue:
+					a.routeMsg(msg)
 				default:
-					log.Printf("Канал для файла %s переполнен, добавляем воркера", msg.FileID)
-					a.wg.Add(1)
-					go a.writeMsgsToCache(ctx, ch)
-					a.workerCount[msg.FileID]++
-					ch <- msg
+					return
 				}
-			} else {
-				log.Printf("канал для файла %s не существует", msg.FileID)
 			}
-
-			a.mutex.Unlock()
-		case <-ctx.Done():
-			return
 		}
 	}
 }
 
-func (a *App) writeMsgsToCache(ctx context.Context, ch <-chan types.Message) {
+// routeMsg передает сообщение из общей очереди в канал его файла.
+func (a *App) routeMsg(msg types.Message) {
+	span := tracing.StartMessageSpan(&msg, "app.route")
+	defer span.End()
+
+	a.mutex.RLock()
+	pool, exists := a.pools[msg.FileID]
+	workersCtx := a.ctx
+	a.mutex.RUnlock()
+	if !exists {
+		slog.Warn("канал для файла не существует", "msg", msg)
+		tracing.Fail(span, errUnroutable)
+		a.releaseUsage(msg.FileID, []types.Message{msg})
+		return
+	}
+
+	// отправка в канал выполняется без блокировки, чтобы не останавливать остальные файлы
+	select {
+	case pool.ch <- msg:
+		return
+	default:
+	}
+
+	slog.Warn("канал файла переполнен, добавляем обработчик", logger.KeyFileID, msg.FileID)
+	a.scaleUp(msg.FileID)
+	select {
+	case pool.ch <- msg:
+	case <-workersCtx.Done():
+		slog.Error("обработчики файла остановлены, сообщение не доставлено в канал", "msg", msg)
+		tracing.Fail(span, workersCtx.Err())
+	}
+}
+
+func (a *App) writeMsgsToCache(ctx context.Context, fileID string, pool *filePool) {
 	defer a.wg.Done()
+
+	// без таймаута простоя обработчик живет до завершения приложения
+	var idleCh <-chan time.Time
+	var idle *time.Timer
+	if a.cfg.WorkerIdleTimeout > 0 {
+		idle = time.NewTimer(a.cfg.WorkerIdleTimeout)
+		defer idle.Stop()
+		idleCh = idle.C
+	}
+
 	for {
 		select {
-		case msg := <-ch:
-			log.Printf("Получено сообщение для кеширования: %v", msg)
-			a.mutex.Lock()
-			a.cache[msg.FileID] = append(a.cache[msg.FileID], msg)
-			a.mutex.Unlock()
+		case <-idleCh:
+			if a.retire(fileID, pool) {
+				return
+			}
+			idle.Reset(a.cfg.WorkerIdleTimeout)
+		case msg := <-pool.ch:
+			if idle != nil {
+				idle.Reset(a.cfg.WorkerIdleTimeout)
+			}
+
+			slog.Debug("получено сообщение для кеширования", "msg", msg)
+
+			a.cacheMsg(msg)
 		case <-ctx.Done():
-			return
+			// очередь к этому моменту разобрана, переносим остаток канала в кеш
+			for {
+				select {
+				case msg := <-pool.ch:
+					a.cacheMsg(msg)
+				default:
+					return
+				}
+			}
 		}
 	}
 }
 
+func (a *App) cacheMsg(msg types.Message) {
+	span := tracing.StartMessageSpan(&msg, "app.cache")
+	defer span.End()
+
+	// горячий файл сбрасывается сразу, не дожидаясь тика воркера
+	isFull := func(batch *fileBatch) bool {
+		return a.isBatchFull(batch) && a.flushAllowed(msg.FileID, batch)
+	}
+	a.cache.add(msg, isFull, func(messages []types.Message) {
+		slog.Debug("достигнут лимит батча, досрочный сброс", logger.KeyFileID, msg.FileID)
+		a.startWrite(context.Background(), msg.FileID, messages)
+	})
+}
+
 func (a *App) writeFiles(ctx context.Context) {
-	defer a.wg.Done()
-	ticker := time.NewTicker(a.cfg.WorkerInterval)
+	defer a.flushWg.Done()
+	// у тенантов может быть свой интервал сброса, тикер идет с наименьшим из них
+	schedule := newFlushSchedule(a.flushTick())
+	ticker := time.NewTicker(schedule.tick)
 	defer ticker.Stop()
 
+	// проверка возраста сообщений выполняется чаще основного интервала
+	var ageCh <-chan time.Time
+	if a.cfg.MaxMessageAge > 0 {
+		ageTicker := time.NewTicker(a.cfg.MaxMessageAge / 2)
+		defer ageTicker.Stop()
+		ageCh = ageTicker.C
+	}
+
 	for {
 		select {
 		case <-ticker.C:
-			a.processCache()
+			a.processScheduled(schedule)
+		case <-ageCh:
+			a.processExpired()
 		case <-ctx.Done():
-			a.processCache() // Очищаем кэш при завершении работы
+			// финальный сброс кеша выполняет shutdown после разбора каналов
 			return
 		}
 	}
 }
 
 func (a *App) processCache() {
-	log.Println("обработка кэша")
+	a.flushCache(a.flushAllowed)
+}
 
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
+// flushCache запускает запись всех файлов, прошедших filter (nil - всех без исключения),
+// и возвращает количество отправленных на запись сообщений.
+func (a *App) flushCache(filter func(fileID string, batch *fileBatch) bool) int {
+	slog.Debug("обработка кэша")
+	start := time.Now()
+	defer func() { flushDuration.Observe(time.Since(start).Seconds()) }()
+
+	ctx, span := tracing.Start(context.Background(), "app.flush")
+	defer span.End()
+
+	total := 0
+	a.cache.takeAll(filter, func(fileID string, messages []types.Message) {
+		total += len(messages)
+		a.startWrite(ctx, fileID, messages)
+	})
+	return total
+}
 
-	for fileID, messages := range a.cache {
-		if len(messages) == 0 {
-			continue
-		}
+// processExpired сбрасывает только те файлы, в которых есть сообщения старше MaxMessageAge.
+func (a *App) processExpired() {
+	expired := func(fileID string, batch *fileBatch) bool {
+		return time.Since(batch.oldest) >= a.cfg.MaxMessageAge && a.flushAllowed(fileID, batch)
+	}
+	a.cache.takeAll(expired, func(fileID string, messages []types.Message) {
+		slog.Debug("истек возраст сообщений, досрочный сброс", logger.KeyFileID, fileID)
+		a.startWrite(context.Background(), fileID, messages)
+	})
+}
+
+// flushAllowed пропускает файлы, запись в которые приостановлена оператором
+// или после серии ошибок.
+func (a *App) flushAllowed(fileID string, _ *fileBatch) bool {
+	return !a.isPaused(fileID) && a.circuitAllows(fileID)
+}
+
+func (a *App) isBatchFull(batch *fileBatch) bool {
+	if a.cfg.MaxBatchMessages > 0 && len(batch.messages) >= a.cfg.MaxBatchMessages {
+		return true
+	}
+	if a.cfg.MaxBatchBytes > 0 && batch.bytes >= a.cfg.MaxBatchBytes {
+		return true
+	}
+	return false
+}
+
+// pendingWrite - батч в очереди записи файла.
+type pendingWrite struct {
+	ctx      context.Context
+	messages []types.Message
+}
 
-		// создание копии сообщений для безопасной обработки
-		tempMessages := append([]types.Message{}, messages...)
-		a.cache[fileID] = a.cache[fileID][:0] // очищаем текущий кэш
+// startWrite ставит батч в очередь записи файла. Батчи одного файла пишутся
+// по одному в порядке постановки, повторы - до следующего батча, поэтому
+// досрочный, плановый и ручной сбросы не обгоняют друг друга. Вызывается под
+// блокировкой шарда кеша, из которого забран батч: порядок в очереди совпадает
+// с порядком, в котором батчи забраны из кеша.
+func (a *App) startWrite(ctx context.Context, fileID string, messages []types.Message) {
+	a.writeStarted(fileID, len(messages))
+	a.writeWg.Add(1)
+
+	a.writesMu.Lock()
+	defer a.writesMu.Unlock()
+	_, writing := a.writes[fileID]
+	a.writes[fileID] = append(a.writes[fileID], pendingWrite{ctx: ctx, messages: messages})
+	if !writing {
+		go a.drainWrites(fileID)
+	}
+}
 
-		a.writeWg.Add(1)
-		go a.writeToFile(fileID, tempMessages)
+// drainWrites записывает батчи из очереди файла, пока она не опустеет.
+// Для каждого файла работает не больше одной такой горутины.
+func (a *App) drainWrites(fileID string) {
+	for {
+		a.writesMu.Lock()
+		queue := a.writes[fileID]
+		if len(queue) == 0 {
+			delete(a.writes, fileID)
+			a.writesMu.Unlock()
+			return
+		}
+		next := queue[0]
+		a.writes[fileID] = queue[1:]
+		a.writesMu.Unlock()
+
+		a.writeToFile(next.ctx, fileID, next.messages)
 	}
 }
 
-func (a *App) writeToFile(fileID string, messages []types.Message) {
+func (a *App) writeToFile(ctx context.Context, fileID string, messages []types.Message) {
 	defer a.writeWg.Done()
 	filePath := filepath.Join(a.cfg.FilesDir, fileID+".txt")
 
+	ctx, span := tracing.StartBatchSpan(ctx, fileID, messages)
+	defer span.End()
+
+	lines := a.formatMessages(fileID, messages)
+	start := time.Now()
+	var err error
+	var attempts int
 	for attempt := 1; attempt <= a.cfg.MaxRetries; attempt++ {
-		if err := a.writer.WriteToFile(filePath, messages); err != nil {
-			log.Printf("ошибка при записи в файл %s: %v (попытка %d/%d)\n", filePath, err, attempt, a.cfg.MaxRetries)
+		attempts = attempt
+		if attempt > 1 {
+			events.Default.Publish(events.WriteRetried{FileID: fileID, Attempt: attempt, Err: err})
+		}
+		_, attemptSpan := tracing.Start(ctx, "app.write_attempt", attribute.Int(logger.KeyAttempt, attempt))
+		err = a.writer.WriteToFile(filePath, lines)
+		if err != nil {
+			tracing.Fail(attemptSpan, err)
+		}
+		attemptSpan.End()
+
+		if err != nil {
+			a.attemptFailed(fileID, err)
+			slog.Warn("ошибка при записи в файл", logger.KeyFileID, fileID, "path", filePath, logger.KeyAttempt, attempt, "max_attempts", a.cfg.MaxRetries, logger.KeyError, err)
 			time.Sleep(a.cfg.RetryInterval)
 		} else {
-			log.Printf("Файл %s успешно записан и кэш очищен", filePath)
+			slog.Debug("файл успешно записан", logger.KeyFileID, fileID, "path", filePath, "messages", len(messages), logger.KeyAttempt, attempt)
 			break
 		}
 	}
+	writeDuration.Observe(time.Since(start).Seconds(), fileID)
+	if err != nil {
+		tracing.Fail(span, err)
+		a.writeFinished(fileID, len(messages), attempts, batchRange{}, err)
+		a.releaseUsage(fileID, messages)
+		a.deadLetter(fileID, messages, attempts, err)
+		return
+	}
+
+	var size int64
+	for _, line := range lines {
+		size += messageSize(line)
+	}
+	a.writeFinished(fileID, len(messages), attempts, a.writtenRange(fileID, filePath, len(messages), size), nil)
+	a.commitUsage(fileID, messages, lines)
 }
 
 func (a *App) AddUser(user types.User) error {
-	err := a.userRepo.AddUser(user)
-	if err != nil {
+	// fileID и тенант становятся именами файла и каталога, поэтому должны быть уже нормализованы (см. fileid.Normalize)
+	if err := fileid.Validate(user.FileID); err != nil {
 		return err
 	}
-
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-
-	// добавление нового пользователя и создание нового канала для соответствующего файла, если такой канал еще не существует
-	if _, exists := a.channels[user.FileID]; !exists {
-		a.channels[user.FileID] = make(chan types.Message, 1000)
-		log.Printf("Создан канал для файла: %s", user.FileID)
-
-		// Запуск одного воркера для канала файла
-		a.wg.Add(1)
-		go a.writeMsgsToCache(context.Background(), a.channels[user.FileID])
-		a.workerCount[user.FileID]++
-		log.Printf("запущен обработчик сообщений для файла: %s", user.FileID)
+	if user.Tenant != "" {
+		if err := fileid.Validate(user.Tenant); err != nil {
+			return fmt.Errorf("недопустимый тенант: %w", err)
+		}
+	}
+	key := types.FileKey(user.Tenant, user.FileID)
+
+	// канал файла создается до регистрации пользователя: подписчики
+	// events.UserAdded, которое публикует репозиторий, рассчитывают на готовый
+	// канал. addUserMu не дает другому вызову занять токен между проверкой и
+	// регистрацией, a.mutex при регистрации не удерживается, чтобы подписчик
+	// мог обращаться к приложению
+	a.addUserMu.Lock()
+	defer a.addUserMu.Unlock()
+	if _, exists := a.userRepo.GetUserByToken(user.Token); exists {
+		return repository.ErrTokenInUse
+	}
+	if err := a.ensurePool(key); err != nil {
+		return err
+	}
+	if err := a.userRepo.AddUser(user); err != nil {
+		return err
 	}
 
-	log.Printf("пользователь добавлен: %v", user)
-
+	slog.Info("пользователь добавлен", logger.KeyFileID, key, logger.KeyToken, user.Token)
 	return nil
 }
 
+// addPoolLocked создает канал файла и, если приложение запущено, его обработчики.
+// Вызывающий должен удерживать a.mutex.
+func (a *App) addPoolLocked(key string) {
+	pool := &filePool{ch: make(chan types.Message, fileChCapacity)}
+	a.pools[key] = pool
+	slog.Info("создан канал для файла", logger.KeyFileID, key)
+
+	// до запуска приложения обработчики стартуют в Start
+	if a.runningLocked() {
+		for i := 0; i < a.minFileWorkers(); i++ {
+			a.startFileWorkerLocked(key, pool)
+		}
+		slog.Debug("запущены обработчики сообщений файла", logger.KeyFileID, key)
+	}
+}
+
 func (a *App) GetFileCh(fileID string) (chan types.Message, bool) {
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-	ch, exists := a.channels[fileID]
-	return ch, exists
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	pool, exists := a.pools[fileID]
+	if !exists {
+		return nil, false
+	}
+	return pool.ch, true
 }
 
-func (a *App) SendMsg(msg types.Message) {
-	log.Printf("отправка сообщения в очередь: %v", msg)
-	a.queue <- msg
+func (a *App) SendMsg(msg types.Message) error {
+	a.intakeMu.RLock()
+	defer a.intakeMu.RUnlock()
+
+	if a.closing {
+		return ErrShuttingDown
+	}
+
+	if msg.ID == "" {
+		msg.ID = logger.NewID()
+	}
+
+	span := tracing.StartMessageSpan(&msg, "app.enqueue")
+	defer span.End()
+
+	copies, err := a.fanOut(msg)
+	if err != nil {
+		tracing.Fail(span, err)
+		return err
+	}
+
+	// копии идут в очередь по отдельности, как и сообщения, отправленные в файл
+	// назначения напрямую, и записываются батчами своего файла. Батчи файла
+	// пишутся строго по очереди (см. startWrite), а порядок сообщений внутри них
+	// совпадает с порядком приема, только если у очереди и канала файла по
+	// одному обработчику: параллельные обработчики могут переставить соседние сообщения
+	for _, c := range copies {
+		slog.Debug("отправка сообщения в очередь", "msg", c)
+		a.queue <- c
+	}
+	return nil
 }
 
 func (a *App) Shutdown() {
-	log.Println("завершение работы, обработка оставшихся сообщений в кэше")
+	slog.Info("завершение работы, обработка оставшихся сообщений в кэше")
 	a.processCache()
-	a.writeWg.Wait() // ожидание завершения всех горутин записи
-	log.Println("завершение работы, кэш обработан")
+	a.writeWg.Wait() // ожидание завершения всех записей
+	slog.Info("завершение работы, кэш обработан")
 }
 
 func (a *App) GetWorkerCount(fileID string) int {
-	a.mutex.Lock()
-	defer a.mutex.Unlock()
-	return a.workerCount[fileID]
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	if pool, exists := a.pools[fileID]; exists {
+		return pool.workers
+	}
+	return 0
 }
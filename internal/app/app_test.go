@@ -2,18 +2,37 @@ package app
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
 	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/events"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/process"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/quota"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/route"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/schema"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/webhook"
 )
 
 func setupConfig(filesDir string) *config.Config {
@@ -22,6 +41,7 @@ func setupConfig(filesDir string) *config.Config {
 		WorkerInterval: 1 * time.Second,
 		FilesDir:       filesDir,
 		NumWorkers:     1,
+		MaxFileWorkers: 10,
 		MaxRetries:     3,
 		RetryInterval:  2 * time.Second,
 	}
@@ -105,6 +125,20 @@ func TestSuccessfulWrite(t *testing.T) {
 	checkFile(t, filepath.Join(filesDir, "file1.txt"), generateExpectedData(100))
 }
 
+// Проверяет, что пользователь с fileID, выходящим за пределы каталога файлов, не добавляется.
+func TestAddUserRejectsInvalidFileID(t *testing.T) {
+	application, _ := setup(t.TempDir())
+
+	for _, fileID := range []string{"../../etc/passwd", "a/b", "File1", "nul", ""} {
+		if err := application.AddUser(types.User{Token: "valid_token_1", FileID: fileID}); err == nil {
+			t.Errorf("ожидалась ошибка для fileID %q", fileID)
+		}
+	}
+	if _, exists := application.GetFileCh("../../etc/passwd"); exists {
+		t.Fatalf("не ожидался канал для недопустимого fileID")
+	}
+}
+
 // Проверяет обработку недействительных токенов.
 func TestInvalidToken(t *testing.T) {
 	filesDir := filepath.Join("..", "..", "files", "TestInvalidToken")
@@ -248,6 +282,8 @@ func TestHighLoad(t *testing.T) {
 	defer os.RemoveAll(filesDir)
 
 	cfg := setupConfig(filesDir)
+	cfg.ScaleInterval = 10 * time.Millisecond
+	cfg.ScaleUpThreshold = 0.5
 	writer := &types.DefaultFileWriter{}
 	userRepo := repository.NewUserRepository(cfg.ValidTokens)
 	application := NewApp(cfg, writer, userRepo)
@@ -280,14 +316,242 @@ func TestHighLoad(t *testing.T) {
 
 	time.Sleep(5 * time.Second)
 
+	// масштабирование под нагрузкой не должно выходить за предел MaxFileWorkers
+	if count := application.GetWorkerCount("file1"); count < 1 || count > cfg.MaxFileWorkers {
+		t.Errorf("Ожидалось от 1 до %d обработчиков, получено: %d", cfg.MaxFileWorkers, count)
+	}
+
 	application.Shutdown()
 
-	// Проверка увеличения количества воркеров
-	if application.GetWorkerCount("file1") <= 10 {
-		t.Errorf("Ожидалось увеличение количества воркеров, но их количество осталось: %d", application.GetWorkerCount("file1"))
+	checkFile(t, filepath.Join(filesDir, "file1.txt"), generateExpectedData(10000))
+}
+
+// Проверяет масштабирование обработчиков файла по заполненности канала и их остановку при простое.
+func TestAutoscaleUpAndDown(t *testing.T) {
+	cfg := setupConfig(t.TempDir())
+	cfg.MinFileWorkers = 1
+	cfg.MaxFileWorkers = 4
+	cfg.ScaleUpThreshold = 0.5
+	cfg.ScaleInterval = 20 * time.Millisecond
+	cfg.WorkerIdleTimeout = 300 * time.Millisecond
+	application := NewApp(cfg, &types.DefaultFileWriter{}, repository.NewUserRepository(cfg.ValidTokens))
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
 	}
 
-	checkFile(t, filepath.Join(filesDir, "file1.txt"), generateExpectedData(10000))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if count := application.GetWorkerCount("file1"); count != 1 {
+		t.Fatalf("Ожидался 1 обработчик после запуска, получено: %d", count)
+	}
+
+	// блокируем кеш, чтобы обработчики не успевали разбирать канал
+	for _, s := range application.cache.shards {
+		s.mutex.Lock()
+	}
+	ch, _ := application.GetFileCh("file1")
+	for i := 0; i < fileChCapacity; i++ {
+		ch <- types.Message{Token: "valid_token_1", FileID: "file1", Data: fmt.Sprintf("data%d", i)}
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if count := application.GetWorkerCount("file1"); count != cfg.MaxFileWorkers {
+		t.Errorf("Ожидалось масштабирование до %d обработчиков, получено: %d", cfg.MaxFileWorkers, count)
+	}
+
+	for _, s := range application.cache.shards {
+		s.mutex.Unlock()
+	}
+
+	time.Sleep(1 * time.Second)
+	if count := application.GetWorkerCount("file1"); count != cfg.MinFileWorkers {
+		t.Errorf("Ожидалось сокращение до %d обработчиков при простое, получено: %d", cfg.MinFileWorkers, count)
+	}
+
+	// все обработчики должны завершаться вместе с контекстом приложения
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("приложение не завершилось после отмены контекста")
+	}
+}
+
+// Проверяет, что ожидание записей допускается одновременно с началом новых.
+func TestWriteCounterAddDuringWait(t *testing.T) {
+	var c writeCounter
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Add(1)
+				c.Done()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Wait()
+			}
+		}()
+	}
+	wg.Wait()
+
+	c.Add(1)
+	done := make(chan struct{})
+	go func() {
+		c.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("ожидание завершилось до окончания записи")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Done()
+	<-done
+}
+
+// Проверяет, что при остановке сообщения из очереди и каналов файлов доходят до файла.
+func TestShutdownDrainsPipeline(t *testing.T) {
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = time.Hour
+	application := NewApp(cfg, &types.DefaultFileWriter{}, repository.NewUserRepository(cfg.ValidTokens))
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reportCh := make(chan ShutdownReport)
+	go func() {
+		reportCh <- application.Start(ctx)
+	}()
+
+	// блокируем кеш, чтобы сообщения остались в очереди и канале файла
+	for _, s := range application.cache.shards {
+		s.mutex.Lock()
+	}
+	for i := 0; i < 500; i++ {
+		if err := application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: fmt.Sprintf("data%d", i)}); err != nil {
+			t.Fatalf("не удалось отправить сообщение: %v", err)
+		}
+	}
+
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	if err := application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "late"}); err != ErrShuttingDown {
+		t.Errorf("Ожидалась ошибка %v после начала остановки, получено: %v", ErrShuttingDown, err)
+	}
+	for _, s := range application.cache.shards {
+		s.mutex.Unlock()
+	}
+
+	report := <-reportCh
+	if report.Total() != 0 || report.TimedOut {
+		t.Fatalf("Ожидалась остановка без потерь, получено: %+v", report)
+	}
+
+	checkFile(t, filepath.Join(filesDir, "file1.txt"), generateExpectedData(500))
+}
+
+// Проверяет, что при превышении ShutdownTimeout остановка не зависает и сообщает о незаписанных данных.
+func TestShutdownDeadlineReportsUnflushed(t *testing.T) {
+	cfg := setupConfig(t.TempDir())
+	cfg.WorkerInterval = time.Hour
+	cfg.ShutdownTimeout = 200 * time.Millisecond
+	writer := &SlowFileWriter{Delay: 2 * time.Second}
+	application := NewApp(cfg, writer, repository.NewUserRepository(cfg.ValidTokens))
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reportCh := make(chan ShutdownReport)
+	go func() {
+		reportCh <- application.Start(ctx)
+	}()
+
+	for i := 0; i < 10; i++ {
+		application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: fmt.Sprintf("data%d", i)})
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case report := <-reportCh:
+		if !report.TimedOut || report.Unflushed["file1"] != 10 {
+			t.Fatalf("Ожидался таймаут и 10 незаписанных сообщений, получено: %+v", report)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("остановка не уложилась в ShutdownTimeout")
+	}
+}
+
+// Проверяет, что одно сообщение можно проследить от обработчика до записи в файл.
+func TestTracingThroughPipeline(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 100 * time.Millisecond
+	cfg.RetryInterval = 10 * time.Millisecond
+	writer := &MockFileWriter{maxFails: 1}
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := NewApp(cfg, writer, userRepo)
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go application.Start(ctx)
+
+	msgHandler := handler.NewMessageHandler(userRepo, application, cfg)
+	if err := msgHandler.HandleMessage(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data1"}); err != nil {
+		t.Fatalf("не удалось отправить сообщение: %v", err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	application.Shutdown()
+
+	spans := exporter.GetSpans()
+	byName := make(map[string][]tracetest.SpanStub)
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+
+	traceID := byName["handler.handle_message"][0].SpanContext.TraceID()
+	for _, name := range []string{"handler.handle_message", "app.enqueue", "app.route", "app.cache"} {
+		if len(byName[name]) != 1 {
+			t.Fatalf("Ожидался один спан %s, получено: %d", name, len(byName[name]))
+		}
+		if byName[name][0].SpanContext.TraceID() != traceID {
+			t.Errorf("спан %s не относится к трассировке сообщения", name)
+		}
+	}
+
+	if len(byName["app.write_attempt"]) != 2 {
+		t.Errorf("Ожидалось 2 попытки записи, получено: %d", len(byName["app.write_attempt"]))
+	}
+	write := byName["app.write_file"]
+	if len(write) != 1 || len(write[0].Links) != 1 || write[0].Links[0].SpanContext.TraceID() != traceID {
+		t.Fatalf("Ожидался спан записи со ссылкой на трассировку сообщения, получено: %+v", write)
+	}
 }
 
 type MockFileWriter struct {
@@ -342,6 +606,54 @@ func TestRetriesWithPartialFailures(t *testing.T) {
 	checkFile(t, filepath.Join(filesDir, "file1.txt"), []string{"data1"})
 }
 
+// Проверяет порядок записи батчей файла: досрочный сброс не обгоняет батч,
+// ожидающий повтора после планового сброса, а следующий плановый - их обоих.
+func TestWriteOrderWithRetry(t *testing.T) {
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 30 * time.Millisecond
+	cfg.RetryInterval = 150 * time.Millisecond
+	cfg.MaxBatchMessages = 2
+	application := NewApp(cfg, &MockFileWriter{maxFails: 1}, repository.NewUserRepository(cfg.ValidTokens))
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+
+	send := func(data string) {
+		if err := application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: data}); err != nil {
+			t.Fatalf("сообщение не принято: %v", err)
+		}
+	}
+	// первая попытка записи data1 по тику неудачна, повтор - через RetryInterval
+	send("data1")
+	time.Sleep(60 * time.Millisecond)
+	// досрочный сброс по MaxBatchMessages во время ожидания повтора
+	send("data2")
+	send("data3")
+	time.Sleep(20 * time.Millisecond)
+	// плановый сброс, тоже во время ожидания повтора
+	send("data4")
+	time.Sleep(400 * time.Millisecond)
+
+	cancel()
+	<-done
+
+	data, err := os.ReadFile(filepath.Join(filesDir, "file1.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "data1\ndata2\ndata3\ndata4\n"; string(data) != expected {
+		t.Fatalf("ожидалось содержимое %q, получено %q", expected, data)
+	}
+}
+
 // Проверяет, что запись прерывается после достижения MaxRetries.
 func TestExceedingMaxRetriesStopsRetrying(t *testing.T) {
 	filesDir := filepath.Join("..", "..", "files", "TestExceedingMaxRetriesStopsRetrying")
@@ -383,6 +695,113 @@ func TestExceedingMaxRetriesStopsRetrying(t *testing.T) {
 	}
 }
 
+// Проверяет приостановку записи после серии ошибок и ее отражение в статусе и готовности.
+func TestCircuitBreakerStatusAndReadiness(t *testing.T) {
+	cfg := setupConfig(t.TempDir())
+	cfg.WorkerInterval = time.Hour
+	cfg.MaxRetries = 1
+	cfg.RetryInterval = time.Millisecond
+	cfg.BreakerThreshold = 1
+	cfg.BreakerCooldown = time.Hour
+	application := NewApp(cfg, &MockFileWriter{maxFails: 100}, repository.NewUserRepository(cfg.ValidTokens))
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	if _, ready := application.Readiness(); ready {
+		t.Fatalf("приложение не должно быть готово до запуска")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go application.Start(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	if checks, ready := application.Readiness(); !ready {
+		t.Fatalf("Ожидалась готовность после запуска, получено: %+v", checks)
+	}
+
+	application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data0"})
+	time.Sleep(50 * time.Millisecond)
+	application.Shutdown()
+
+	// запись приостановлена, новое сообщение должно остаться в кеше
+	application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data1"})
+	time.Sleep(50 * time.Millisecond)
+	application.Shutdown()
+
+	status := application.Status()
+	if len(status.Files) != 1 {
+		t.Fatalf("Ожидался статус одного файла, получено: %+v", status)
+	}
+	fs := status.Files[0]
+	if !fs.CircuitOpen || fs.LastError == "" || fs.Failed != 1 || fs.CacheMessages != 1 || fs.Workers != 1 {
+		t.Errorf("неожиданный статус файла: %+v", fs)
+	}
+
+	checks, ready := application.Readiness()
+	if ready {
+		t.Errorf("приложение не должно быть готово при приостановленной записи: %+v", checks)
+	}
+}
+
+// Проверяет приостановку, просмотр, ручной сброс и удаление кеша файла.
+func TestAdminControls(t *testing.T) {
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 50 * time.Millisecond
+	application := NewApp(cfg, &types.DefaultFileWriter{}, repository.NewUserRepository(cfg.ValidTokens))
+	for _, user := range []types.User{{Token: "valid_token_1", FileID: "file1"}, {Token: "valid_token_2", FileID: "file2"}} {
+		if err := application.AddUser(user); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go application.Start(ctx)
+
+	if err := application.PauseFile("unknown"); err != ErrUnknownFile {
+		t.Fatalf("Ожидалась ошибка %v, получено: %v", ErrUnknownFile, err)
+	}
+	if err := application.PauseFile("file1"); err != nil {
+		t.Fatalf("не удалось приостановить файл: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: fmt.Sprintf("data%d", i)})
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	// приостановленный файл не пишется воркером и не сбрасывается вручную
+	pending, _ := application.Pending("file1")
+	if len(pending["file1"]) != 3 {
+		t.Fatalf("Ожидалось 3 сообщения в кеше, получено: %v", pending)
+	}
+	if n, _ := application.Flush(""); n != 0 {
+		t.Fatalf("приостановленный файл не должен сбрасываться, сброшено: %d", n)
+	}
+	checkFile(t, filepath.Join(filesDir, "file1.txt"), []string{})
+
+	if err := application.ResumeFile("file1"); err != nil {
+		t.Fatalf("не удалось возобновить запись: %v", err)
+	}
+	if n, _ := application.Flush("file1"); n != 3 {
+		t.Fatalf("Ожидался сброс 3 сообщений, сброшено: %d", n)
+	}
+	checkFile(t, filepath.Join(filesDir, "file1.txt"), generateExpectedData(3))
+
+	application.PauseFile("file2")
+	application.SendMsg(types.Message{Token: "valid_token_2", FileID: "file2", Data: "dropped"})
+	time.Sleep(100 * time.Millisecond)
+	if n, _ := application.DropFile("file2"); n != 1 {
+		t.Fatalf("Ожидалось удаление 1 сообщения, удалено: %d", n)
+	}
+	if pending, _ := application.Pending(""); len(pending) != 0 {
+		t.Fatalf("кеш должен быть пуст, получено: %v", pending)
+	}
+}
+
 type SlowFileWriter struct {
 	Delay time.Duration
 }
@@ -448,3 +867,972 @@ func TestNewMessagesDuringWrite(t *testing.T) {
 
 	checkFile(t, filepath.Join(filesDir, "file1.txt"), generateExpectedData(10))
 }
+
+// Проверяет досрочный сброс файла при достижении лимита сообщений в батче.
+func TestFlushOnBatchSize(t *testing.T) {
+	filesDir := filepath.Join("..", "..", "files", "TestFlushOnBatchSize")
+	if err := os.MkdirAll(filesDir, 0755); err != nil {
+		t.Fatalf("не удалось создать папку для файлов: %v", err)
+	}
+	defer os.RemoveAll(filesDir)
+
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = time.Hour // тикер не должен успеть сработать
+	cfg.MaxBatchMessages = 10
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := NewApp(cfg, &types.DefaultFileWriter{}, userRepo)
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go application.Start(ctx)
+
+	for i := 0; i < 10; i++ {
+		application.SendMsg(types.Message{
+			Token:  "valid_token_1",
+			FileID: "file1",
+			Data:   fmt.Sprintf("data%d", i),
+		})
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	checkFile(t, filepath.Join(filesDir, "file1.txt"), generateExpectedData(10))
+}
+
+// Проверяет досрочный сброс файла по возрасту самого старого сообщения.
+func TestFlushOnMessageAge(t *testing.T) {
+	filesDir := filepath.Join("..", "..", "files", "TestFlushOnMessageAge")
+	if err := os.MkdirAll(filesDir, 0755); err != nil {
+		t.Fatalf("не удалось создать папку для файлов: %v", err)
+	}
+	defer os.RemoveAll(filesDir)
+
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = time.Hour // тикер не должен успеть сработать
+	cfg.MaxMessageAge = 200 * time.Millisecond
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := NewApp(cfg, &types.DefaultFileWriter{}, userRepo)
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go application.Start(ctx)
+
+	application.SendMsg(types.Message{
+		Token:  "valid_token_1",
+		FileID: "file1",
+		Data:   "data0",
+	})
+
+	time.Sleep(600 * time.Millisecond)
+
+	checkFile(t, filepath.Join(filesDir, "file1.txt"), generateExpectedData(1))
+}
+
+type countingFileWriter struct {
+	written atomic.Int64
+}
+
+func (c *countingFileWriter) WriteToFile(filePath string, messages []types.Message) error {
+	c.written.Add(int64(len(messages)))
+	return nil
+}
+
+// Измеряет пропускную способность конвейера очередь -> каналы -> кеш -> запись
+// в зависимости от количества воркеров очереди и отправителей. Масштабирование
+// видно при запуске с несколькими значениями GOMAXPROCS:
+//
+//	go test ./internal/app -run '^$' -bench PipelineThroughput -cpu 1,2,4,8
+//
+// ns/msg - время на одно сообщение от отправки до записи, msgs/s - пропускная способность.
+func BenchmarkPipelineThroughput(b *testing.B) {
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	defer slog.SetDefault(prev)
+
+	const numFiles = 64
+	tokens := make([]string, numFiles)
+	fileIDs := make([]string, numFiles)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("token%d", i)
+		fileIDs[i] = fmt.Sprintf("file%d", i)
+	}
+
+	for _, numWorkers := range []int{1, 2, 4, 8, 16} {
+		b.Run(fmt.Sprintf("workers=%d", numWorkers), func(b *testing.B) {
+			cfg := setupConfig(b.TempDir())
+			cfg.NumWorkers = numWorkers
+			cfg.WorkerInterval = 10 * time.Millisecond
+			cfg.MaxBatchMessages = 1000
+
+			writer := &countingFileWriter{}
+			application := NewApp(cfg, writer, repository.NewUserRepository(tokens))
+			for i, token := range tokens {
+				if err := application.AddUser(types.User{Token: token, FileID: fileIDs[i]}); err != nil {
+					b.Fatalf("не удалось добавить пользователя: %v", err)
+				}
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				application.Start(ctx)
+				close(done)
+			}()
+			defer func() {
+				cancel()
+				<-done
+			}()
+
+			var next atomic.Int64
+			b.ResetTimer()
+			start := time.Now()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := next.Add(1) % numFiles
+					application.SendMsg(types.Message{Token: tokens[i], FileID: fileIDs[i], Data: "data"})
+				}
+			})
+			// сообщения считаются обработанными, когда записаны
+			for writer.written.Load() < int64(b.N) {
+				time.Sleep(100 * time.Microsecond)
+			}
+			elapsed := time.Since(start)
+			b.StopTimer()
+
+			b.ReportMetric(float64(elapsed.Nanoseconds())/float64(b.N), "ns/msg")
+			b.ReportMetric(float64(b.N)/elapsed.Seconds(), "msgs/s")
+		})
+	}
+}
+
+// Измеряет добавление в кеш из нескольких горутин в зависимости от количества
+// шардов. Выигрыш от шардов виден только при нескольких параллельных
+// отправителях: запускать с -cpu 1,2,4,8.
+func BenchmarkShardedCacheAdd(b *testing.B) {
+	const numFiles = 64
+	notFull := func(*fileBatch) bool { return false }
+	messages := make([]types.Message, numFiles)
+	for i := range messages {
+		messages[i] = types.Message{FileID: fmt.Sprintf("file%d", i), Data: "data"}
+	}
+
+	for _, numShards := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", numShards), func(b *testing.B) {
+			cache := newShardedCache(numShards)
+
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := next.Add(1)
+					cache.add(messages[i%numFiles], notFull, nil)
+					if i%1000 == 0 {
+						cache.takeAll(nil, func(string, []types.Message) {})
+					}
+				}
+			})
+		})
+	}
+}
+
+// Проверяет файлы тенантов: подкаталоги, квоту, формат и собственный интервал сброса.
+func TestTenants(t *testing.T) {
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = time.Hour
+	cfg.Tenants = map[string]config.TenantConfig{
+		"acme":  {MaxFiles: 1, Format: FormatJSON, FlushInterval: 100 * time.Millisecond},
+		"empty": {},
+	}
+	application := NewApp(cfg, &types.DefaultFileWriter{}, repository.NewUserRepository(cfg.ValidTokens))
+
+	for _, user := range []types.User{
+		{Token: "valid_token_1", FileID: "file1", Tenant: "acme"},
+		{Token: "valid_token_2", FileID: "file1"},
+	} {
+		if err := application.AddUser(user); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+	if err := application.AddUser(types.User{Token: "acme_token_2", FileID: "file2", Tenant: "acme"}); !errors.Is(err, ErrTenantQuota) {
+		t.Fatalf("Ожидалась ошибка %v, получено: %v", ErrTenantQuota, err)
+	}
+	if err := application.AddUser(types.User{Token: "bad_tenant", FileID: "file3", Tenant: "../x"}); err == nil {
+		t.Fatalf("ожидалась ошибка для недопустимого тенанта")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+	// при остановке файлы дописываются, каталог теста удаляется только после этого
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	application.SendMsg(types.Message{Token: "valid_token_1", FileID: types.FileKey("acme", "file1"), Data: "data0"})
+	application.SendMsg(types.Message{Token: "valid_token_2", FileID: "file1", Data: "data0"})
+	time.Sleep(500 * time.Millisecond)
+
+	// тенант сбрасывается по своему интервалу, остальные файлы ждут общего
+	data, err := os.ReadFile(filepath.Join(filesDir, "acme", "file1.txt"))
+	if err != nil {
+		t.Fatalf("не удалось прочитать файл тенанта: %v", err)
+	}
+	var line jsonLine
+	if err := json.Unmarshal(data, &line); err != nil || line.Data != "data0" {
+		t.Fatalf("ожидалась строка в формате JSON, получено: %q (%v)", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(filesDir, "file1.txt")); !os.IsNotExist(err) {
+		t.Fatalf("файл без тенанта не должен быть записан до общего интервала")
+	}
+
+	tenants := application.Tenants()
+	expected := []TenantStatus{
+		{Tenant: "", Files: []string{"file1"}},
+		{Tenant: "acme", Files: []string{"file1"}, MaxFiles: 1},
+		{Tenant: "empty", Files: []string{}},
+	}
+	if !reflect.DeepEqual(tenants, expected) {
+		t.Fatalf("Ожидалось %+v, получено: %+v", expected, tenants)
+	}
+
+	files, err := application.TenantFiles("acme")
+	if err != nil || len(files) != 1 || files[0].FileID != "acme/file1" {
+		t.Fatalf("неверный список файлов тенанта: %+v (%v)", files, err)
+	}
+	if _, err := application.TenantFiles("unknown"); !errors.Is(err, ErrUnknownTenant) {
+		t.Fatalf("Ожидалась ошибка %v, получено: %v", ErrUnknownTenant, err)
+	}
+}
+
+// Проверяет ограничение скорости приема по токену с переопределением в настройках.
+func TestRateLimit(t *testing.T) {
+	cfg := setupConfig(t.TempDir())
+	cfg.TokenMessageRate = 2
+	cfg.TokenRateLimits = map[string]config.RateLimit{"valid_token_2": {MessageRate: 10}}
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := NewApp(cfg, &types.DefaultFileWriter{}, userRepo)
+	msgHandler := handler.NewMessageHandler(userRepo, application, cfg)
+
+	for _, user := range []types.User{
+		{Token: "valid_token_1", FileID: "file1"},
+		{Token: "valid_token_2", FileID: "file2"},
+	} {
+		if err := application.AddUser(user); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+
+	var limited *handler.RateLimitError
+	for i := 0; i < 3; i++ {
+		err := msgHandler.HandleMessage(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data"})
+		if i < 2 && err != nil {
+			t.Fatalf("сообщение %d в пределах лимита отклонено: %v", i, err)
+		}
+		if i == 2 && !errors.As(err, &limited) {
+			t.Fatalf("ожидалась ошибка лимита, получено: %v", err)
+		}
+	}
+	if !errors.Is(limited, handler.ErrRateLimited) || limited.Scope != "token" || limited.RetryAfter <= 0 {
+		t.Fatalf("неверное описание лимита: %+v", limited)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := msgHandler.HandleMessage(types.Message{Token: "valid_token_2", FileID: "file2", Data: "data"}); err != nil {
+			t.Fatalf("лимит пользователя не применен: %v", err)
+		}
+	}
+}
+
+// Проверяет отклонение данных, не соответствующих схеме файла, и запись версии схемы.
+func TestSchemaValidation(t *testing.T) {
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 50 * time.Millisecond
+	cfg.Tenants = map[string]config.TenantConfig{"acme": {Format: FormatJSON}}
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := NewApp(cfg, &types.DefaultFileWriter{}, userRepo)
+	msgHandler := handler.NewMessageHandler(userRepo, application, cfg)
+	schemas, err := schema.NewRegistry(map[string]config.SchemaConfig{
+		"acme/file1": {Version: "v2", Fields: []config.SchemaField{
+			{Name: "level", Type: schema.TypeString, Required: true, Enum: []string{"info", "error"}},
+			{Name: "amount", Type: schema.TypeNumber},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgHandler.SetSchemas(schemas)
+	// схема проверяет уже обработанные данные: обрезанный JSON не должен попасть в файл
+	processors, err := process.NewPipeline(map[string][]config.ProcessorConfig{
+		"acme/file1": {{Type: process.TypeTruncate, MaxBytes: 40}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgHandler.SetProcessors(processors)
+
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1", Tenant: "acme"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	send := func(data string) error {
+		return msgHandler.HandleMessage(types.Message{Token: "valid_token_1", FileID: "acme/file1", Data: data})
+	}
+	err = send(`{"level":"debug","amount":"10"}`)
+	var invalid *schema.ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Fields) != 2 {
+		t.Fatalf("ожидались два нарушения схемы, получено: %v", err)
+	}
+	if err := send(`{"level":"info","note":"длинное описание события"}`); !errors.Is(err, schema.ErrInvalid) {
+		t.Fatalf("ожидалась ошибка %v для обрезанных данных, получено: %v", schema.ErrInvalid, err)
+	}
+	if err := send(`{"level":"info","amount":10.5}`); err != nil {
+		t.Fatalf("данные по схеме отклонены: %v", err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	data, err := os.ReadFile(filepath.Join(filesDir, "acme", "file1.txt"))
+	if err != nil {
+		t.Fatalf("не удалось прочитать файл: %v", err)
+	}
+	var line jsonLine
+	if err := json.Unmarshal(data, &line); err != nil || line.SchemaVersion != "v2" || line.Data != `{"level":"info","amount":10.5}` {
+		t.Fatalf("ожидалась одна строка с версией схемы, получено: %q (%v)", data, err)
+	}
+}
+
+// failingPathWriter не может записать файл path, остальные пишет как DefaultFileWriter.
+type failingPathWriter struct {
+	path string
+}
+
+func (w *failingPathWriter) WriteToFile(filePath string, messages []types.Message) error {
+	if filePath == w.path {
+		return fmt.Errorf("симулированная ошибка записи")
+	}
+	return (&types.DefaultFileWriter{}).WriteToFile(filePath, messages)
+}
+
+// Проверяет копирование и перенос сообщений в файлы назначения: порядок в каждом
+// файле, независимость записи и квоты тенанта для копий.
+func TestFanOut(t *testing.T) {
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 50 * time.Millisecond
+	cfg.RetryInterval = 10 * time.Millisecond
+	cfg.Tenants = map[string]config.TenantConfig{"acme": {MaxFiles: 1}}
+	writer := &failingPathWriter{path: filepath.Join(filesDir, "broken.txt")}
+	application := NewApp(cfg, writer, repository.NewUserRepository(cfg.ValidTokens))
+	router, err := route.NewRouter([]config.RouteRule{
+		{To: []string{"all"}},
+		{Match: `^ERROR`, To: []string{"errors"}},
+		{Match: `^DEBUG`, To: []string{"debug"}, Move: true},
+		{FileID: "file1", To: []string{"broken"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	application.SetRouter(router)
+
+	for _, user := range []types.User{
+		{Token: "valid_token_1", FileID: "file1"},
+		{Token: "valid_token_2", FileID: "file2", Tenant: "acme"},
+	} {
+		if err := application.AddUser(user); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	var expected []string
+	for i := 0; i < 20; i++ {
+		data := fmt.Sprintf("data%d", i)
+		if i%5 == 0 {
+			data = "ERROR " + data
+		}
+		expected = append(expected, data)
+		if err := application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: data}); err != nil {
+			t.Fatalf("сообщение %d не принято: %v", i, err)
+		}
+	}
+	if err := application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "DEBUG moved"}); err != nil {
+		t.Fatalf("перенесенное сообщение не принято: %v", err)
+	}
+	// копия в acme/all превысила бы квоту тенанта, сообщение остается в исходном файле
+	if err := application.SendMsg(types.Message{Token: "valid_token_2", FileID: "acme/file2", Data: "tenant"}); err != nil {
+		t.Fatalf("сообщение тенанта не принято из-за копии: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(filesDir, name))
+		return string(data)
+	}
+	if got := read("file1.txt"); got != strings.Join(expected, "\n")+"\n" {
+		t.Fatalf("неверное содержимое исходного файла: %q", got)
+	}
+	if got := read("all.txt"); got != strings.Join(expected, "\n")+"\nDEBUG moved\n" {
+		t.Fatalf("копии в общем файле не в порядке приема: %q", got)
+	}
+	if got := read("errors.txt"); got != "ERROR data0\nERROR data5\nERROR data10\nERROR data15\n" {
+		t.Fatalf("неверное содержимое файла по содержимому: %q", got)
+	}
+	if got := read("debug.txt"); got != "DEBUG moved\n" {
+		t.Fatalf("перенесенное сообщение не записано: %q", got)
+	}
+	if got := read(filepath.Join("acme", "file2.txt")); got != "tenant\n" {
+		t.Fatalf("сообщение тенанта не записано: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(filesDir, "acme", "all.txt")); !os.IsNotExist(err) {
+		t.Fatalf("копия сверх квоты тенанта не должна быть записана")
+	}
+
+	// ошибки записи копии не затрагивают исходный файл, а ее объем снимается с учета
+	if usage := application.Usage("valid_token_1", "broken").File; usage.Written != 0 || usage.Pending != 0 {
+		t.Fatalf("объем незаписанных копий должен быть снят с учета: %+v", usage)
+	}
+}
+
+// flakyPathWriter не записывает файл path первые fails раз.
+type flakyPathWriter struct {
+	path  string
+	mutex sync.Mutex
+	fails int
+}
+
+func (w *flakyPathWriter) WriteToFile(filePath string, messages []types.Message) error {
+	w.mutex.Lock()
+	fail := filePath == w.path && w.fails > 0
+	if fail {
+		w.fails--
+	}
+	w.mutex.Unlock()
+	if fail {
+		return fmt.Errorf("симулированная ошибка записи")
+	}
+	return (&types.DefaultFileWriter{}).WriteToFile(filePath, messages)
+}
+
+// Проверяет порядок копий в файле назначения, батчи которого сбрасываются
+// досрочно, пока первый из них ожидает повтора записи.
+func TestFanOutOrderWithRetry(t *testing.T) {
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 30 * time.Millisecond
+	cfg.RetryInterval = 150 * time.Millisecond
+	cfg.MaxBatchMessages = 3
+	writer := &flakyPathWriter{path: filepath.Join(filesDir, "all.txt"), fails: 1}
+	application := NewApp(cfg, writer, repository.NewUserRepository(cfg.ValidTokens))
+	router, err := route.NewRouter([]config.RouteRule{{To: []string{"all"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	application.SetRouter(router)
+	for _, user := range []types.User{
+		{Token: "valid_token_1", FileID: "file1"},
+		{Token: "valid_token_2", FileID: "file2"},
+	} {
+		if err := application.AddUser(user); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+
+	var expected []string
+	for i := 0; i < 12; i++ {
+		msg := types.Message{Token: "valid_token_1", FileID: "file1", Data: fmt.Sprintf("one%d", i)}
+		if i%2 == 1 {
+			msg = types.Message{Token: "valid_token_2", FileID: "file2", Data: fmt.Sprintf("two%d", i)}
+		}
+		expected = append(expected, msg.Data)
+		if err := application.SendMsg(msg); err != nil {
+			t.Fatalf("сообщение %d не принято: %v", i, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(400 * time.Millisecond)
+
+	cancel()
+	<-done
+
+	data, _ := os.ReadFile(filepath.Join(filesDir, "all.txt"))
+	if got := string(data); got != strings.Join(expected, "\n")+"\n" {
+		t.Fatalf("копии в файле назначения не в порядке приема: %q", got)
+	}
+}
+
+// Проверяет уведомления о записи файла, сохранении батча в dead letter и
+// приостановке записи.
+func TestWebhooks(t *testing.T) {
+	var mutex sync.Mutex
+	var received []webhook.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.Event
+		json.NewDecoder(r.Body).Decode(&event)
+		mutex.Lock()
+		received = append(received, event)
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 50 * time.Millisecond
+	cfg.MaxRetries = 1
+	cfg.RetryInterval = 10 * time.Millisecond
+	cfg.BreakerThreshold = 1
+	cfg.BreakerCooldown = time.Hour
+	cfg.Webhooks = []config.WebhookConfig{{URL: server.URL}}
+	cfg.WebhookQueueSize = 10
+	cfg.WebhookMaxAttempts = 1
+	cfg.WebhookTimeout = time.Second
+	webhooks, err := webhook.NewDispatcher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhooks.Subscribe(events.Default)
+	webhooks.Start()
+
+	cfg.StateDir = t.TempDir()
+	writer := &failingPathWriter{path: filepath.Join(filesDir, "file2.txt")}
+	application := NewApp(cfg, writer, repository.NewUserRepository(cfg.ValidTokens))
+	application.TrackSequences()
+	for _, user := range []types.User{
+		{Token: "valid_token_1", FileID: "file1"},
+		{Token: "valid_token_2", FileID: "file2"},
+	} {
+		if err := application.AddUser(user); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+
+	application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data0"})
+	application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data1"})
+	time.Sleep(200 * time.Millisecond)
+	application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data22"})
+	application.SendMsg(types.Message{Token: "valid_token_2", FileID: "file2", Data: "lost"})
+	time.Sleep(200 * time.Millisecond)
+
+	cancel()
+	<-done
+	if err := webhooks.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		Type     string
+		FileID   string
+		Messages int
+		Range    webhook.Range
+	}
+	got := make(map[summary]bool)
+	for _, e := range received {
+		got[summary{e.Type, e.FileID, e.Messages, e.Range}] = true
+		if e.Type == webhook.EventCircuitOpened && (e.Failures != 1 || e.Until.IsZero()) {
+			t.Errorf("неполное событие приостановки записи: %+v", e)
+		}
+	}
+	expected := map[summary]bool{
+		{webhook.EventFileFlushed, "file1", 2, webhook.Range{FirstSeq: 1, LastSeq: 2, ByteStart: 0, ByteEnd: 12}}:  true,
+		{webhook.EventFileFlushed, "file1", 1, webhook.Range{FirstSeq: 3, LastSeq: 3, ByteStart: 12, ByteEnd: 19}}: true,
+		{Type: webhook.EventBatchDeadLettered, FileID: "file2", Messages: 1}:                                       true,
+		{Type: webhook.EventCircuitOpened, FileID: "file2"}:                                                        true,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ожидались события %v, получено %v", expected, got)
+	}
+}
+
+// Проверяет события шины о добавлении пользователей и записи батчей.
+func TestEvents(t *testing.T) {
+	var mutex sync.Mutex
+	var got []any
+	record := func(event any) {
+		mutex.Lock()
+		got = append(got, event)
+		mutex.Unlock()
+	}
+	for _, unsubscribe := range []func(){
+		events.Subscribe(events.Default, func(e events.UserAdded) { record(e) }),
+		events.Subscribe(events.Default, func(e events.BatchFlushed) { record(e) }),
+		events.Subscribe(events.Default, func(e events.WriteRetried) { record(events.WriteRetried{FileID: e.FileID, Attempt: e.Attempt}) }),
+		events.Subscribe(events.Default, func(e events.WriteFailed) {
+			record(events.WriteFailed{FileID: e.FileID, Messages: e.Messages, Attempts: e.Attempts})
+		}),
+	} {
+		defer unsubscribe()
+	}
+
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 50 * time.Millisecond
+	cfg.MaxRetries = 2
+	cfg.RetryInterval = 10 * time.Millisecond
+
+	writer := &failingPathWriter{path: filepath.Join(filesDir, "file2.txt")}
+	application := NewApp(cfg, writer, repository.NewUserRepository(cfg.ValidTokens))
+	users := []types.User{
+		{Token: "valid_token_1", FileID: "file1"},
+		{Token: "valid_token_2", FileID: "file2"},
+	}
+	for _, user := range users {
+		if err := application.AddUser(user); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+
+	application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data"})
+	time.Sleep(200 * time.Millisecond)
+	application.SendMsg(types.Message{Token: "valid_token_2", FileID: "file2", Data: "lost"})
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	<-done
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	expected := []any{
+		events.UserAdded{User: users[0]},
+		events.UserAdded{User: users[1]},
+		// без TrackSequences номера и смещения батча не ведутся
+		events.BatchFlushed{FileID: "file1", Messages: 1, Attempts: 1},
+		events.WriteRetried{FileID: "file2", Attempt: 2},
+		events.WriteFailed{FileID: "file2", Messages: 1, Attempts: 2},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ожидались события %v, получено %v", expected, got)
+	}
+}
+
+// Проверяет, что номера сообщений продолжаются после перезапуска, а смещения
+// батча соответствуют его положению в файле.
+func TestBatchRangeSurvivesRestart(t *testing.T) {
+	var mutex sync.Mutex
+	var got []events.BatchFlushed
+	defer events.Subscribe(events.Default, func(e events.BatchFlushed) {
+		mutex.Lock()
+		got = append(got, e)
+		mutex.Unlock()
+	})()
+
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 50 * time.Millisecond
+	cfg.StateDir = t.TempDir()
+	// данные, записанные до запуска, сдвигают смещения, но не номера
+	if err := os.WriteFile(filepath.Join(filesDir, "file1.txt"), []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(data ...string) {
+		application := NewApp(cfg, &types.DefaultFileWriter{}, repository.NewUserRepository(cfg.ValidTokens))
+		application.TrackSequences()
+		if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			application.Start(ctx)
+			close(done)
+		}()
+		for _, d := range data {
+			application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: d})
+		}
+		time.Sleep(200 * time.Millisecond)
+		cancel()
+		<-done
+	}
+	run("data1", "data2")
+	run("data3")
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	expected := []events.BatchFlushed{
+		{FileID: "file1", Messages: 2, Attempts: 1, FirstSeq: 1, LastSeq: 2, ByteStart: 4, ByteEnd: 16},
+		{FileID: "file1", Messages: 1, Attempts: 1, FirstSeq: 3, LastSeq: 3, ByteStart: 16, ByteEnd: 22},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ожидались события %+v, получено %+v", expected, got)
+	}
+	// служебные файлы не попадают в каталог файлов
+	if entries, err := os.ReadDir(filesDir); err != nil || len(entries) != 1 || entries[0].Name() != "file1.txt" {
+		t.Errorf("в каталоге файлов ожидался только file1.txt, получено %v (%v)", entries, err)
+	}
+}
+
+// Проверяет сохранение батча, не записанного после всех попыток, в dead
+// letter и его возврат в конвейер.
+func TestDeadLetterReplay(t *testing.T) {
+	var mutex sync.Mutex
+	var deadLettered []events.BatchDeadLettered
+	defer events.Subscribe(events.Default, func(e events.BatchDeadLettered) {
+		mutex.Lock()
+		deadLettered = append(deadLettered, events.BatchDeadLettered{FileID: e.FileID, Messages: e.Messages, Attempts: e.Attempts})
+		mutex.Unlock()
+	})()
+
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 50 * time.Millisecond
+	cfg.MaxRetries = 2
+	cfg.RetryInterval = 10 * time.Millisecond
+	cfg.StateDir = t.TempDir()
+	cfg.FileQuotaHard = 1 << 20
+	writer := &flakyPathWriter{path: filepath.Join(filesDir, "file1.txt"), fails: 2}
+	application := NewApp(cfg, writer, repository.NewUserRepository(cfg.ValidTokens))
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data0"})
+	application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data1"})
+	time.Sleep(300 * time.Millisecond)
+
+	mutex.Lock()
+	got := deadLettered
+	mutex.Unlock()
+	if expected := []events.BatchDeadLettered{{FileID: "file1", Messages: 2, Attempts: 2}}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ожидались события %+v, получено %+v", expected, got)
+	}
+	if files, err := application.DeadLetters(); err != nil || !reflect.DeepEqual(files, map[string]int{"file1": 2}) {
+		t.Fatalf("ожидались 2 сообщения file1 в dead letter, получено %v (%v)", files, err)
+	}
+	if usage := application.FileUsage()["file1"]; usage.Pending != 0 {
+		t.Errorf("сообщения в dead letter не должны занимать квоту файла: %+v", usage)
+	}
+
+	if _, err := application.ReplayDeadLetters("file2"); !errors.Is(err, ErrUnknownFile) {
+		t.Errorf("ожидалась ошибка %v, получено %v", ErrUnknownFile, err)
+	}
+	if n, err := application.ReplayDeadLetters("file1"); err != nil || n != 2 {
+		t.Fatalf("ожидалось 2 возвращенных сообщения, получено %d (%v)", n, err)
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	if data, err := os.ReadFile(filepath.Join(filesDir, "file1.txt")); err != nil || string(data) != "data0\ndata1\n" {
+		t.Fatalf("ожидались возвращенные сообщения в файле, получено %q (%v)", data, err)
+	}
+	if usage := application.FileUsage()["file1"]; usage.Pending != 0 || usage.Written != 12 {
+		t.Errorf("возвращенные сообщения должны быть учтены в квоте файла: %+v", usage)
+	}
+	if files, err := application.DeadLetters(); err != nil || len(files) != 0 {
+		t.Errorf("хранилище dead letter должно быть пустым, получено %v (%v)", files, err)
+	}
+}
+
+// Проверяет, что подписчик на добавление пользователя может обращаться к приложению.
+func TestUserAddedSubscriberCallsApp(t *testing.T) {
+	cfg := setupConfig(t.TempDir())
+	application := NewApp(cfg, &types.DefaultFileWriter{}, repository.NewUserRepository(cfg.ValidTokens))
+
+	var files []TenantStatus
+	unsubscribe := events.Subscribe(events.Default, func(e events.UserAdded) {
+		files = application.Tenants()
+	})
+	defer unsubscribe()
+
+	added := make(chan error, 1)
+	go func() {
+		added <- application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"})
+	}()
+	select {
+	case err := <-added:
+		if err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("добавление пользователя заблокировано подписчиком")
+	}
+
+	if len(files) != 1 || !reflect.DeepEqual(files[0].Files, []string{"file1"}) {
+		t.Errorf("подписчик должен видеть канал нового файла, получено %+v", files)
+	}
+}
+
+// Проверяет жесткую квоту файла и сохранение учета между перезапусками.
+func TestStorageQuota(t *testing.T) {
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 50 * time.Millisecond
+	cfg.FileQuotaHard = 20
+	cfg.UsageFile = filepath.Join(filesDir, "usage.json")
+
+	application := NewApp(cfg, &types.DefaultFileWriter{}, repository.NewUserRepository(cfg.ValidTokens))
+	if err := application.AddUser(types.User{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+
+	// каждое сообщение занимает 6 байт вместе с переводом строки
+	for i := 0; i < 4; i++ {
+		err := application.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: fmt.Sprintf("data%d", i)})
+		if i < 3 && err != nil {
+			t.Fatalf("сообщение %d в пределах квоты отклонено: %v", i, err)
+		}
+		if i == 3 && !errors.Is(err, quota.ErrExceeded) {
+			t.Fatalf("Ожидалась ошибка %v, получено: %v", quota.ErrExceeded, err)
+		}
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if usage := application.Usage("valid_token_1", "file1"); usage.File.Written != 18 || usage.User.Written != 18 {
+		t.Fatalf("неверный учет объема: %+v", usage)
+	}
+
+	cancel()
+	<-done
+
+	// после перезапуска учет загружается из файла и квота продолжает действовать
+	restarted := NewApp(cfg, &types.DefaultFileWriter{}, repository.NewUserRepository(cfg.ValidTokens))
+	if usage := restarted.Usage("valid_token_1", "file1"); usage.File.Written != 18 {
+		t.Fatalf("учет не сохранился между перезапусками: %+v", usage)
+	}
+	if err := restarted.SendMsg(types.Message{Token: "valid_token_1", FileID: "file1", Data: "data3"}); !errors.Is(err, quota.ErrExceeded) {
+		t.Fatalf("Ожидалась ошибка %v после перезапуска, получено: %v", quota.ErrExceeded, err)
+	}
+}
+
+// Проверяет, что учет объема совпадает с данными на диске: записанный объем
+// считается по отформатированным строкам, а сегменты, удаленные правилами
+// хранения, снимаются с учета файла и его пользователей.
+func TestUsageFollowsDisk(t *testing.T) {
+	filesDir := t.TempDir()
+	cfg := setupConfig(filesDir)
+	cfg.WorkerInterval = 50 * time.Millisecond
+	cfg.Tenants = map[string]config.TenantConfig{"acme": {Format: FormatJSON}}
+	cfg.RetentionMaxAge = time.Hour
+	application := NewApp(cfg, &types.DefaultFileWriter{}, repository.NewUserRepository(cfg.ValidTokens))
+	for _, token := range []string{"valid_token_1", "valid_token_2"} {
+		if err := application.AddUser(types.User{Token: token, FileID: "file1", Tenant: "acme"}); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	send := func(token, data string) {
+		if err := application.SendMsg(types.Message{Token: token, FileID: "acme/file1", Data: data}); err != nil {
+			t.Fatalf("сообщение не принято: %v", err)
+		}
+	}
+	path := filepath.Join(filesDir, "acme", "file1.txt")
+	fileSize := func(path string) int64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+	usage := func() (file, users int64) {
+		u1 := application.Usage("valid_token_1", "acme/file1")
+		u2 := application.Usage("valid_token_2", "acme/file1")
+		return u1.File.Written, u1.User.Written + u2.User.Written
+	}
+
+	send("valid_token_1", "data1")
+	send("valid_token_2", "data2")
+	time.Sleep(300 * time.Millisecond)
+	if file, users := usage(); file != fileSize(path) || users != file {
+		t.Fatalf("учет (файл %d, пользователи %d) не совпадает с размером файла %d", file, users, fileSize(path))
+	}
+
+	// сегмент, оставшийся после ротации, выходит за срок хранения
+	segment := filepath.Join(filesDir, "acme", "file1.2026-10-01.txt")
+	if err := os.Rename(path, segment); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(segment, old, old); err != nil {
+		t.Fatal(err)
+	}
+	send("valid_token_1", "data3")
+	time.Sleep(300 * time.Millisecond)
+
+	application.enforceRetention()
+	if _, err := os.Stat(segment); !os.IsNotExist(err) {
+		t.Fatalf("сегмент не удален: %v", err)
+	}
+	// с пользователей объем снимается пропорционально, с округлением вниз
+	if file, users := usage(); file != fileSize(path) || users < file || users > file+2 {
+		t.Fatalf("после удаления сегмента учет (файл %d, пользователи %d) не совпадает с размером файла %d", file, users, fileSize(path))
+	}
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+const fileChCapacity = 1000
+
+// filePool - канал файла и обслуживающие его обработчики кеширования.
+type filePool struct {
+	ch      chan types.Message
+	workers int
+}
+
+func (a *App) minFileWorkers() int {
+	if a.cfg.MinFileWorkers <= 0 {
+		return 1
+	}
+	return a.cfg.MinFileWorkers
+}
+
+// startFileWorkerLocked запускает обработчик канала файла.
+// Вызывающий должен удерживать a.mutex, приложение должно быть запущено.
+func (a *App) startFileWorkerLocked(fileID string, pool *filePool) {
+	pool.workers++
+	a.wg.Add(1)
+	go a.writeMsgsToCache(a.ctx, fileID, pool)
+}
+
+func (a *App) runningLocked() bool {
+	return a.ctx != nil && a.ctx.Err() == nil
+}
+
+// scaleUp добавляет обработчик файлу, если не достигнут предел MaxFileWorkers.
+func (a *App) scaleUp(fileID string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	pool, exists := a.pools[fileID]
+	if !exists || !a.runningLocked() {
+		return false
+	}
+	if a.cfg.MaxFileWorkers > 0 && pool.workers >= a.cfg.MaxFileWorkers {
+		return false
+	}
+
+	a.startFileWorkerLocked(fileID, pool)
+	slog.Info("добавлен обработчик файла", logger.KeyFileID, fileID, "workers", pool.workers)
+	return true
+}
+
+// retire завершает простаивающий обработчик, если их больше MinFileWorkers.
+func (a *App) retire(fileID string, pool *filePool) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if pool.workers <= a.minFileWorkers() {
+		return false
+	}
+
+	pool.workers--
+	slog.Info("остановлен простаивающий обработчик файла", logger.KeyFileID, fileID, "workers", pool.workers)
+	return true
+}
+
+// autoscale периодически проверяет заполненность каналов файлов
+// и добавляет обработчики тем файлам, которые не успевают разбирать канал.
+func (a *App) autoscale(ctx context.Context) {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.cfg.ScaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, fileID := range a.backloggedFiles() {
+				a.scaleUp(fileID)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *App) backloggedFiles() []string {
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	threshold := a.cfg.ScaleUpThreshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = 1
+	}
+
+	var fileIDs []string
+	for fileID, pool := range a.pools {
+		if float64(len(pool.ch)) >= threshold*float64(cap(pool.ch)) {
+			fileIDs = append(fileIDs, fileID)
+		}
+	}
+	return fileIDs
+}
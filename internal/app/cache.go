@@ -0,0 +1,149 @@
+package app
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+const defaultCacheShards = 16
+
+// fileBatch - накопленные в кеше сообщения одного файла
+type fileBatch struct {
+	messages []types.Message
+	bytes    int
+	oldest   time.Time
+}
+
+type cacheShard struct {
+	mutex sync.Mutex
+	files map[string]*fileBatch
+}
+
+// shardedCache - кеш сообщений, разбитый на шарды по fileID,
+// чтобы запись в разные файлы не конкурировала за одну блокировку.
+type shardedCache struct {
+	shards []*cacheShard
+}
+
+func newShardedCache(numShards int) *shardedCache {
+	if numShards <= 0 {
+		numShards = defaultCacheShards
+	}
+
+	shards := make([]*cacheShard, numShards)
+	for i := range shards {
+		shards[i] = &cacheShard{files: make(map[string]*fileBatch)}
+	}
+
+	return &shardedCache{shards: shards}
+}
+
+func (c *shardedCache) shard(fileID string) *cacheShard {
+	h := fnv.New32a()
+	h.Write([]byte(fileID))
+	return c.shards[h.Sum32()%uint32(len(c.shards))]
+}
+
+// add добавляет сообщение в батч файла. Если после добавления isFull
+// сообщает о переполнении, батч сразу забирается и передается в flush.
+// flush вызывается под блокировкой шарда, как и в takeAll, поэтому батчи
+// одного файла передаются дальше в том порядке, в котором забраны.
+func (c *shardedCache) add(msg types.Message, isFull func(*fileBatch) bool, flush func([]types.Message)) {
+	s := c.shard(msg.FileID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	batch, exists := s.files[msg.FileID]
+	if !exists {
+		batch = &fileBatch{}
+		s.files[msg.FileID] = batch
+	}
+	if len(batch.messages) == 0 {
+		batch.oldest = time.Now()
+	}
+	batch.messages = append(batch.messages, msg)
+	batch.bytes += len(msg.Data)
+
+	if isFull(batch) {
+		flush(batch.take())
+	}
+}
+
+// take забирает сообщения одного файла.
+func (c *shardedCache) take(fileID string) []types.Message {
+	s := c.shard(fileID)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	batch, exists := s.files[fileID]
+	if !exists {
+		return nil
+	}
+	return batch.take()
+}
+
+// takeAll забирает сообщения всех файлов, для которых filter вернул true, и
+// передает их в fn под блокировкой шарда. Шарды блокируются по очереди, а не все сразу.
+func (c *shardedCache) takeAll(filter func(fileID string, batch *fileBatch) bool, fn func(fileID string, messages []types.Message)) {
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		for fileID, batch := range s.files {
+			if len(batch.messages) == 0 || (filter != nil && !filter(fileID, batch)) {
+				continue
+			}
+			fn(fileID, batch.take())
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// peek возвращает копию сообщений, ожидающих записи, по файлам
+// (всем, если fileID пустой), не забирая их из кеша.
+func (c *shardedCache) peek(fileID string) map[string][]types.Message {
+	result := make(map[string][]types.Message)
+	shards := c.shards
+	if fileID != "" {
+		shards = []*cacheShard{c.shard(fileID)}
+	}
+
+	for _, s := range shards {
+		s.mutex.Lock()
+		for id, batch := range s.files {
+			if len(batch.messages) == 0 || (fileID != "" && id != fileID) {
+				continue
+			}
+			result[id] = append([]types.Message{}, batch.messages...)
+		}
+		s.mutex.Unlock()
+	}
+	return result
+}
+
+// take забирает сообщения целиком, новые будут накапливаться в новом слайсе.
+func (b *fileBatch) take() []types.Message {
+	messages := b.messages
+	b.messages = nil
+	b.bytes = 0
+	return messages
+}
+
+type batchSize struct {
+	messages int
+	bytes    int
+}
+
+// sizes возвращает размер кеша по файлам, не забирая сообщения.
+func (c *shardedCache) sizes() map[string]batchSize {
+	result := make(map[string]batchSize)
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		for fileID, batch := range s.files {
+			result[fileID] = batchSize{messages: len(batch.messages), bytes: batch.bytes}
+		}
+		s.mutex.Unlock()
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"log/slog"
+	"path/filepath"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/events"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+// stateDir возвращает подкаталог name служебных файлов или пустую строку,
+// если StateDir не задан.
+func stateDir(cfg *config.Config, name string) string {
+	if cfg.StateDir == "" {
+		return ""
+	}
+	return filepath.Join(cfg.StateDir, name)
+}
+
+// deadLetter сохраняет батч, не записанный после всех попыток, в хранилище
+// dead letter. Без StateDir сообщения батча отбрасываются.
+func (a *App) deadLetter(fileID string, messages []types.Message, attempts int, err error) {
+	if a.deadLetters == nil {
+		return
+	}
+	if putErr := a.deadLetters.Put(fileID, messages); putErr != nil {
+		slog.Error("не удалось сохранить батч в dead letter, сообщения потеряны",
+			logger.KeyFileID, fileID, "messages", len(messages), logger.KeyError, putErr)
+		return
+	}
+
+	slog.Warn("батч сохранен в dead letter", logger.KeyFileID, fileID, "messages", len(messages))
+	events.Default.Publish(events.BatchDeadLettered{FileID: fileID, Messages: len(messages), Attempts: attempts, Err: err})
+}
+
+// DeadLetters возвращает количество сообщений в хранилище dead letter по файлам.
+func (a *App) DeadLetters() (map[string]int, error) {
+	return a.deadLetters.Files()
+}
+
+// ReplayDeadLetters возвращает в конвейер сообщения файла из хранилища dead
+// letter. Сообщения уже прошли маршрутизацию, поэтому ставятся в очередь без
+// нее и снова учитываются в квотах; не принятые квотой остаются в хранилище.
+// Возвращает количество возвращенных сообщений.
+func (a *App) ReplayDeadLetters(fileID string) (int, error) {
+	if !a.fileExists(fileID) {
+		return 0, ErrUnknownFile
+	}
+
+	a.intakeMu.RLock()
+	defer a.intakeMu.RUnlock()
+	if a.closing {
+		return 0, ErrShuttingDown
+	}
+
+	messages, err := a.deadLetters.Take(fileID)
+	if err != nil {
+		return 0, err
+	}
+	for i, msg := range messages {
+		if err := a.reserveUsage(msg); err != nil {
+			if putErr := a.deadLetters.Put(fileID, messages[i:]); putErr != nil {
+				slog.Error("не удалось вернуть сообщения в dead letter, сообщения потеряны",
+					logger.KeyFileID, fileID, "messages", len(messages)-i, logger.KeyError, putErr)
+			}
+			return i, err
+		}
+		a.queue <- msg
+	}
+
+	slog.Info("сообщения возвращены из dead letter", logger.KeyFileID, fileID, "messages", len(messages))
+	return len(messages), nil
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"github.com/asb1302/innopolis_go_assesment_1/internal/events"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/metrics"
+)
+
+var (
+	queueDepth = metrics.Default.NewGaugeVec(
+		"app_queue_depth", "Количество сообщений в общей очереди")
+	fileChannelDepth = metrics.Default.NewGaugeVec(
+		"app_file_channel_depth", "Количество сообщений в канале файла", "file_id")
+	fileWorkers = metrics.Default.NewGaugeVec(
+		"app_file_workers", "Количество обработчиков канала файла", "file_id")
+	cacheMessages = metrics.Default.NewGaugeVec(
+		"app_cache_messages", "Количество сообщений в кеше файла", "file_id")
+	cacheBytes = metrics.Default.NewGaugeVec(
+		"app_cache_bytes", "Объем данных в кеше файла", "file_id")
+	flushDuration = metrics.Default.NewHistogramVec(
+		"app_flush_duration_seconds", "Длительность прохода по кешу", metrics.DefaultBuckets)
+	writeDuration = metrics.Default.NewHistogramVec(
+		"app_write_duration_seconds", "Длительность записи батча в файл, включая повторы", metrics.DefaultBuckets, "file_id")
+	writeRetries = metrics.Default.NewCounterVec(
+		"app_write_retries_total", "Количество повторных попыток записи в файл", "file_id")
+	writeFailures = metrics.Default.NewCounterVec(
+		"app_write_failures_total", "Количество батчей, которые не удалось записать после всех попыток", "file_id")
+	circuitOpen = metrics.Default.NewGaugeVec(
+		"app_circuit_open", "Запись в файл приостановлена после серии ошибок (1 - приостановлена)", "file_id")
+	messagesWritten = metrics.Default.NewCounterVec(
+		"app_messages_written_total", "Количество сообщений, записанных в файл", "file_id")
+)
+
+func init() {
+	// результаты записи учитываются по событиям, как и у остальных подписчиков
+	events.Subscribe(events.Default, func(e events.WriteRetried) {
+		writeRetries.Inc(e.FileID)
+	})
+	events.Subscribe(events.Default, func(e events.WriteFailed) {
+		writeFailures.Inc(e.FileID)
+	})
+	events.Subscribe(events.Default, func(e events.BatchFlushed) {
+		messagesWritten.Add(float64(e.Messages), e.FileID)
+	})
+}
+
+// RegisterMetrics подключает снятие показателей приложения при каждой выгрузке метрик.
+func (a *App) RegisterMetrics(reg *metrics.Registry) {
+	reg.OnScrape(a.collectMetrics)
+}
+
+func (a *App) collectMetrics() {
+	queueDepth.Set(float64(len(a.queue)))
+
+	fileChannelDepth.Reset()
+	fileWorkers.Reset()
+	a.mutex.RLock()
+	for fileID, pool := range a.pools {
+		fileChannelDepth.Add(float64(len(pool.ch)), fileID)
+		fileWorkers.Add(float64(pool.workers), fileID)
+	}
+	a.mutex.RUnlock()
+
+	circuitOpen.Reset()
+	for _, fileID := range a.openCircuits() {
+		circuitOpen.Add(1, fileID)
+	}
+
+	cacheMessages.Reset()
+	cacheBytes.Reset()
+	for fileID, size := range a.cache.sizes() {
+		cacheMessages.Add(float64(size.messages), fileID)
+		cacheBytes.Add(float64(size.bytes), fileID)
+	}
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/quota"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+// UsageReport - объем данных файла и пользователя относительно их квот.
+type UsageReport struct {
+	File quota.Usage `json:"file"`
+	User quota.Usage `json:"user"`
+}
+
+func loadUsage(path string) *quota.Store {
+	if path == "" {
+		return quota.NewStore()
+	}
+	store, err := quota.Load(path)
+	if err != nil {
+		slog.Error("не удалось загрузить учет объема данных, учет начат заново", "path", path, logger.KeyError, err)
+		return quota.NewStore()
+	}
+	return store
+}
+
+func fileUsageKey(fileID string) string {
+	return "file:" + fileID
+}
+
+// userUsageKey - ключ учета пользователя. Токен хешируется, чтобы не хранить его в файле учета.
+func userUsageKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "user:" + hex.EncodeToString(sum[:8])
+}
+
+// shareUsageKey - ключ учета данных пользователя с ключом userKey в файле fileID.
+// По нему объем, удаленный из файла, снимается и с учета пользователя.
+func shareUsageKey(fileID, userKey string) string {
+	return "share:" + fileID + "|" + userKey
+}
+
+func (a *App) fileQuota() quota.Limit {
+	return quota.Limit{Soft: a.cfg.FileQuotaSoft, Hard: a.cfg.FileQuotaHard}
+}
+
+func (a *App) userQuota() quota.Limit {
+	return quota.Limit{Soft: a.cfg.UserQuotaSoft, Hard: a.cfg.UserQuotaHard}
+}
+
+func messageSize(msg types.Message) int64 {
+	return int64(len(msg.Data)) + 1
+}
+
+// reserveUsage учитывает принимаемое сообщение в квотах файла и пользователя.
+func (a *App) reserveUsage(msg types.Message) error {
+	overSoft, err := a.usage.Reserve(messageSize(msg),
+		quota.Request{Key: fileUsageKey(msg.FileID), Limit: a.fileQuota()},
+		quota.Request{Key: userUsageKey(msg.Token), Limit: a.userQuota()},
+	)
+	if err != nil {
+		return err
+	}
+	if overSoft {
+		slog.Warn("превышена мягкая квота на объем данных", logger.KeyFileID, msg.FileID, logger.KeyToken, msg.Token)
+	}
+	return nil
+}
+
+// releaseUsage снимает с учета принятые сообщения, которые не будут записаны.
+func (a *App) releaseUsage(fileID string, messages []types.Message) {
+	var total int64
+	byUser := make(map[string]int64)
+	for _, msg := range messages {
+		total += messageSize(msg)
+		byUser[msg.Token] += messageSize(msg)
+	}
+
+	a.usage.Release(fileUsageKey(fileID), total)
+	for token, n := range byUser {
+		a.usage.Release(userUsageKey(token), n)
+	}
+}
+
+// commitUsage учитывает записанные сообщения по объему их строк в файле:
+// lines[i] - сообщение messages[i] после форматирования.
+func (a *App) commitUsage(fileID string, messages, lines []types.Message) {
+	type userUsage struct {
+		reserved int64
+		written  int64
+	}
+	var reserved, written int64
+	byUser := make(map[string]userUsage)
+	for i, msg := range messages {
+		u := byUser[msg.Token]
+		u.reserved += messageSize(msg)
+		u.written += messageSize(lines[i])
+		byUser[msg.Token] = u
+		reserved += messageSize(msg)
+		written += messageSize(lines[i])
+	}
+
+	a.usage.Commit(fileUsageKey(fileID), reserved, written)
+	for token, u := range byUser {
+		userKey := userUsageKey(token)
+		a.usage.Commit(userKey, u.reserved, u.written)
+		a.usage.Commit(shareUsageKey(fileID, userKey), 0, u.written)
+	}
+}
+
+// removeUsage снимает с учета n байт, удаленных с диска из файла fileID.
+// Чьи именно данные удалены, неизвестно, поэтому объем снимается с
+// пользователей файла пропорционально их доле в нем.
+func (a *App) removeUsage(fileID string, n int64) {
+	fileKey := fileUsageKey(fileID)
+	written := a.usage.Usage(fileKey, quota.Limit{}).Written
+	if written <= 0 || n <= 0 {
+		return
+	}
+	n = min(n, written)
+	a.usage.Remove(fileKey, n)
+
+	prefix := shareUsageKey(fileID, "")
+	for _, key := range a.usage.Keys() {
+		userKey, isShare := strings.CutPrefix(key, prefix)
+		if !isShare {
+			continue
+		}
+		share := a.usage.Usage(key, quota.Limit{}).Written
+		removed := share
+		if n < written {
+			removed = int64(float64(share) * float64(n) / float64(written))
+		}
+		a.usage.Remove(key, removed)
+		a.usage.Remove(userKey, removed)
+	}
+}
+
+// Usage возвращает объем данных файла и пользователя с токеном token.
+func (a *App) Usage(token, fileID string) UsageReport {
+	return UsageReport{
+		File: a.usage.Usage(fileUsageKey(fileID), a.fileQuota()),
+		User: a.usage.Usage(userUsageKey(token), a.userQuota()),
+	}
+}
+
+// FileUsage возвращает объем данных всех файлов.
+func (a *App) FileUsage() map[string]quota.Usage {
+	result := make(map[string]quota.Usage)
+	for _, key := range a.usage.Keys() {
+		if fileID, isFile := strings.CutPrefix(key, "file:"); isFile {
+			result[fileID] = a.usage.Usage(key, a.fileQuota())
+		}
+	}
+	return result
+}
+
+// ResetUsage обнуляет записанный объем файла, например после удаления его
+// сегментов оператором. Объем снимается и с учета пользователей файла.
+func (a *App) ResetUsage(fileID string) error {
+	if !a.fileExists(fileID) {
+		return ErrUnknownFile
+	}
+	a.removeUsage(fileID, a.usage.Usage(fileUsageKey(fileID), quota.Limit{}).Written)
+	slog.Info("учет объема файла обнулен", logger.KeyFileID, fileID)
+	return nil
+}
+
+func (a *App) saveUsage() {
+	if a.cfg.UsageFile == "" {
+		return
+	}
+	if err := a.usage.Save(a.cfg.UsageFile); err != nil {
+		slog.Error("не удалось сохранить учет объема данных", "path", a.cfg.UsageFile, logger.KeyError, err)
+	}
+}
+
+// usageSaver периодически сохраняет учет объема, чтобы он пережил аварийный перезапуск.
+func (a *App) usageSaver(ctx context.Context) {
+	defer a.flushWg.Done()
+	ticker := time.NewTicker(a.cfg.UsageSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.saveUsage()
+		case <-ctx.Done():
+			// финальное сохранение выполняет shutdown после завершения записи
+			return
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/storage"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+func (a *App) retention() storage.Retention {
+	return storage.Retention{
+		MaxSegments:   a.cfg.RetentionMaxSegments,
+		MaxAge:        a.cfg.RetentionMaxAge,
+		MaxTotalBytes: a.cfg.RetentionMaxTotalBytes,
+	}
+}
+
+func (a *App) retentionEnabled() bool {
+	if a.retention().Enabled() {
+		return true
+	}
+	for tenant := range a.cfg.Tenants {
+		if a.tenantRetention(tenant).Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// janitor периодически удаляет ротированные сегменты файлов,
+// вышедшие за правила хранения.
+func (a *App) janitor(ctx context.Context) {
+	defer a.flushWg.Done()
+	ticker := time.NewTicker(a.cfg.RetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			a.enforceRetention()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *App) enforceRetention() {
+	now := time.Now()
+	a.enforceDirRetention("", a.retention(), now)
+
+	// у тенантов могут быть свои правила хранения
+	for _, tenant := range a.tenantDirs() {
+		a.enforceDirRetention(tenant, a.tenantRetention(tenant), now)
+	}
+}
+
+// enforceDirRetention удаляет сегменты в каталоге тенанта (пустой - корень
+// каталога файлов) и снимает их данные с учета объема.
+func (a *App) enforceDirRetention(tenant string, retention storage.Retention, now time.Time) {
+	if !retention.Enabled() {
+		return
+	}
+
+	dir := filepath.Join(a.cfg.FilesDir, tenant)
+	removed, err := storage.EnforceRetention(dir, retention, now)
+	if err != nil {
+		slog.Error("ошибка при удалении старых сегментов", "dir", dir, logger.KeyError, err)
+	}
+	if len(removed) == 0 {
+		return
+	}
+
+	paths := make([]string, len(removed))
+	for i, seg := range removed {
+		paths[i] = seg.Path
+		a.removeUsage(types.FileKey(tenant, seg.FileID), seg.DataSize)
+	}
+	slog.Info("удалены старые сегменты файлов", "count", len(removed), "segments", paths)
+}
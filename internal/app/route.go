@@ -0,0 +1,94 @@
+package app
+
+import (
+	"log/slog"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/metrics"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/route"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+var messagesRouted = metrics.Default.NewCounterVec(
+	"app_messages_routed_total", "Количество копий сообщений в файлах назначения правил маршрутизации", "file_id", "result")
+
+// SetRouter задает правила маршрутизации. Вызывается до Start.
+func (a *App) SetRouter(r *route.Router) {
+	a.router = r
+}
+
+// fanOut возвращает копии сообщения для всех файлов назначения и учитывает
+// каждую в квотах файла назначения и пользователя: копия занимает место на
+// диске так же, как сообщение, отправленное в файл напрямую. Ошибка исходного
+// файла отклоняет сообщение целиком, копии в остальные файлы, не прошедшие
+// квоту, пропускаются, чтобы файл назначения не мешал приему в исходный файл.
+// Сообщение, перенесенное правилами, отклоняется, только если не принят ни
+// один файл назначения.
+func (a *App) fanOut(msg types.Message) ([]types.Message, error) {
+	dests := a.router.Route(msg.FileID, msg.Data)
+	copies := make([]types.Message, 0, len(dests))
+	var firstErr error
+
+	for _, dest := range dests {
+		c := msg
+		c.FileID = dest
+		isSource := dest == msg.FileID
+
+		if !isSource {
+			if err := a.ensurePool(dest); err != nil {
+				slog.Warn("копия сообщения не создана", logger.KeyFileID, dest, logger.KeyMsgID, msg.ID, logger.KeyError, err)
+				messagesRouted.Inc(dest, "rejected")
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+		}
+
+		// исходный файл всегда первый, до него ничего не учтено
+		if err := a.reserveUsage(c); err != nil {
+			if isSource {
+				return nil, err
+			}
+			slog.Warn("копия сообщения не принята", logger.KeyFileID, dest, logger.KeyMsgID, msg.ID, logger.KeyError, err)
+			messagesRouted.Inc(dest, "rejected")
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		if !isSource {
+			messagesRouted.Inc(dest, "accepted")
+		}
+		copies = append(copies, c)
+	}
+
+	if len(copies) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return copies, nil
+}
+
+// ensurePool создает канал файла пользователя или файла назначения, если его
+// еще нет. Новый файл учитывается в квоте тенанта на количество файлов.
+func (a *App) ensurePool(key string) error {
+	a.mutex.RLock()
+	_, exists := a.pools[key]
+	a.mutex.RUnlock()
+	if exists {
+		return nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, exists := a.pools[key]; exists {
+		return nil
+	}
+	tenant, _ := types.SplitFileKey(key)
+	if err := a.checkTenantQuotaLocked(tenant); err != nil {
+		return err
+	}
+	a.addPoolLocked(key)
+	return nil
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+var ErrShuttingDown = errors.New("приложение завершает работу, сообщения не принимаются")
+
+// ShutdownReport - итог остановки приложения.
+type ShutdownReport struct {
+	// fileID -> количество сообщений, которые так и не были записаны в файл
+	Unflushed map[string]int
+	// остановка не уложилась в ShutdownTimeout
+	TimedOut bool
+}
+
+func (r ShutdownReport) Total() int {
+	total := 0
+	for _, n := range r.Unflushed {
+		total += n
+	}
+	return total
+}
+
+// stages - функции остановки отдельных ступеней конвейера.
+type stages struct {
+	stopQueue   context.CancelFunc
+	stopWorkers context.CancelFunc
+	stopFlusher context.CancelFunc
+}
+
+// shutdown останавливает конвейер по порядку: прием -> очередь -> каналы файлов ->
+// финальный сброс кеша -> ожидание записи. Каждая ступень дожидается, пока
+// предыдущая передаст ей все сообщения, но не дольше ShutdownTimeout в сумме.
+func (a *App) shutdown(s stages) ShutdownReport {
+	var deadline time.Time
+	if a.cfg.ShutdownTimeout > 0 {
+		deadline = time.Now().Add(a.cfg.ShutdownTimeout)
+	}
+
+	a.intakeMu.Lock()
+	a.closing = true
+	a.intakeMu.Unlock()
+	slog.Info("остановка: прием сообщений прекращен")
+
+	s.stopQueue()
+	timedOut := !waitUntil(&a.queueWg, deadline)
+	slog.Info("остановка: очередь разобрана")
+
+	// отмена под блокировкой, чтобы автомасштабирование не запустило новый обработчик
+	a.mutex.Lock()
+	s.stopWorkers()
+	a.mutex.Unlock()
+	timedOut = !waitUntil(&a.wg, deadline) || timedOut
+	slog.Info("остановка: каналы файлов разобраны")
+
+	s.stopFlusher()
+	a.flushWg.Wait()
+	// при остановке пишем все, включая приостановленные файлы, иначе данные будут потеряны
+	a.flushCache(nil)
+	timedOut = !waitUntil(&a.writeWg, deadline) || timedOut
+	slog.Info("остановка: запись в файлы завершена")
+	a.saveUsage()
+
+	report := ShutdownReport{Unflushed: a.unflushed(), TimedOut: timedOut}
+	if total := report.Total(); total > 0 {
+		slog.Error("остановка: не все сообщения записаны", "unflushed", total, "by_file", report.Unflushed, "timed_out", timedOut)
+	}
+
+	return report
+}
+
+// unflushed подсчитывает сообщения, оставшиеся в очереди, каналах и кеше,
+// а также находящиеся в незавершенной или неудавшейся записи.
+func (a *App) unflushed() map[string]int {
+	result := make(map[string]int)
+
+	for drained := false; !drained; {
+		select {
+		case msg := <-a.queue:
+			result[msg.FileID]++
+		default:
+			drained = true
+		}
+	}
+
+	a.mutex.RLock()
+	for fileID, pool := range a.pools {
+		if n := len(pool.ch); n > 0 {
+			result[fileID] += n
+		}
+	}
+	a.mutex.RUnlock()
+
+	a.cache.takeAll(nil, func(fileID string, messages []types.Message) {
+		result[fileID] += len(messages)
+	})
+
+	a.statsMu.Lock()
+	for fileID, st := range a.stats {
+		if n := st.inflight + st.failed; n > 0 {
+			result[fileID] += n
+		}
+	}
+	a.statsMu.Unlock()
+
+	return result
+}
+
+// writeCounter считает незавершенные записи батчей. В отличие от
+// sync.WaitGroup, Add можно вызывать одновременно с Wait: записи добавляются
+// из конвейера, пока ручной сброс или остановка ждут уже начатые. Wait
+// возвращается, когда незавершенных записей не остается.
+type writeCounter struct {
+	mutex sync.Mutex
+	cond  sync.Cond
+	n     int
+}
+
+func (c *writeCounter) lock() {
+	c.mutex.Lock()
+	if c.cond.L == nil {
+		c.cond.L = &c.mutex
+	}
+}
+
+func (c *writeCounter) Add(n int) {
+	c.lock()
+	defer c.mutex.Unlock()
+	c.n += n
+	if c.n == 0 {
+		c.cond.Broadcast()
+	}
+}
+
+func (c *writeCounter) Done() {
+	c.Add(-1)
+}
+
+func (c *writeCounter) Wait() {
+	c.lock()
+	defer c.mutex.Unlock()
+	for c.n > 0 {
+		c.cond.Wait()
+	}
+}
+
+// waitUntil ожидает wg до дедлайна; нулевой дедлайн - ожидание без ограничения.
+func waitUntil(wg interface{ Wait() }, deadline time.Time) bool {
+	if deadline.IsZero() {
+		wg.Wait()
+		return true
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(time.Until(deadline)):
+		return false
+	}
+}
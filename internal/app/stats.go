@@ -0,0 +1,197 @@
+package app
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/events"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/storage"
+)
+
+// fileStats - счетчики и состояние записи одного файла.
+type fileStats struct {
+	inflight int // сообщения в незавершенной записи
+	failed   int // сообщения, которые не удалось записать после всех попыток
+
+	lastFlush   time.Time
+	lastErr     string
+	lastErrAt   time.Time
+	failStreak  int       // подряд неудавшиеся батчи
+	circuitOpen time.Time // до этого момента запись в файл не выполняется
+	paused      bool      // запись приостановлена оператором
+
+	// номер последнего записанного сообщения, сохраняемый в StateDir (см. writtenRange)
+	seq       int64
+	seqLoaded bool
+}
+
+// batchRange - номера сообщений и смещения записанного батча (см. events.BatchFlushed).
+type batchRange struct {
+	firstSeq  int64
+	lastSeq   int64
+	byteStart int64
+	byteEnd   int64
+}
+
+// statsLocked возвращает счетчики файла, создавая их при необходимости.
+// Вызывающий должен удерживать a.statsMu.
+func (a *App) statsLocked(fileID string) *fileStats {
+	st, exists := a.stats[fileID]
+	if !exists {
+		st = &fileStats{}
+		a.stats[fileID] = st
+	}
+	return st
+}
+
+func (a *App) writeStarted(fileID string, n int) {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+	a.statsLocked(fileID).inflight += n
+}
+
+// TrackSequences включает нумерацию записанных сообщений и расчет смещений
+// батчей для events.BatchFlushed. Вызывается до Start, если на события записи
+// подписаны webhook: без них номера не нужны, и запись батча обходится без
+// лишних обращений к диску.
+func (a *App) TrackSequences() {
+	a.sequences = true
+}
+
+// writtenRange возвращает диапазон только что записанного в filePath батча из
+// n сообщений размером size байт и сохраняет номер его последнего сообщения в
+// StateDir. Батчи файла пишутся по очереди (см. startWrite), поэтому размер
+// файла после записи - конец батча в нем. Вызывается только из очереди записи
+// файла. Без TrackSequences диапазон пустой.
+func (a *App) writtenRange(fileID, filePath string, n int, size int64) batchRange {
+	if !a.sequences {
+		return batchRange{}
+	}
+	dir := stateDir(a.cfg, "seq")
+
+	a.statsMu.Lock()
+	st := a.statsLocked(fileID)
+	seq, loaded := st.seq, st.seqLoaded
+	a.statsMu.Unlock()
+
+	if !loaded && dir != "" {
+		var err error
+		if seq, err = storage.LoadSequence(dir, fileID); err != nil {
+			slog.Error("не удалось загрузить номер сообщений файла, нумерация начата заново", logger.KeyFileID, fileID, logger.KeyError, err)
+		}
+	}
+	rng := batchRange{firstSeq: seq + 1, lastSeq: seq + int64(n), byteEnd: size}
+	if dir != "" {
+		if err := storage.SaveSequence(dir, fileID, rng.lastSeq); err != nil {
+			slog.Error("не удалось сохранить номер сообщений файла", logger.KeyFileID, fileID, logger.KeyError, err)
+		}
+	}
+
+	a.statsMu.Lock()
+	st.seq, st.seqLoaded = rng.lastSeq, true
+	a.statsMu.Unlock()
+
+	// если файл недоступен, смещения считаются от его начала
+	if info, err := os.Stat(filePath); err == nil {
+		rng.byteEnd = info.Size()
+	}
+	rng.byteStart = max(rng.byteEnd-size, 0)
+	return rng
+}
+
+// writeFinished учитывает результат записи батча из n сообщений с диапазоном
+// rng и публикует события о нем. События публикуются после снятия
+// блокировки, чтобы подписчики могли обращаться к приложению.
+func (a *App) writeFinished(fileID string, n, attempts int, rng batchRange, err error) {
+	var published []any
+	defer func() {
+		for _, event := range published {
+			events.Default.Publish(event)
+		}
+	}()
+
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	st := a.statsLocked(fileID)
+	st.inflight -= n
+	if err == nil {
+		st.lastFlush = time.Now()
+		st.failStreak = 0
+		st.circuitOpen = time.Time{}
+
+		published = append(published, events.BatchFlushed{
+			FileID:    fileID,
+			Messages:  n,
+			Attempts:  attempts,
+			FirstSeq:  rng.firstSeq,
+			LastSeq:   rng.lastSeq,
+			ByteStart: rng.byteStart,
+			ByteEnd:   rng.byteEnd,
+		})
+		return
+	}
+
+	st.failed += n
+	st.failStreak++
+	published = append(published, events.WriteFailed{FileID: fileID, Messages: n, Attempts: attempts, Err: err})
+
+	// после BreakerThreshold неудачных батчей подряд запись в файл приостанавливается,
+	// сообщения копятся в кеше до истечения BreakerCooldown
+	if a.cfg.BreakerThreshold > 0 && st.failStreak >= a.cfg.BreakerThreshold {
+		st.circuitOpen = time.Now().Add(a.cfg.BreakerCooldown)
+		slog.Error("запись в файл приостановлена после серии ошибок",
+			logger.KeyFileID, fileID, "failures", st.failStreak, "cooldown", a.cfg.BreakerCooldown)
+		published = append(published, events.CircuitOpened{
+			FileID:   fileID,
+			Failures: st.failStreak,
+			Until:    st.circuitOpen,
+			Err:      err,
+		})
+	}
+}
+
+// attemptFailed запоминает ошибку отдельной попытки записи.
+func (a *App) attemptFailed(fileID string, err error) {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	st := a.statsLocked(fileID)
+	st.lastErr = err.Error()
+	st.lastErrAt = time.Now()
+}
+
+// circuitAllows сообщает, можно ли сейчас писать в файл. По истечении паузы
+// разрешается пробная запись: при ошибке пауза сразу начинается заново.
+func (a *App) circuitAllows(fileID string) bool {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	st, exists := a.stats[fileID]
+	return !exists || !time.Now().Before(st.circuitOpen)
+}
+
+// openCircuits возвращает файлы, запись в которые сейчас приостановлена.
+func (a *App) openCircuits() []string {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	var fileIDs []string
+	now := time.Now()
+	for fileID, st := range a.stats {
+		if now.Before(st.circuitOpen) {
+			fileIDs = append(fileIDs, fileID)
+		}
+	}
+	return fileIDs
+}
+
+func (a *App) isPaused(fileID string) bool {
+	a.statsMu.Lock()
+	defer a.statsMu.Unlock()
+
+	st, exists := a.stats[fileID]
+	return exists && st.paused
+}
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// FileStatus - состояние обработки одного файла.
+type FileStatus struct {
+	FileID        string     `json:"file_id"`
+	Workers       int        `json:"workers"`
+	ChannelDepth  int        `json:"channel_depth"`
+	CacheMessages int        `json:"cache_messages"`
+	CacheBytes    int        `json:"cache_bytes"`
+	Failed        int        `json:"failed_messages"`
+	LastFlush     *time.Time `json:"last_flush,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	CircuitOpen   bool       `json:"circuit_open"`
+	Paused        bool       `json:"paused"`
+}
+
+type Status struct {
+	Running       bool         `json:"running"`
+	QueueDepth    int          `json:"queue_depth"`
+	QueueCapacity int          `json:"queue_capacity"`
+	Files         []FileStatus `json:"files"`
+}
+
+// Check - результат одной проверки готовности.
+type Check struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+func (a *App) running() bool {
+	a.intakeMu.RLock()
+	closing := a.closing
+	a.intakeMu.RUnlock()
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	return a.runningLocked() && !closing
+}
+
+func (a *App) Status() Status {
+	status := Status{
+		Running:       a.running(),
+		QueueDepth:    len(a.queue),
+		QueueCapacity: cap(a.queue),
+	}
+
+	files := make(map[string]*FileStatus)
+	get := func(fileID string) *FileStatus {
+		fs, exists := files[fileID]
+		if !exists {
+			fs = &FileStatus{FileID: fileID}
+			files[fileID] = fs
+		}
+		return fs
+	}
+
+	a.mutex.RLock()
+	for fileID, pool := range a.pools {
+		fs := get(fileID)
+		fs.Workers = pool.workers
+		fs.ChannelDepth = len(pool.ch)
+	}
+	a.mutex.RUnlock()
+
+	for fileID, size := range a.cache.sizes() {
+		fs := get(fileID)
+		fs.CacheMessages = size.messages
+		fs.CacheBytes = size.bytes
+	}
+
+	now := time.Now()
+	a.statsMu.Lock()
+	for fileID, st := range a.stats {
+		fs := get(fileID)
+		fs.Failed = st.failed
+		fs.LastError = st.lastErr
+		fs.CircuitOpen = now.Before(st.circuitOpen)
+		fs.Paused = st.paused
+		if !st.lastFlush.IsZero() {
+			lastFlush := st.lastFlush
+			fs.LastFlush = &lastFlush
+		}
+		if !st.lastErrAt.IsZero() {
+			lastErrAt := st.lastErrAt
+			fs.LastErrorAt = &lastErrAt
+		}
+	}
+	a.statsMu.Unlock()
+
+	for _, fs := range files {
+		status.Files = append(status.Files, *fs)
+	}
+	sort.Slice(status.Files, func(i, j int) bool {
+		return status.Files[i].FileID < status.Files[j].FileID
+	})
+
+	return status
+}
+
+// Readiness выполняет проверки готовности приложения принимать сообщения.
+func (a *App) Readiness() ([]Check, bool) {
+	checks := []Check{
+		checkResult("workers", a.checkWorkers()),
+		checkResult("files_dir", a.checkFilesDir()),
+		checkResult("queue", a.checkQueue()),
+		checkResult("circuits", a.checkCircuits()),
+	}
+
+	ready := true
+	for _, c := range checks {
+		ready = ready && c.OK
+	}
+	return checks, ready
+}
+
+func checkResult(name string, err error) Check {
+	if err != nil {
+		return Check{Name: name, Error: err.Error()}
+	}
+	return Check{Name: name, OK: true}
+}
+
+func (a *App) checkWorkers() error {
+	if !a.running() {
+		return fmt.Errorf("обработчики не запущены или приложение останавливается")
+	}
+	return nil
+}
+
+func (a *App) checkFilesDir() error {
+	f, err := os.CreateTemp(a.cfg.FilesDir, ".readyz-*")
+	if err != nil {
+		return fmt.Errorf("каталог %s недоступен для записи: %w", a.cfg.FilesDir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// QueueLoad возвращает долю заполненности общей очереди.
+func (a *App) QueueLoad() float64 {
+	return float64(len(a.queue)) / float64(cap(a.queue))
+}
+
+func (a *App) checkQueue() error {
+	threshold := a.cfg.ReadyQueueThreshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = 1
+	}
+	if depth := len(a.queue); float64(depth) >= threshold*float64(cap(a.queue)) {
+		return fmt.Errorf("очередь переполнена: %d из %d", depth, cap(a.queue))
+	}
+	return nil
+}
+
+func (a *App) checkCircuits() error {
+	if open := a.openCircuits(); len(open) > 0 {
+		sort.Strings(open)
+		return fmt.Errorf("запись приостановлена для файлов: %v", open)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/fileid"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/storage"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+var (
+	ErrUnknownTenant = errors.New("тенант не зарегистрирован")
+	ErrTenantQuota   = errors.New("превышена квота тенанта на количество файлов")
+)
+
+const FormatJSON = "json"
+
+// TenantStatus - файлы тенанта и его квота.
+type TenantStatus struct {
+	Tenant   string   `json:"tenant"`
+	Files    []string `json:"files"`
+	MaxFiles int      `json:"max_files,omitempty"`
+}
+
+func (a *App) tenantConfig(tenant string) config.TenantConfig {
+	return a.cfg.Tenants[tenant]
+}
+
+// TenantOf возвращает тенант пользователя с токеном token из настроек
+// TokenTenants, пустую строку - для пользователей без тенанта.
+func (a *App) TenantOf(token string) string {
+	return a.cfg.TokenTenants[token]
+}
+
+// checkTenantQuotaLocked проверяет, можно ли тенанту завести еще один файл.
+// Вызывающий должен удерживать a.mutex.
+func (a *App) checkTenantQuotaLocked(tenant string) error {
+	maxFiles := a.tenantConfig(tenant).MaxFiles
+	if maxFiles <= 0 {
+		return nil
+	}
+
+	files := 0
+	for key := range a.pools {
+		if t, _ := types.SplitFileKey(key); t == tenant {
+			files++
+		}
+	}
+	if files >= maxFiles {
+		return fmt.Errorf("%w (%d)", ErrTenantQuota, maxFiles)
+	}
+	return nil
+}
+
+type jsonLine struct {
+	ID            string    `json:"id"`
+	Time          time.Time `json:"time"`
+	SchemaVersion string    `json:"schema_version,omitempty"`
+	Data          string    `json:"data"`
+}
+
+// formatMessages приводит сообщения к формату строк, заданному тенанту файла.
+func (a *App) formatMessages(fileID string, messages []types.Message) []types.Message {
+	tenant, _ := types.SplitFileKey(fileID)
+	if a.tenantConfig(tenant).Format != FormatJSON {
+		return messages
+	}
+
+	now := time.Now()
+	formatted := make([]types.Message, len(messages))
+	for i, msg := range messages {
+		line, _ := json.Marshal(jsonLine{ID: msg.ID, Time: now, SchemaVersion: msg.SchemaVersion, Data: msg.Data})
+		msg.Data = string(line)
+		formatted[i] = msg
+	}
+	return formatted
+}
+
+// flushTick - период проверки кеша: наименьший из общего интервала и интервалов тенантов.
+func (a *App) flushTick() time.Duration {
+	tick := a.cfg.WorkerInterval
+	for _, tc := range a.cfg.Tenants {
+		if tc.FlushInterval > 0 && tc.FlushInterval < tick {
+			tick = tc.FlushInterval
+		}
+	}
+	return tick
+}
+
+func (a *App) flushInterval(tenant string) time.Duration {
+	if interval := a.tenantConfig(tenant).FlushInterval; interval > 0 {
+		return interval
+	}
+	return a.cfg.WorkerInterval
+}
+
+// flushSchedule запоминает время последнего планового сброса каждого тенанта.
+// Используется только горутиной writeFiles.
+type flushSchedule struct {
+	tick  time.Duration
+	start time.Time
+	last  map[string]time.Time
+}
+
+func newFlushSchedule(tick time.Duration) *flushSchedule {
+	return &flushSchedule{tick: tick, start: time.Now(), last: make(map[string]time.Time)}
+}
+
+// due сообщает, пора ли сбрасывать файлы тенанта. Допуск в полтика
+// компенсирует неточность тикера.
+func (s *flushSchedule) due(tenant string, interval time.Duration, now time.Time) bool {
+	last, exists := s.last[tenant]
+	if !exists {
+		last = s.start
+	}
+	if now.Sub(last) < interval-s.tick/2 {
+		return false
+	}
+	s.last[tenant] = now
+	return true
+}
+
+// processScheduled сбрасывает файлы тенантов, у которых наступил интервал сброса.
+func (a *App) processScheduled(s *flushSchedule) {
+	now := time.Now()
+	due := make(map[string]bool)
+	a.flushCache(func(fileID string, batch *fileBatch) bool {
+		tenant, _ := types.SplitFileKey(fileID)
+		isDue, checked := due[tenant]
+		if !checked {
+			isDue = s.due(tenant, a.flushInterval(tenant), now)
+			due[tenant] = isDue
+		}
+		return isDue && a.flushAllowed(fileID, batch)
+	})
+}
+
+func (a *App) tenantRetention(tenant string) storage.Retention {
+	retention := a.retention()
+	tc := a.tenantConfig(tenant)
+	if tc.RetentionMaxSegments > 0 {
+		retention.MaxSegments = tc.RetentionMaxSegments
+	}
+	if tc.RetentionMaxAge > 0 {
+		retention.MaxAge = tc.RetentionMaxAge
+	}
+	if tc.RetentionMaxTotalBytes > 0 {
+		retention.MaxTotalBytes = tc.RetentionMaxTotalBytes
+	}
+	return retention
+}
+
+// tenantDirs возвращает подкаталоги FilesDir, которые могут принадлежать тенантам.
+func (a *App) tenantDirs() []string {
+	entries, err := os.ReadDir(a.cfg.FilesDir)
+	if err != nil {
+		return nil
+	}
+
+	var tenants []string
+	for _, entry := range entries {
+		if entry.IsDir() && fileid.Validate(entry.Name()) == nil {
+			tenants = append(tenants, entry.Name())
+		}
+	}
+	return tenants
+}
+
+// Tenants возвращает зарегистрированные файлы по тенантам, включая
+// тенантов из настроек, у которых еще нет файлов. Файлы без тенанта
+// возвращаются под пустым именем.
+func (a *App) Tenants() []TenantStatus {
+	byTenant := make(map[string]*TenantStatus)
+	get := func(tenant string) *TenantStatus {
+		ts, exists := byTenant[tenant]
+		if !exists {
+			ts = &TenantStatus{Tenant: tenant, Files: []string{}, MaxFiles: a.tenantConfig(tenant).MaxFiles}
+			byTenant[tenant] = ts
+		}
+		return ts
+	}
+
+	for tenant := range a.cfg.Tenants {
+		get(tenant)
+	}
+
+	a.mutex.RLock()
+	for key := range a.pools {
+		tenant, fileID := types.SplitFileKey(key)
+		ts := get(tenant)
+		ts.Files = append(ts.Files, fileID)
+	}
+	a.mutex.RUnlock()
+
+	result := make([]TenantStatus, 0, len(byTenant))
+	for _, ts := range byTenant {
+		sort.Strings(ts.Files)
+		result = append(result, *ts)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Tenant < result[j].Tenant
+	})
+	return result
+}
+
+// TenantFiles возвращает состояние файлов одного тенанта.
+func (a *App) TenantFiles(tenant string) ([]FileStatus, error) {
+	files := []FileStatus{}
+	for _, fs := range a.Status().Files {
+		if t, _ := types.SplitFileKey(fs.FileID); t == tenant {
+			files = append(files, fs)
+		}
+	}
+
+	if _, configured := a.cfg.Tenants[tenant]; len(files) == 0 && !configured {
+		return nil, ErrUnknownTenant
+	}
+	return files, nil
+}
@@ -1,25 +1,352 @@
 package config
 
 import (
+	"os"
 	"time"
 )
 
 type Config struct {
 	ValidTokens    []string
+	AdminToken     string // токен для /admin/* из ADMIN_TOKEN, пустой (по умолчанию) - административные эндпоинты отключены
 	WorkerInterval time.Duration
 	FilesDir       string
 	NumWorkers     int
 	MaxRetries     int
 	RetryInterval  time.Duration
+
+	// Приостановка записи в файл после BreakerThreshold неудачных батчей подряд (0 - отключено)
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Триггеры досрочного сброса кеша файла (0 - триггер отключен)
+	MaxBatchMessages int
+	MaxBatchBytes    int
+	MaxMessageAge    time.Duration
+
+	// Количество шардов кеша сообщений
+	CacheShards int
+
+	// Автомасштабирование обработчиков каналов файлов (0 - без ограничения или отключено)
+	MinFileWorkers    int
+	MaxFileWorkers    int
+	ScaleUpThreshold  float64 // доля заполненности канала, при которой добавляется обработчик
+	ScaleInterval     time.Duration
+	WorkerIdleTimeout time.Duration
+
+	// Ограничение на время остановки конвейера (0 - без ограничения)
+	ShutdownTimeout time.Duration
+	// Общее время на остановку сервера и приложения, после которого процесс завершается с ошибкой
+	ShutdownGracePeriod time.Duration
+
+	// Максимальное количество серий с разными fileID у одной метрики
+	MetricsMaxFileLabels int
+
+	// Доля заполненности общей очереди, при которой приложение считается неготовым
+	ReadyQueueThreshold float64
+
+	// Логирование: уровень (debug, info, warn, error), формат (text, json) и
+	// вывод токенов и данных сообщений, которые по умолчанию скрываются
+	LogLevel    string
+	LogFormat   string
+	LogPayloads bool
+
+	// Трассировка: экспортер (none, otlp, file), адрес коллектора OTLP/HTTP
+	// и файл, в который пишет экспортер file
+	TracingExporter string
+	OTLPEndpoint    string
+	TracingFile     string
+
+	// Ротация файлов (по умолчанию отключена): по размеру (0 - отключена), по
+	// времени (hourly, daily, пусто - отключена) и сжатие ротированных сегментов
+	RotationMaxBytes int64
+	RotationInterval string
+	RotationCompress bool
+
+	// Хранение ротированных сегментов каждого файла (0 - без ограничения)
+	// и период проверки сегментов
+	RetentionMaxSegments   int
+	RetentionMaxAge        time.Duration
+	RetentionMaxTotalBytes int64
+	RetentionInterval      time.Duration
+
+	// Ограничение скорости приема (в секунду, 0 - без ограничения) для каждого токена
+	// и для каждого файла, по количеству сообщений и по байтам данных. Лимиты
+	// отдельных токенов переопределяются в TokenRateLimits - только в настройках,
+	// а не при добавлении пользователя, иначе отправитель сам снимал бы с себя
+	// ограничение. RateLimitBurst - допустимый всплеск в секундах лимита (0 - одна секунда)
+	TokenMessageRate float64
+	TokenByteRate    float64
+	FileMessageRate  float64
+	FileByteRate     float64
+	RateLimitBurst   float64
+	TokenRateLimits  map[string]RateLimit
+
+	// Квоты на объем данных на диске в байтах для каждого файла и каждого
+	// пользователя (0 - без ограничения): сверх мягкой квоты сообщения принимаются
+	// с предупреждением, сверх жесткой - отклоняются. Сегменты, удаленные правилами
+	// хранения, снимаются с учета; копии сообщения, разосланные маршрутизацией,
+	// занимают место каждая в своем файле и учитываются пользователю по отдельности.
+	// Ротация по умолчанию отключена, поэтому квоты по умолчанию ограничивают
+	// рост файлов; при включении ротации их стоит согласовать с правилами
+	// хранения. Учет сохраняется в UsageFile (пусто - не сохраняется) каждые
+	// UsageSaveInterval и при остановке
+	FileQuotaSoft     int64
+	FileQuotaHard     int64
+	UserQuotaSoft     int64
+	UserQuotaHard     int64
+	UsageFile         string
+	UsageSaveInterval time.Duration
+
+	// Служебные файлы приложения вне FilesDir (пусто - не сохраняются): номера
+	// записанных сообщений файлов для webhook (подкаталог seq) и батчи, не
+	// записанные после всех попыток (подкаталог deadletter), которые
+	// администратор возвращает в конвейер через /admin/deadletter/replay
+	StateDir string
+
+	// Адрес gRPC-сервера приема сообщений, например ":9090" (пусто, по
+	// умолчанию, - gRPC отключен)
+	GRPCAddr string
+
+	// WebSocket (/ws): интервал ping и время ожидания pong (0 - без heartbeat),
+	// максимальный размер сообщения клиента и заполненность общей очереди, при
+	// которой прием приостанавливается (pause, 0 - никогда) и возобновляется (resume)
+	WSPingInterval    time.Duration
+	WSPongTimeout     time.Duration
+	WSMaxMessageBytes int64
+	WSPauseThreshold  float64
+	WSResumeThreshold float64
+
+	// Построчный протокол: адрес TCP и путь Unix-сокета (пусто - отключены),
+	// сертификат и ключ TLS для TCP (пусто - без TLS), максимальная длина строки
+	// и время ожидания строки приветствия и последующих строк (0 - без ограничения)
+	LineTCPAddr          string
+	LineUnixSocket       string
+	LineTLSCertFile      string
+	LineTLSKeyFile       string
+	LineMaxBytes         int
+	LineHandshakeTimeout time.Duration
+	LineIdleTimeout      time.Duration
+
+	// Прием syslog (RFC 5424 и RFC 3164): адреса UDP и TCP (пусто - отключены),
+	// токены источников по IP-адресу или подсети, правила выбора fileID
+	// (применяется первое подходящее), файлы, в которые источнику можно писать
+	// помимо файла его пользователя (адрес или подсеть из SyslogSources ->
+	// fileID), токены пользователей этих файлов (fileID -> токен) и
+	// максимальный размер сообщения. В остальные файлы сообщение отправляется
+	// с токеном источника, пользователь которого пишет только в свой файл
+	SyslogUDPAddr         string
+	SyslogTCPAddr         string
+	SyslogSources         map[string]string
+	SyslogRules           []SyslogRule
+	SyslogSourceFiles     map[string][]string
+	SyslogFileTokens      map[string]string
+	SyslogMaxMessageBytes int
+
+	// Локальные файлы, строки которых становятся сообщениями. Позиции чтения
+	// сохраняются в FileSourceOffsets (пусто - не сохраняются), чтобы после
+	// перезапуска чтение продолжалось без повторов
+	FileSources            []FileSource
+	FileSourceOffsets      string
+	FileSourcePollInterval time.Duration
+
+	// Обработка данных перед постановкой в очередь: цепочка обработчиков по
+	// идентификатору файла (fileID или tenant/fileID), применяется по порядку
+	Processors map[string][]ProcessorConfig
+
+	// Схемы данных сообщений по идентификатору файла (fileID или tenant/fileID).
+	// Проверяются данные после цепочки Processors; не соответствующие схеме
+	// отклоняются, версия схемы записывается в строки файлов с форматом json
+	Schemas map[string]SchemaConfig
+
+	// Маршрутизация: правила копирования или переноса сообщений в дополнительные
+	// файлы. Применяются все подходящие правила, после проверки и обработки данных
+	Routes []RouteRule
+
+	// Исходящие webhook о записи файлов: получатели, размер очереди доставки,
+	// число попыток и интервал перед первым повтором (удваивается с каждой
+	// попыткой), время ожидания ответа и число записей в журнале доставки
+	Webhooks             []WebhookConfig
+	WebhookQueueSize     int
+	WebhookMaxAttempts   int
+	WebhookRetryInterval time.Duration
+	WebhookTimeout       time.Duration
+	WebhookLogSize       int
+
+	// Настройки тенантов по имени. Файлы тенанта хранятся в подкаталоге FilesDir,
+	// файлы пользователей без тенанта - в самом FilesDir
+	Tenants map[string]TenantConfig
+	// Тенант пользователя по токену (нет в карте - файл пользователя в самом
+	// FilesDir). Задается только в настройках, а не при добавлении пользователя,
+	// иначе клиент сам выбирал бы себе тенант и пользовался его настройками и квотами
+	TokenTenants map[string]string
+}
+
+// RateLimit - лимиты скорости токена в секунду (0 - общие настройки).
+type RateLimit struct {
+	MessageRate float64
+	ByteRate    float64
+}
+
+// SyslogRule - правило выбора fileID для сообщения syslog. Пустые условия
+// не проверяются.
+type SyslogRule struct {
+	AppName string // шаблон app-name (TAG для RFC 3164) в синтаксисе path.Match
+	SDID    string // элемент structured-data, который должен быть в сообщении
+	SDParam string // параметр элемента SDID; если FileID пуст, fileID - его значение
+	FileID  string
+}
+
+// FileSource - локальный источник сообщений.
+type FileSource struct {
+	Path   string // файл для tail, каталог или шаблон filepath.Glob для import
+	Mode   string // tail - следить за дописыванием с учетом ротации, import - прочитать один раз
+	Token  string // токен пользователя файла FileID
+	FileID string
+}
+
+// ProcessorConfig - обработчик данных сообщения. Используемые поля зависят от Type:
+//   - drop, keep: отбросить сообщения, подходящие (drop) или не подходящие (keep) под Pattern;
+//   - redact: заменить фрагменты по Pattern или готовому шаблону Preset (email, card) на Replace (пусто - "***");
+//   - prefix: добавить перед данными шаблон text/template Template (поля Time, MsgID, Tenant, FileID, User);
+//   - truncate: обрезать данные до MaxBytes байт, Replace - окончание обрезанных данных.
+type ProcessorConfig struct {
+	Type     string
+	Pattern  string
+	Preset   string
+	Replace  string
+	Template string
+	MaxBytes int
+}
+
+// SchemaConfig - схема данных сообщений файла: данные должны быть JSON-объектом
+// с полями Fields. Поля, не описанные в схеме, допускаются только при AllowExtra.
+type SchemaConfig struct {
+	Version    string
+	Fields     []SchemaField
+	AllowExtra bool
+}
+
+// SchemaField - поле данных сообщения.
+type SchemaField struct {
+	Name     string   // имя поля, вложенные поля - через точку (user.id)
+	Type     string   // string, number, integer, boolean, object, array или any
+	Required bool     // поле должно быть и не равно null
+	Pattern  string   // регулярное выражение для строки
+	Enum     []string // допустимые значения строки
+}
+
+// RouteRule - правило маршрутизации сообщений. Пустые условия не проверяются.
+type RouteRule struct {
+	FileID string   // шаблон fileID исходного файла (без тенанта) в синтаксисе path.Match
+	Match  string   // регулярное выражение для данных сообщения
+	To     []string // файлы назначения в тенанте исходного файла
+	Move   bool     // не записывать сообщение в исходный файл
+}
+
+// WebhookConfig - получатель уведомлений. Пустые фильтры пропускают все события.
+type WebhookConfig struct {
+	URL    string
+	Secret string   // ключ подписи HMAC-SHA256 (пусто - без подписи)
+	Events []string // file.flushed, batch.dead_lettered, circuit.opened
+	FileID string   // шаблон идентификатора файла (tenant/fileID) в синтаксисе path.Match
+}
+
+// TenantConfig - настройки тенанта. Нулевые значения - общие настройки.
+type TenantConfig struct {
+	MaxFiles      int    // квота на количество файлов тенанта (0 - без ограничения)
+	Format        string // формат строк в файле: text (только данные) или json
+	FlushInterval time.Duration
+
+	RetentionMaxSegments   int
+	RetentionMaxAge        time.Duration
+	RetentionMaxTotalBytes int64
 }
 
 func LoadConfig() *Config {
 	return &Config{
 		ValidTokens:    []string{"valid_token_1", "valid_token_2"},
+		AdminToken:     os.Getenv("ADMIN_TOKEN"),
 		WorkerInterval: 1 * time.Second,
 		FilesDir:       "files",
 		NumWorkers:     5,
 		MaxRetries:     3,
 		RetryInterval:  2 * time.Second,
+
+		BreakerThreshold: 3,
+		BreakerCooldown:  30 * time.Second,
+
+		MaxBatchMessages: 1000,
+		MaxBatchBytes:    1 << 20,
+
+		CacheShards: 32,
+
+		MinFileWorkers:    1,
+		MaxFileWorkers:    16,
+		ScaleUpThreshold:  0.5,
+		ScaleInterval:     100 * time.Millisecond,
+		WorkerIdleTimeout: 5 * time.Second,
+
+		ShutdownTimeout:     10 * time.Second,
+		ShutdownGracePeriod: 15 * time.Second,
+
+		MetricsMaxFileLabels: 100,
+
+		ReadyQueueThreshold: 0.9,
+
+		LogLevel:  "info",
+		LogFormat: "text",
+
+		TracingExporter: "none",
+		OTLPEndpoint:    "localhost:4318",
+		TracingFile:     "traces.json",
+
+		RetentionMaxSegments: 30,
+		RetentionInterval:    time.Minute,
+
+		TokenMessageRate: 100,
+		TokenByteRate:    1 << 20,
+		FileMessageRate:  500,
+		FileByteRate:     4 << 20,
+		RateLimitBurst:   2,
+		TokenRateLimits:  map[string]RateLimit{},
+
+		FileQuotaSoft:     4 << 30,
+		FileQuotaHard:     5 << 30,
+		UserQuotaSoft:     4 << 30,
+		UserQuotaHard:     5 << 30,
+		UsageFile:         "usage.json",
+		UsageSaveInterval: 10 * time.Second,
+
+		StateDir: "state",
+
+		WSPingInterval:    15 * time.Second,
+		WSPongTimeout:     10 * time.Second,
+		WSMaxMessageBytes: 1 << 20,
+		WSPauseThreshold:  0.8,
+		WSResumeThreshold: 0.5,
+
+		LineMaxBytes:         64 << 10,
+		LineHandshakeTimeout: 10 * time.Second,
+		LineIdleTimeout:      5 * time.Minute,
+
+		SyslogSources:         map[string]string{},
+		SyslogSourceFiles:     map[string][]string{},
+		SyslogFileTokens:      map[string]string{},
+		SyslogMaxMessageBytes: 64 << 10,
+
+		FileSourceOffsets:      "offsets.json",
+		FileSourcePollInterval: time.Second,
+
+		Processors: map[string][]ProcessorConfig{},
+		Schemas:    map[string]SchemaConfig{},
+
+		WebhookQueueSize:     1000,
+		WebhookMaxAttempts:   5,
+		WebhookRetryInterval: time.Second,
+		WebhookTimeout:       5 * time.Second,
+		WebhookLogSize:       100,
+
+		Tenants:      map[string]TenantConfig{},
+		TokenTenants: map[string]string{},
 	}
 }
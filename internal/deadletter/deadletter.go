@@ -0,0 +1,177 @@
+// Package deadletter хранит батчи, которые не удалось записать в файл после
+// всех попыток. Сообщения батча дописываются в <fileID>.jsonl каталога
+// хранилища (файлы тенанта - в его подкаталоге) и по команде оператора
+// возвращаются в конвейер.
+package deadletter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+const ext = ".jsonl"
+
+// record - строка хранилища. Токен сохраняется, чтобы при повторной отправке
+// сообщение учитывалось в квоте своего пользователя, поэтому файлы хранилища
+// доступны только владельцу процесса.
+type record struct {
+	ID            string `json:"id"`
+	Token         string `json:"token"`
+	Data          string `json:"data"`
+	SchemaVersion string `json:"schema_version,omitempty"`
+}
+
+// Store - хранилище недоставленных батчей. nil Store батчи не сохраняет.
+type Store struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// NewStore возвращает хранилище в каталоге dir. Для пустого dir возвращает nil.
+func NewStore(dir string) *Store {
+	if dir == "" {
+		return nil
+	}
+	return &Store{dir: dir}
+}
+
+func (s *Store) path(fileID string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(fileID)+ext)
+}
+
+// Put дописывает сообщения батча файла fileID (types.FileKey).
+func (s *Store) Put(fileID string, messages []types.Message) error {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, name, err := openRoot(s.dir, s.path(fileID), true)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := r.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	encoder := json.NewEncoder(&buf)
+	for _, msg := range messages {
+		if err := encoder.Encode(record{ID: msg.ID, Token: msg.Token, Data: msg.Data, SchemaVersion: msg.SchemaVersion}); err != nil {
+			return err
+		}
+	}
+
+	f, err := r.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(buf.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Take забирает сохраненные сообщения файла fileID: они удаляются из хранилища.
+func (s *Store) Take(fileID string) ([]types.Message, error) {
+	if s == nil {
+		return nil, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	r, name, err := openRoot(s.dir, s.path(fileID), false)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	f, err := r.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	messages, err := decode(f, fileID)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return messages, r.Remove(name)
+}
+
+// Files возвращает количество сохраненных сообщений по файлам.
+func (s *Store) Files() (map[string]int, error) {
+	result := make(map[string]int)
+	if s == nil {
+		return result, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ext) {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		result[filepath.ToSlash(strings.TrimSuffix(rel, ext))] = strings.Count(string(data), "\n")
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	}
+	return result, err
+}
+
+// openRoot открывает каталог хранилища, при create создавая его.
+func openRoot(dir, filePath string, create bool) (*os.Root, string, error) {
+	if create {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, "", err
+		}
+	}
+	return types.OpenRoot(dir, filePath)
+}
+
+func decode(f *os.File, fileID string) ([]types.Message, error) {
+	var messages []types.Message
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for scanner.Scan() {
+		var rec record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, err
+		}
+		messages = append(messages, types.Message{
+			ID:            rec.ID,
+			Token:         rec.Token,
+			FileID:        fileID,
+			Data:          rec.Data,
+			SchemaVersion: rec.SchemaVersion,
+		})
+	}
+	return messages, scanner.Err()
+}
@@ -0,0 +1,70 @@
+package deadletter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+// Проверяет сохранение батчей по файлам и их возврат с удалением из хранилища.
+func TestPutTake(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "deadletter")
+	s := NewStore(dir)
+
+	first := []types.Message{
+		{ID: "1", Token: "token1", FileID: "acme/orders", Data: "a\nb", SchemaVersion: "v1"},
+		{ID: "2", Token: "token2", FileID: "acme/orders", Data: "c"},
+	}
+	second := []types.Message{{ID: "3", Token: "token1", FileID: "acme/orders", Data: "d"}}
+	for _, batch := range [][]types.Message{first, second} {
+		if err := s.Put("acme/orders", batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put("file1", []types.Message{{ID: "4", FileID: "file1", Data: "e"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := s.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]int{"acme/orders": 3, "file1": 1}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("ожидалось %v, получено %v", expected, files)
+	}
+	info, err := os.Stat(filepath.Join(dir, "acme", "orders.jsonl"))
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("файл хранилища должен быть доступен только владельцу: %v (%v)", info, err)
+	}
+
+	got, err := s.Take("acme/orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := append(first, second...); !reflect.DeepEqual(got, expected) {
+		t.Errorf("ожидалось %+v, получено %+v", expected, got)
+	}
+	if got, err := s.Take("acme/orders"); err != nil || got != nil {
+		t.Errorf("сообщения должны быть удалены из хранилища, получено %v (%v)", got, err)
+	}
+	if got, err := s.Take("file2"); err != nil || got != nil {
+		t.Errorf("файл без сообщений, получено %v (%v)", got, err)
+	}
+
+	var empty *Store
+	if err := empty.Put("file1", first); err != nil {
+		t.Errorf("nil Store не должен возвращать ошибку: %v", err)
+	}
+	if files, err := empty.Files(); err != nil || len(files) != 0 {
+		t.Errorf("nil Store не хранит сообщения, получено %v (%v)", files, err)
+	}
+	if NewStore("") != nil {
+		t.Error("хранилище без каталога должно быть nil")
+	}
+	if files, err := NewStore(filepath.Join(t.TempDir(), "missing")).Files(); err != nil || len(files) != 0 {
+		t.Errorf("несозданное хранилище пустое, получено %v (%v)", files, err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package events - шина событий конвейера внутри процесса. Приложение,
+// обработчик сообщений и репозиторий пользователей публикуют типизированные
+// события, а метрики, webhook и тесты подписываются на них, не меняя основной
+// цикл обработки. События публикуются вне блокировок публикующего компонента.
+package events
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+// MessageAccepted - сообщение поставлено в очередь.
+type MessageAccepted struct {
+	Message types.Message
+}
+
+// Причины отклонения сообщения.
+const (
+	ReasonInvalidToken   = "invalid_token"
+	ReasonInvalidPayload = "invalid_payload"
+	ReasonRateLimited    = "rate_limited"
+	ReasonQuotaExceeded  = "quota_exceeded"
+	ReasonShuttingDown   = "shutting_down"
+	ReasonFiltered       = "filtered"
+)
+
+// MessageRejected - сообщение не принято или отброшено фильтром файла.
+// Для недействительного токена в Message известен только токен.
+type MessageRejected struct {
+	Message types.Message
+	Reason  string
+	Err     error // nil для ReasonFiltered
+}
+
+// BatchFlushed - батч записан в файл. Номера сообщений файла (с 1,
+// включительно) сохраняются между перезапусками, смещения в байтах (конец не
+// включается) - позиция батча в текущем файле <fileID>.txt на момент записи.
+// Номера и смещения заполняются, только если приложение их ведет (см.
+// app.App.TrackSequences), иначе они нулевые.
+type BatchFlushed struct {
+	FileID    string
+	Messages  int
+	Attempts  int
+	FirstSeq  int64
+	LastSeq   int64
+	ByteStart int64
+	ByteEnd   int64
+}
+
+// WriteRetried - повтор записи батча после ошибки Err; Attempt - номер
+// повторной попытки, начиная со второй.
+type WriteRetried struct {
+	FileID  string
+	Attempt int
+	Err     error
+}
+
+// WriteFailed - батч не записан после всех попыток. Если задан каталог
+// StateDir, сообщения батча затем сохраняются в хранилище dead letter
+// (BatchDeadLettered), иначе отбрасываются.
+type WriteFailed struct {
+	FileID   string
+	Messages int
+	Attempts int
+	Err      error
+}
+
+// BatchDeadLettered - батч, не записанный после всех попыток, сохранен в
+// хранилище dead letter и может быть возвращен в конвейер оператором.
+type BatchDeadLettered struct {
+	FileID   string
+	Messages int
+	Attempts int
+	Err      error
+}
+
+// CircuitOpened - запись в файл приостановлена после серии неудавшихся батчей.
+type CircuitOpened struct {
+	FileID   string
+	Failures int
+	Until    time.Time
+	Err      error
+}
+
+// UserAdded - репозиторий зарегистрировал пользователя, канал его файла уже создан.
+type UserAdded struct {
+	User types.User
+}
+
+// Default - шина, в которую публикуют события компоненты приложения.
+var Default = NewBus()
+
+type subscription struct {
+	id int
+	fn func(any)
+}
+
+// Bus доставляет события подписчикам их типа синхронно, в порядке подписки.
+// Подписчики должны быстро возвращать управление: они выполняются в горутине
+// публикующего компонента.
+type Bus struct {
+	mutex    sync.RWMutex
+	nextID   int
+	handlers map[reflect.Type][]subscription
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[reflect.Type][]subscription)}
+}
+
+// Subscribe подписывает fn на события типа E и возвращает функцию отписки.
+func Subscribe[E any](b *Bus, fn func(E)) (unsubscribe func()) {
+	typ := reflect.TypeFor[E]()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.nextID++
+	id := b.nextID
+	b.handlers[typ] = append(b.handlers[typ], subscription{id: id, fn: func(event any) {
+		fn(event.(E))
+	}})
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		subs := b.handlers[typ]
+		for i, sub := range subs {
+			if sub.id == id {
+				// срез копируется: Publish может обходить прежний
+				b.handlers[typ] = append(subs[:i:i], subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish передает событие подписчикам его типа. Подписчики могут
+// подписываться и отписываться во время публикации.
+func (b *Bus) Publish(event any) {
+	b.mutex.RLock()
+	subs := b.handlers[reflect.TypeOf(event)]
+	b.mutex.RUnlock()
+
+	for _, sub := range subs {
+		sub.fn(event)
+	}
+}
@@ -0,0 +1,47 @@
+package events
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+func TestPublish(t *testing.T) {
+	bus := NewBus()
+	var got []string
+	Subscribe(bus, func(e MessageAccepted) { got = append(got, "первый "+e.Message.FileID) })
+	Subscribe(bus, func(e MessageAccepted) { got = append(got, "второй "+e.Message.FileID) })
+	Subscribe(bus, func(e MessageRejected) { got = append(got, "отклонено "+e.Reason) })
+
+	bus.Publish(MessageAccepted{Message: types.Message{FileID: "file1"}})
+	bus.Publish(UserAdded{User: types.User{Token: "token"}})
+	bus.Publish(MessageRejected{Reason: ReasonRateLimited})
+
+	expected := []string{"первый file1", "второй file1", "отклонено rate_limited"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("ожидалось %v, получено %v", expected, got)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	bus := NewBus()
+	var got []int
+	var unsubscribeFirst func()
+	unsubscribeFirst = Subscribe(bus, func(e WriteRetried) {
+		got = append(got, 1)
+		// отписка во время публикации не мешает остальным подписчикам
+		unsubscribeFirst()
+	})
+	unsubscribeSecond := Subscribe(bus, func(e WriteRetried) { got = append(got, 2) })
+
+	bus.Publish(WriteRetried{FileID: "file1", Attempt: 2})
+	bus.Publish(WriteRetried{FileID: "file1", Attempt: 3})
+	unsubscribeSecond()
+	unsubscribeSecond()
+	bus.Publish(WriteRetried{FileID: "file1", Attempt: 4})
+
+	if expected := []int{1, 2, 2}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("ожидалось %v, получено %v", expected, got)
+	}
+}
@@ -0,0 +1,70 @@
+// Package fileid задает допустимый формат идентификаторов файлов.
+// Идентификатор используется как имя файла в FilesDir, поэтому в нем
+// не может быть разделителей пути, точек и зарезервированных имен.
+package fileid
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const MaxLength = 64
+
+var (
+	ErrEmpty    = errors.New("пустой fileID")
+	ErrTooLong  = errors.New("fileID длиннее 64 символов")
+	ErrInvalid  = errors.New("fileID может содержать только латинские буквы, цифры, '-' и '_' и должен начинаться с буквы или цифры")
+	ErrReserved = errors.New("fileID совпадает с зарезервированным именем")
+)
+
+var grammar = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// зарезервированные имена устройств Windows: файл с таким именем нельзя создать
+var reserved = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// Normalize приводит fileID к каноническому виду (без пробелов по краям,
+// в нижнем регистре, чтобы на нечувствительных к регистру файловых системах
+// два fileID не попадали в один файл) и проверяет его.
+func Normalize(raw string) (string, error) {
+	id := strings.ToLower(strings.TrimSpace(raw))
+	if err := Validate(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Validate проверяет, что fileID уже находится в каноническом виде.
+func Validate(id string) error {
+	switch {
+	case id == "":
+		return ErrEmpty
+	case len(id) > MaxLength:
+		return ErrTooLong
+	case !grammar.MatchString(id):
+		return ErrInvalid
+	case reserved[id]:
+		return ErrReserved
+	}
+	return nil
+}
+
+// ValidateKey проверяет идентификатор файла с учетом тенанта (fileID или
+// tenant/fileID, см. types.FileKey): обе части должны быть в каноническом виде.
+func ValidateKey(key string) error {
+	tenant, id, found := strings.Cut(key, "/")
+	if !found {
+		return Validate(key)
+	}
+	if err := Validate(tenant); err != nil {
+		return fmt.Errorf("тенант %q: %w", tenant, err)
+	}
+	return Validate(id)
+}
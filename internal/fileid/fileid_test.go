@@ -0,0 +1,88 @@
+package fileid
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		raw      string
+		expected string
+		err      error
+	}{
+		{raw: "file1", expected: "file1"},
+		{raw: "  Report_2026-10 ", expected: "report_2026-10"},
+		{raw: "", err: ErrEmpty},
+		{raw: "   ", err: ErrEmpty},
+		{raw: "../../etc/passwd", err: ErrInvalid},
+		{raw: "..", err: ErrInvalid},
+		{raw: "a/b", err: ErrInvalid},
+		{raw: `a\b`, err: ErrInvalid},
+		{raw: "file.txt", err: ErrInvalid},
+		{raw: "-rf", err: ErrInvalid},
+		{raw: "file\x00", err: ErrInvalid},
+		{raw: "файл", err: ErrInvalid},
+		{raw: "NUL", err: ErrReserved},
+		{raw: "com1", err: ErrReserved},
+		{raw: strings.Repeat("a", MaxLength+1), err: ErrTooLong},
+	}
+
+	for _, tc := range cases {
+		id, err := Normalize(tc.raw)
+		if err != tc.err {
+			t.Errorf("Normalize(%q): ожидалась ошибка %v, получено: %v", tc.raw, tc.err, err)
+			continue
+		}
+		if id != tc.expected {
+			t.Errorf("Normalize(%q): ожидалось %q, получено: %q", tc.raw, tc.expected, id)
+		}
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	cases := []struct {
+		key string
+		err error
+	}{
+		{key: "file1"},
+		{key: "acme/file1"},
+		{key: "File1", err: ErrInvalid},
+		{key: "acme/", err: ErrEmpty},
+		{key: "/file1", err: ErrEmpty},
+		{key: "acme/a/b", err: ErrInvalid},
+		{key: "../file1", err: ErrInvalid},
+		{key: "nul/file1", err: ErrReserved},
+	}
+
+	for _, tc := range cases {
+		if err := ValidateKey(tc.key); !errors.Is(err, tc.err) {
+			t.Errorf("ValidateKey(%q): ожидалась ошибка %v, получено: %v", tc.key, tc.err, err)
+		}
+	}
+}
+
+// Проверяет, что любой принятый fileID дает имя файла непосредственно в FilesDir.
+func FuzzNormalize(f *testing.F) {
+	for _, seed := range []string{"file1", "../x", "a/../../b", "..", ".", "NUL", " A ", "a\x00b", `..\..\x`} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		id, err := Normalize(raw)
+		if err != nil {
+			return
+		}
+
+		dir := filepath.Join("sandbox", "files")
+		path := filepath.Join(dir, id+".txt")
+		if filepath.Dir(path) != dir || filepath.Base(path) != id+".txt" {
+			t.Fatalf("fileID %q выходит за пределы каталога: %s", raw, path)
+		}
+		if again, err := Normalize(id); err != nil || again != id {
+			t.Fatalf("нормализация не идемпотентна: %q -> %q (%v)", id, again, err)
+		}
+	})
+}
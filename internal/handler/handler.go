@@ -1,18 +1,55 @@
 package handler
 
 import (
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
+	"time"
 
 	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/events"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/metrics"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/process"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/quota"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ratelimit"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/schema"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/tracing"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
 )
 
+var (
+	messagesAccepted = metrics.Default.NewCounterVec(
+		"app_messages_accepted_total", "Количество сообщений, принятых в очередь", "file_id")
+	messagesRejected = metrics.Default.NewCounterVec(
+		"app_messages_rejected_total", "Количество отклоненных сообщений", "reason")
+	messagesFiltered = metrics.Default.NewCounterVec(
+		"app_messages_filtered_total", "Количество сообщений, отброшенных фильтрами файла", "file_id")
+)
+
+func init() {
+	events.Subscribe(events.Default, func(e events.MessageAccepted) {
+		messagesAccepted.Inc(e.Message.FileID)
+	})
+	events.Subscribe(events.Default, func(e events.MessageRejected) {
+		if e.Reason == events.ReasonFiltered {
+			messagesFiltered.Inc(e.Message.FileID)
+			return
+		}
+		messagesRejected.Inc(e.Reason)
+	})
+}
+
+var ErrInvalidToken = errors.New("invalid token")
+
 type MessageHandler struct {
 	userRepo *repository.UserRepository
 	app      types.AppInterface
 	cfg      *config.Config
+	limiter  *ratelimit.Limiter
+
+	processors *process.Pipeline
+	schemas    *schema.Registry
 }
 
 func NewMessageHandler(userRepo *repository.UserRepository, app types.AppInterface, cfg *config.Config) *MessageHandler {
@@ -20,17 +57,85 @@ func NewMessageHandler(userRepo *repository.UserRepository, app types.AppInterfa
 		userRepo: userRepo,
 		app:      app,
 		cfg:      cfg,
+		limiter:  ratelimit.New(),
 	}
 }
 
+// SetProcessors задает обработку данных сообщений перед постановкой в очередь.
+func (h *MessageHandler) SetProcessors(p *process.Pipeline) {
+	h.processors = p
+}
+
+// SetSchemas задает схемы, по которым проверяются данные сообщений.
+func (h *MessageHandler) SetSchemas(r *schema.Registry) {
+	h.schemas = r
+}
+
 func (h *MessageHandler) HandleMessage(msg types.Message) error {
-	log.Printf("обработка сообщения для файла %s", msg.FileID)
+	if msg.ID == "" {
+		msg.ID = logger.NewID()
+	}
+	span := tracing.StartMessageSpan(&msg, "handler.handle_message")
+	defer span.End()
+	slog.Debug("обработка сообщения", "msg", msg)
 
 	if !h.userRepo.IsValidToken(msg.Token) {
-		log.Printf("неверный токен для сообщения: %+v", msg)
-		return fmt.Errorf("invalid token")
+		slog.Warn("неверный токен для сообщения", "msg", msg)
+		reject(msg, events.ReasonInvalidToken, ErrInvalidToken)
+		tracing.Fail(span, ErrInvalidToken)
+		return ErrInvalidToken
+	}
+
+	// лимиты проверяются до постановки в очередь, чтобы один отправитель не занял ее целиком
+	if err := h.checkRateLimit(msg); err != nil {
+		slog.Warn("превышен лимит скорости", "msg", msg, logger.KeyError, err)
+		reject(msg, events.ReasonRateLimited, err)
+		tracing.Fail(span, err)
+		return err
 	}
 
-	h.app.SendMsg(msg)
+	// отброшенное фильтром сообщение - не ошибка отправителя, повторять его не нужно
+	if !h.processors.Process(&msg, time.Now()) {
+		slog.Debug("сообщение отброшено фильтром", "msg", msg)
+		reject(msg, events.ReasonFiltered, nil)
+		return nil
+	}
+
+	// данные проверяются после обработки: в файл попадает именно проверенная строка,
+	// даже если обработчики ее изменили
+	version, err := h.schemas.Validate(msg.FileID, msg.Data)
+	if err != nil {
+		slog.Warn("данные не соответствуют схеме", "msg", msg, logger.KeyError, err)
+		reject(msg, events.ReasonInvalidPayload, err)
+		tracing.Fail(span, err)
+		return err
+	}
+	msg.SchemaVersion = version
+
+	if err := h.app.SendMsg(msg); err != nil {
+		reason := events.ReasonShuttingDown
+		if errors.Is(err, quota.ErrExceeded) {
+			reason = events.ReasonQuotaExceeded
+		}
+		reject(msg, reason, err)
+		tracing.Fail(span, err)
+		return err
+	}
+
+	events.Default.Publish(events.MessageAccepted{Message: msg})
 	return nil
 }
+
+// CheckToken проверяет токен по white-list. Об отклоненном токене публикуется
+// MessageRejected, в сообщении которого известен только токен.
+func (h *MessageHandler) CheckToken(token string) error {
+	if !h.userRepo.IsValidToken(token) {
+		reject(types.Message{Token: token}, events.ReasonInvalidToken, ErrInvalidToken)
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func reject(msg types.Message, reason string, err error) {
+	events.Default.Publish(events.MessageRejected{Message: msg, Reason: reason, Err: err})
+}
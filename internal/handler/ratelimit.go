@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ratelimit"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+var ErrRateLimited = errors.New("превышен лимит скорости")
+
+// RateLimitError описывает лимит, из-за которого сообщение отклонено.
+type RateLimitError struct {
+	Scope      string // token или file
+	Limit      float64
+	Remaining  float64
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%v (%s), повторите через %v", ErrRateLimited, e.Scope, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+func (h *MessageHandler) limit(rate float64) ratelimit.Limit {
+	burst := h.cfg.RateLimitBurst
+	if burst <= 0 {
+		burst = 1
+	}
+	return ratelimit.Limit{Rate: rate, Burst: rate * burst}
+}
+
+// checkRateLimit списывает сообщение из корзин токена и файла. Лимиты токена
+// берутся из TokenRateLimits, если они там заданы.
+func (h *MessageHandler) checkRateLimit(msg types.Message) error {
+	messageRate, byteRate := h.cfg.TokenMessageRate, h.cfg.TokenByteRate
+	if limits, exists := h.cfg.TokenRateLimits[msg.Token]; exists {
+		if limits.MessageRate > 0 {
+			messageRate = limits.MessageRate
+		}
+		if limits.ByteRate > 0 {
+			byteRate = limits.ByteRate
+		}
+	}
+
+	size := float64(len(msg.Data))
+	res := h.limiter.Allow(
+		ratelimit.Request{Key: "token:msgs:" + msg.Token, Limit: h.limit(messageRate), N: 1},
+		ratelimit.Request{Key: "token:bytes:" + msg.Token, Limit: h.limit(byteRate), N: size},
+		ratelimit.Request{Key: "file:msgs:" + msg.FileID, Limit: h.limit(h.cfg.FileMessageRate), N: 1},
+		ratelimit.Request{Key: "file:bytes:" + msg.FileID, Limit: h.limit(h.cfg.FileByteRate), N: size},
+	)
+	if res.Allowed {
+		return nil
+	}
+
+	scope, _, _ := strings.Cut(res.Key, ":")
+	return &RateLimitError{
+		Scope:      scope,
+		Limit:      res.Limit,
+		Remaining:  res.Remaining,
+		RetryAfter: res.RetryAfter,
+		Reset:      res.Reset,
+	}
+}
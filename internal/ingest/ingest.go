@@ -0,0 +1,239 @@
+// Package ingest - общая для всех протоколов приема логика добавления
+// пользователей и сообщений: проверка параметров, токена и квот и
+// единые коды ошибок, которые каждый протокол переводит в свои.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/fileid"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/quota"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/schema"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/tracing"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+type Code int
+
+const (
+	CodeInvalidArgument Code = iota + 1
+	CodeUnauthenticated
+	CodeForbidden
+	CodeNotFound
+	CodeRateLimited
+	CodeQuotaExceeded
+	CodeUnavailable
+)
+
+var codeNames = map[Code]string{
+	CodeInvalidArgument: "invalid_argument",
+	CodeUnauthenticated: "unauthenticated",
+	CodeForbidden:       "forbidden",
+	CodeNotFound:        "not_found",
+	CodeRateLimited:     "rate_limited",
+	CodeQuotaExceeded:   "quota_exceeded",
+	CodeUnavailable:     "unavailable",
+}
+
+// String возвращает имя кода для текстовых протоколов (WebSocket и т.п.).
+func (c Code) String() string {
+	if name, exists := codeNames[c]; exists {
+		return name
+	}
+	return "unknown"
+}
+
+var (
+	ErrMissingParams = errors.New("отсутствуют параметры")
+	ErrUserNotFound  = errors.New("пользователь не найден")
+	ErrWrongFile     = errors.New("неверный fileID файла для данного токена")
+	ErrNoChannel     = errors.New("канал для файла не существует")
+)
+
+// Error - ошибка приема с кодом, общим для всех протоколов.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func fail(code Code, err error) error {
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf возвращает код ошибки приема, CodeUnavailable для прочих ошибок.
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnavailable
+}
+
+type Service struct {
+	app        *app.App
+	msgHandler *handler.MessageHandler
+	userRepo   *repository.UserRepository
+}
+
+func NewService(application *app.App, msgHandler *handler.MessageHandler, userRepo *repository.UserRepository) *Service {
+	return &Service{
+		app:        application,
+		msgHandler: msgHandler,
+		userRepo:   userRepo,
+	}
+}
+
+// NewUser - параметры добавляемого пользователя в том виде, в котором они
+// пришли от клиента. Тенант клиент не выбирает: он определяется по токену
+// из настроек (см. app.App.TenantOf).
+type NewUser struct {
+	Token  string
+	FileID string
+}
+
+func (s *Service) AddUser(ctx context.Context, u NewUser) (types.User, error) {
+	if u.Token == "" || u.FileID == "" {
+		return types.User{}, fail(CodeInvalidArgument, ErrMissingParams)
+	}
+
+	fileID, err := fileid.Normalize(u.FileID)
+	if err != nil {
+		return types.User{}, fail(CodeInvalidArgument, err)
+	}
+
+	// тенант необязателен, без него файл создается в корне каталога файлов
+	tenant := s.app.TenantOf(u.Token)
+	if tenant != "" {
+		if tenant, err = fileid.Normalize(tenant); err != nil {
+			return types.User{}, fail(CodeInvalidArgument, fmt.Errorf("недопустимый тенант в настройках: %w", err))
+		}
+	}
+
+	user := types.User{
+		Token:  u.Token,
+		FileID: fileID,
+		Tenant: tenant,
+	}
+
+	log := logger.FromContext(ctx)
+	log.Info("добавление пользователя", logger.KeyToken, user.Token, logger.KeyFileID, fileID, "tenant", tenant)
+	if err := s.app.AddUser(user); err != nil {
+		if errors.Is(err, app.ErrTenantQuota) {
+			return types.User{}, fail(CodeForbidden, err)
+		}
+		return types.User{}, fail(CodeInvalidArgument, err)
+	}
+
+	return user, nil
+}
+
+// Authorize проверяет, что токен действителен и принадлежит пользователю
+// файла rawFileID. Протоколы с соединениями вызывают его один раз при
+// подключении, SendMessage - для каждого сообщения.
+func (s *Service) Authorize(ctx context.Context, token, rawFileID string) (types.User, error) {
+	if token == "" || rawFileID == "" {
+		return types.User{}, fail(CodeInvalidArgument, ErrMissingParams)
+	}
+
+	fileID, err := fileid.Normalize(rawFileID)
+	if err != nil {
+		return types.User{}, fail(CodeInvalidArgument, err)
+	}
+
+	if err := s.msgHandler.CheckToken(token); err != nil {
+		logger.FromContext(ctx).Warn("недействительный токен", logger.KeyToken, token, logger.KeyFileID, fileID)
+		return types.User{}, fail(CodeUnauthenticated, errors.New("недействительный токен"))
+	}
+
+	user, exists := s.userRepo.GetUserByToken(token)
+	if !exists {
+		return types.User{}, fail(CodeUnauthenticated, ErrUserNotFound)
+	}
+
+	if user.FileID != fileID {
+		return types.User{}, fail(CodeInvalidArgument, ErrWrongFile)
+	}
+
+	return user, nil
+}
+
+// SendMessage проверяет сообщение и ставит его в очередь. Возвращает принятое
+// сообщение, FileID в нем - идентификатор файла с учетом тенанта.
+func (s *Service) SendMessage(ctx context.Context, token, rawFileID, data string) (types.Message, error) {
+	if token == "" || rawFileID == "" || data == "" {
+		return types.Message{}, fail(CodeInvalidArgument, ErrMissingParams)
+	}
+
+	user, err := s.Authorize(ctx, token, rawFileID)
+	if err != nil {
+		return types.Message{}, err
+	}
+
+	// fileID уникален в пределах тенанта пользователя
+	msg := types.Message{
+		ID:     logger.NewID(),
+		Token:  token,
+		FileID: types.FileKey(user.Tenant, user.FileID),
+		Data:   data,
+	}
+	tracing.Inject(ctx, &msg)
+	log := logger.FromContext(ctx).With(logger.KeyMsgID, msg.ID)
+	log.Debug("добавление сообщения", "msg", msg)
+
+	if _, exists := s.app.GetFileCh(msg.FileID); !exists {
+		return types.Message{}, fail(CodeInvalidArgument, ErrNoChannel)
+	}
+
+	if err := s.msgHandler.HandleMessage(msg); err != nil {
+		switch {
+		case errors.Is(err, handler.ErrRateLimited):
+			return types.Message{}, fail(CodeRateLimited, err)
+		case errors.Is(err, schema.ErrInvalid):
+			return types.Message{}, fail(CodeInvalidArgument, err)
+		case errors.Is(err, quota.ErrExceeded):
+			log.Warn("превышена квота", logger.KeyFileID, msg.FileID, logger.KeyError, err)
+			return types.Message{}, fail(CodeQuotaExceeded, err)
+		default:
+			log.Warn("сообщение не принято", logger.KeyFileID, msg.FileID, logger.KeyError, err)
+			return types.Message{}, fail(CodeUnavailable, err)
+		}
+	}
+
+	log.Info("сообщение добавлено", logger.KeyFileID, msg.FileID)
+	return msg, nil
+}
+
+// Authenticate возвращает пользователя по токену.
+func (s *Service) Authenticate(token string) (types.User, error) {
+	user, exists := s.userRepo.GetUserByToken(token)
+	if !exists {
+		return types.User{}, fail(CodeUnauthenticated, ErrUserNotFound)
+	}
+	return user, nil
+}
+
+// QuotaWarning сообщает, превышена ли мягкая квота файла или пользователя.
+func (s *Service) QuotaWarning(msg types.Message) bool {
+	usage := s.app.Usage(msg.Token, msg.FileID)
+	return usage.File.OverSoft || usage.User.OverSoft
+}
+
+// QueueLoad возвращает заполненность общей очереди приложения (от 0 до 1),
+// по которой протоколы с длительными соединениями регулируют поток сообщений.
+func (s *Service) QueueLoad() float64 {
+	return s.app.QueueLoad()
+}
@@ -0,0 +1,134 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+)
+
+const (
+	ExitOK        = 0
+	ExitUnflushed = 1 // часть данных не была записана в файлы
+	ExitFailure   = 2 // сервер не смог запуститься или остановиться
+)
+
+type Application interface {
+	Start(ctx context.Context) app.ShutdownReport
+}
+
+// Listener - дополнительный сервер приема сообщений (gRPC и т.п.),
+// который запускается и останавливается вместе с HTTP-сервером.
+type Listener interface {
+	Name() string
+	// Serve блокируется до остановки, после Shutdown возвращает nil
+	Serve() error
+	Shutdown(ctx context.Context) error
+}
+
+// Manager управляет запуском и согласованной остановкой HTTP-сервера и приложения.
+type Manager struct {
+	server      *http.Server
+	listeners   []Listener
+	app         Application
+	gracePeriod time.Duration
+}
+
+func NewManager(server *http.Server, application Application, gracePeriod time.Duration) *Manager {
+	return &Manager{
+		server:      server,
+		app:         application,
+		gracePeriod: gracePeriod,
+	}
+}
+
+func (m *Manager) AddListener(l Listener) {
+	m.listeners = append(m.listeners, l)
+}
+
+// Run запускает сервер и приложение и блокируется до отмены ctx.
+// Остановка выполняется в порядке: прекращение приема запросов -> ожидание
+// обрабатываемых запросов -> сброс данных приложения. Возвращает код выхода
+// процесса - наихудший из результатов всех этапов.
+func (m *Manager) Run(ctx context.Context) int {
+	serverErr := make(chan error, 1+len(m.listeners))
+	go func() {
+		slog.Info("сервер запущен", "addr", m.server.Addr)
+		if err := m.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+	for _, l := range m.listeners {
+		go func() {
+			if err := l.Serve(); err != nil {
+				serverErr <- fmt.Errorf("%s: %w", l.Name(), err)
+			}
+		}()
+	}
+
+	// приложение останавливается отдельно от сервера, только после завершения запросов
+	appCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	reportCh := make(chan app.ShutdownReport, 1)
+	go func() {
+		reportCh <- m.app.Start(appCtx)
+	}()
+
+	code := ExitOK
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		slog.Error("не удалось запустить сервер", logger.KeyError, err)
+		code = ExitFailure
+	}
+
+	slog.Info("завершение работы сервера")
+
+	shutdownCtx := context.Background()
+	if m.gracePeriod > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, m.gracePeriod)
+		defer cancel()
+	}
+
+	if err := m.server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("ошибка завершения работы сервера", logger.KeyError, err)
+		m.server.Close()
+		code = ExitFailure
+	}
+	for _, l := range m.listeners {
+		if err := l.Shutdown(shutdownCtx); err != nil {
+			slog.Error("ошибка завершения работы сервера", "listener", l.Name(), logger.KeyError, err)
+			code = ExitFailure
+		}
+	}
+
+	stopApp()
+
+	select {
+	case report := <-reportCh:
+		if report.Total() > 0 {
+			slog.Error("приложение остановлено, часть сообщений не записана", "unflushed", report.Total())
+			code = max(code, ExitUnflushed)
+		} else if report.TimedOut {
+			// незавершенная запись не попадает в отчет, ее результат неизвестен
+			slog.Error("остановка приложения не уложилась в отведенное время, часть данных могла не записаться")
+			code = max(code, ExitUnflushed)
+		}
+	case <-shutdownCtx.Done():
+		slog.Error("истек период ожидания остановки, часть данных могла не записаться")
+		code = max(code, ExitUnflushed)
+	}
+
+	if code == ExitOK {
+		slog.Info("сервер успешно завершил работу")
+	}
+
+	return code
+}
@@ -0,0 +1,142 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+)
+
+type fakeApp struct {
+	report    app.ShutdownReport
+	handlerOK *atomic.Bool
+	stoppedOK atomic.Bool
+}
+
+func (f *fakeApp) Start(ctx context.Context) app.ShutdownReport {
+	<-ctx.Done()
+	// приложение должно останавливаться только после завершения обрабатываемых запросов
+	f.stoppedOK.Store(f.handlerOK.Load())
+	return f.report
+}
+
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("не удалось получить свободный порт: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// Проверяет порядок остановки: сначала дожидаемся запросов, затем останавливаем приложение.
+func TestRunWaitsForInFlightRequests(t *testing.T) {
+	var handlerOK atomic.Bool
+	started := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		handlerOK.Store(true)
+	})
+
+	addr := freeAddr(t)
+	application := &fakeApp{handlerOK: &handlerOK}
+	manager := NewManager(&http.Server{Addr: addr, Handler: mux}, application, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	codeCh := make(chan int)
+	go func() {
+		codeCh <- manager.Run(ctx)
+	}()
+
+	respCh := make(chan error)
+	go func() {
+		for i := 0; i < 50; i++ {
+			resp, err := http.Get("http://" + addr + "/slow")
+			if err == nil {
+				resp.Body.Close()
+				respCh <- nil
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		respCh <- net.ErrClosed
+	}()
+
+	<-started
+	cancel()
+
+	if err := <-respCh; err != nil {
+		t.Fatalf("обрабатываемый запрос не завершился: %v", err)
+	}
+	if code := <-codeCh; code != ExitOK {
+		t.Fatalf("Ожидался код выхода %d, получено: %d", ExitOK, code)
+	}
+	if !application.stoppedOK.Load() {
+		t.Fatalf("приложение остановлено до завершения обрабатываемого запроса")
+	}
+}
+
+// Проверяет ненулевой код выхода, если часть данных не была записана.
+func TestRunReportsUnflushed(t *testing.T) {
+	var handlerOK atomic.Bool
+	application := &fakeApp{
+		handlerOK: &handlerOK,
+		report:    app.ShutdownReport{Unflushed: map[string]int{"file1": 3}},
+	}
+	manager := NewManager(&http.Server{Addr: freeAddr(t)}, application, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if code := manager.Run(ctx); code != ExitUnflushed {
+		t.Fatalf("Ожидался код выхода %d, получено: %d", ExitUnflushed, code)
+	}
+}
+
+type failingListener struct{}
+
+func (failingListener) Name() string                       { return "failing" }
+func (failingListener) Serve() error                       { return errors.New("адрес занят") }
+func (failingListener) Shutdown(ctx context.Context) error { return nil }
+
+// Проверяет, что код выхода - наихудший из результатов остановки, а
+// превышение времени остановки считается потерей данных.
+func TestRunKeepsWorstExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		report   app.ShutdownReport
+		failing  bool
+		expected int
+	}{
+		{"превышено время остановки", app.ShutdownReport{TimedOut: true}, false, ExitUnflushed},
+		{"ошибка сервера и незаписанные данные", app.ShutdownReport{Unflushed: map[string]int{"file1": 1}}, true, ExitFailure},
+		{"ошибка сервера и превышено время", app.ShutdownReport{TimedOut: true}, true, ExitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handlerOK atomic.Bool
+			application := &fakeApp{handlerOK: &handlerOK, report: tt.report}
+			manager := NewManager(&http.Server{Addr: freeAddr(t)}, application, time.Second)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.failing {
+				// остановка начинается из-за ошибки сервера, а не отмены ctx
+				manager.AddListener(failingListener{})
+			} else {
+				cancel()
+			}
+
+			if code := manager.Run(ctx); code != tt.expected {
+				t.Fatalf("Ожидался код выхода %d, получено: %d", tt.expected, code)
+			}
+		})
+	}
+}
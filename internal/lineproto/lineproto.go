@@ -0,0 +1,373 @@
+// Package lineproto - прием сообщений по TCP и Unix-сокету для инструментов,
+// которые умеют только писать текст построчно. Первая строка соединения -
+// приветствие "<token> <fileID>", на которое сервер отвечает "OK" или
+// "ERR <код> <описание>" с закрытием соединения. Каждая следующая непустая
+// строка становится сообщением. Ответов на сообщения нет, только "ERR ..."
+// для отклоненных строк; при превышении лимита скорости сервер перестает
+// читать соединение до истечения ожидания, а не отклоняет строки.
+package lineproto
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+const replyTimeout = time.Second
+
+var ErrHandshake = errors.New("ожидается приветствие: <token> <fileID>")
+
+// Server принимает соединения на адресах из конфигурации.
+type Server struct {
+	svc *ingest.Service
+	cfg *config.Config
+
+	mutex     sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	closing   bool
+	done      chan struct{} // закрывается в Shutdown, прерывает ожидание лимита
+	wg        sync.WaitGroup
+}
+
+func NewServer(svc *ingest.Service, cfg *config.Config) *Server {
+	return &Server{
+		svc:   svc,
+		cfg:   cfg,
+		conns: make(map[net.Conn]struct{}),
+		done:  make(chan struct{}),
+	}
+}
+
+// Enabled сообщает, задан ли в конфигурации хотя бы один адрес.
+func Enabled(cfg *config.Config) bool {
+	return cfg.LineTCPAddr != "" || cfg.LineUnixSocket != ""
+}
+
+// LoadTLSConfig загружает сертификат и ключ из локальных файлов.
+func LoadTLSConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось загрузить сертификат TLS: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+func (s *Server) Name() string {
+	return "line"
+}
+
+// Serve открывает TCP-адрес и Unix-сокет из конфигурации и принимает на них
+// соединения до Shutdown.
+func (s *Server) Serve() error {
+	listeners, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		go func() {
+			errs <- s.ServeListener(lis)
+		}()
+	}
+	for range listeners {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) listen() ([]net.Listener, error) {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, lis := range listeners {
+			lis.Close()
+		}
+	}
+
+	if s.cfg.LineTCPAddr != "" {
+		lis, err := net.Listen("tcp", s.cfg.LineTCPAddr)
+		if err != nil {
+			return nil, err
+		}
+		if s.cfg.LineTLSCertFile != "" || s.cfg.LineTLSKeyFile != "" {
+			tlsConfig, err := LoadTLSConfig(s.cfg.LineTLSCertFile, s.cfg.LineTLSKeyFile)
+			if err != nil {
+				lis.Close()
+				return nil, err
+			}
+			lis = tls.NewListener(lis, tlsConfig)
+		}
+		listeners = append(listeners, lis)
+	}
+
+	if s.cfg.LineUnixSocket != "" {
+		if err := removeStaleSocket(s.cfg.LineUnixSocket); err != nil {
+			closeAll()
+			return nil, err
+		}
+		lis, err := net.Listen("unix", s.cfg.LineUnixSocket)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, lis)
+	}
+
+	return listeners, nil
+}
+
+// removeStaleSocket удаляет сокет, оставшийся от процесса, завершенного без
+// остановки. Файл другого типа не удаляется: путь мог быть указан по ошибке.
+// Сокет удаляется, только если к нему нельзя подключиться: иначе его слушает
+// другой запущенный процесс.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s уже существует и не является сокетом", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s: %w", path, syscall.EADDRINUSE)
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// ServeListener принимает соединения на lis до Shutdown.
+func (s *Server) ServeListener(lis net.Listener) error {
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		lis.Close()
+		return nil
+	}
+	s.listeners = append(s.listeners, lis)
+	s.mutex.Unlock()
+
+	slog.Info("построчный сервер запущен", "addr", lis.Addr().String())
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			closing := s.closing
+			s.mutex.Unlock()
+			if closing {
+				return nil
+			}
+			return err
+		}
+		if !s.track(conn) {
+			conn.Close()
+			continue
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown перестает принимать соединения, прерывает чтение открытых и
+// ждет, пока будут переданы уже прочитанные строки.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	if !s.closing {
+		s.closing = true
+		close(s.done)
+	}
+	for _, lis := range s.listeners {
+		lis.Close()
+	}
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mutex.Unlock()
+
+	waited := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mutex.Lock()
+	delete(s.conns, conn)
+	s.mutex.Unlock()
+	s.wg.Done()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	ctx := logger.WithRequestID(context.Background(), logger.NewID())
+	log := logger.FromContext(ctx).With("remote", conn.RemoteAddr().String())
+
+	scanner := bufio.NewScanner(conn)
+	if s.cfg.LineMaxBytes > 0 {
+		scanner.Buffer(make([]byte, 0, min(s.cfg.LineMaxBytes, 4096)), s.cfg.LineMaxBytes)
+	}
+
+	s.setDeadline(conn, s.cfg.LineHandshakeTimeout)
+	if !scanner.Scan() {
+		log.Warn("соединение закрыто до приветствия", logger.KeyError, scanner.Err())
+		return
+	}
+	token, rawFileID, ok := parseHandshake(scanner.Text())
+	if !ok {
+		reply(conn, "ERR %s %s", ingest.CodeInvalidArgument, ErrHandshake)
+		return
+	}
+	user, err := s.svc.Authorize(ctx, token, rawFileID)
+	if err != nil {
+		log.Warn("приветствие отклонено", logger.KeyError, err)
+		reply(conn, "ERR %s %s", ingest.CodeOf(err), err)
+		return
+	}
+	reply(conn, "OK")
+
+	log = log.With(logger.KeyFileID, types.FileKey(user.Tenant, user.FileID))
+	log.Info("построчное соединение установлено")
+
+	lines := 0
+	for {
+		s.setDeadline(conn, s.cfg.LineIdleTimeout)
+		if !scanner.Scan() {
+			break
+		}
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := s.send(ctx, token, user.FileID, line); err != nil {
+			if ingest.CodeOf(err) == ingest.CodeUnavailable {
+				log.Warn("прием остановлен, соединение закрывается", logger.KeyError, err)
+				reply(conn, "ERR %s %s", ingest.CodeUnavailable, err)
+				return
+			}
+			reply(conn, "ERR %s %s", ingest.CodeOf(err), err)
+			continue
+		}
+		lines++
+	}
+
+	if err := scanner.Err(); err != nil && !s.stopping() {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			log.Info("соединение закрыто по таймауту", "lines", lines)
+			return
+		}
+		if errors.Is(err, bufio.ErrTooLong) {
+			reply(conn, "ERR %s строка длиннее %d байт", ingest.CodeInvalidArgument, s.cfg.LineMaxBytes)
+		}
+		log.Warn("ошибка чтения соединения", "lines", lines, logger.KeyError, err)
+		return
+	}
+	log.Info("построчное соединение закрыто", "lines", lines)
+}
+
+// send передает строку как сообщение. При превышении лимита скорости строка
+// не отбрасывается: чтение соединения приостанавливается до разрешения.
+func (s *Server) send(ctx context.Context, token, fileID, line string) error {
+	for {
+		_, err := s.svc.SendMessage(ctx, token, fileID, line)
+		var rateErr *handler.RateLimitError
+		if !errors.As(err, &rateErr) {
+			return err
+		}
+
+		select {
+		case <-time.After(rateErr.RetryAfter):
+		case <-s.done:
+			return err
+		}
+	}
+}
+
+func (s *Server) stopping() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// setDeadline ограничивает ожидание следующей строки. Во время остановки
+// срок не продлевается, чтобы не отменить прерывание из Shutdown.
+func (s *Server) setDeadline(conn net.Conn, timeout time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closing {
+		return
+	}
+	if timeout <= 0 {
+		conn.SetReadDeadline(time.Time{})
+		return
+	}
+	conn.SetReadDeadline(time.Now().Add(timeout))
+}
+
+func parseHandshake(line string) (token, fileID string, ok bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return "", "", false
+	}
+	return fields[0], fields[1], true
+}
+
+// reply отправляет клиенту строку ответа. Клиент может не читать ответы,
+// поэтому запись ограничена по времени, а ошибка игнорируется.
+func reply(conn net.Conn, format string, args ...any) {
+	conn.SetWriteDeadline(time.Now().Add(replyTimeout))
+	fmt.Fprintf(conn, format+"\n", args...)
+}
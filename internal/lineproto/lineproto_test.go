@@ -0,0 +1,337 @@
+package lineproto
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+func setupConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		ValidTokens:          []string{"valid_token_1", "valid_token_2"},
+		WorkerInterval:       100 * time.Millisecond,
+		FilesDir:             t.TempDir(),
+		NumWorkers:           1,
+		MaxRetries:           3,
+		RetryInterval:        100 * time.Millisecond,
+		LineMaxBytes:         1024,
+		LineHandshakeTimeout: time.Second,
+	}
+}
+
+// setup запускает приложение с пользователем valid_token_1 (файл file1)
+// и возвращает сервер, который еще не принимает соединения.
+func setup(t *testing.T, cfg *config.Config) *Server {
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := app.NewApp(cfg, &types.DefaultFileWriter{}, userRepo)
+	msgHandler := handler.NewMessageHandler(userRepo, application, cfg)
+	svc := ingest.NewService(application, msgHandler, userRepo)
+	if _, err := svc.AddUser(context.Background(), ingest.NewUser{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+
+	server := NewServer(svc, cfg)
+	t.Cleanup(func() {
+		server.Shutdown(context.Background())
+		cancel()
+		<-done
+	})
+	return server
+}
+
+// serveTCP принимает соединения на свободном порту localhost.
+func serveTCP(t *testing.T, server *Server, tlsConfig *tls.Config) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig != nil {
+		lis = tls.NewListener(lis, tlsConfig)
+	}
+	go server.ServeListener(lis)
+	return lis.Addr().String()
+}
+
+func handshake(t *testing.T, conn net.Conn, line string) (*bufio.Reader, string) {
+	fmt.Fprintln(conn, line)
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("не удалось прочитать ответ на приветствие: %v", err)
+	}
+	return r, strings.TrimSpace(reply)
+}
+
+// waitFile ждет, пока в файле окажутся ровно строки expected.
+func waitFile(t *testing.T, path string, expected []string) {
+	want := strings.Join(expected, "\n") + "\n"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if string(data) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ожидалось содержимое файла %q, получено %q", want, data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	server := setup(t, setupConfig(t))
+	addr := serveTCP(t, server, nil)
+
+	tests := []struct {
+		name  string
+		line  string
+		reply string
+	}{
+		{"без fileID", "valid_token_1", "ERR invalid_argument"},
+		{"неизвестный токен", "invalid_token file1", "ERR unauthenticated"},
+		{"пользователь не добавлен", "valid_token_2 file1", "ERR unauthenticated"},
+		{"чужой файл", "valid_token_1 file2", "ERR invalid_argument"},
+		{"успешное приветствие", "valid_token_1 FILE1", "OK"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if _, reply := handshake(t, conn, tt.line); !strings.HasPrefix(reply, tt.reply) {
+				t.Errorf("ожидался ответ %q, получено %q", tt.reply, reply)
+			}
+		})
+	}
+}
+
+func TestLinesBecomeMessages(t *testing.T) {
+	cfg := setupConfig(t)
+	server := setup(t, cfg)
+	addr := serveTCP(t, server, nil)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	r, reply := handshake(t, conn, "valid_token_1 file1")
+	if reply != "OK" {
+		t.Fatalf("ожидался ответ OK, получено %q", reply)
+	}
+
+	// пустые строки пропускаются, CRLF допускается
+	fmt.Fprint(conn, "first\r\n\nsecond\n"+strings.Repeat("x", 2000)+"\n")
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if reply, _ := r.ReadString('\n'); !strings.HasPrefix(reply, "ERR invalid_argument") {
+		t.Errorf("для слишком длинной строки ожидался ERR invalid_argument, получено %q", reply)
+	}
+
+	waitFile(t, filepath.Join(cfg.FilesDir, "file1.txt"), []string{"first", "second"})
+}
+
+func TestTLS(t *testing.T) {
+	cfg := setupConfig(t)
+	cfg.LineTLSCertFile, cfg.LineTLSKeyFile = writeCert(t)
+	server := setup(t, cfg)
+
+	tlsConfig, err := LoadTLSConfig(cfg.LineTLSCertFile, cfg.LineTLSKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveTCP(t, server, tlsConfig)
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("не удалось установить TLS-соединение: %v", err)
+	}
+	defer conn.Close()
+	if _, reply := handshake(t, conn, "valid_token_1 file1"); reply != "OK" {
+		t.Fatalf("ожидался ответ OK, получено %q", reply)
+	}
+	fmt.Fprintln(conn, "secret")
+
+	waitFile(t, filepath.Join(cfg.FilesDir, "file1.txt"), []string{"secret"})
+}
+
+func TestUnixSocket(t *testing.T) {
+	cfg := setupConfig(t)
+	cfg.LineUnixSocket = filepath.Join(t.TempDir(), "line.sock")
+	// оставшийся от прошлого запуска файл сокета не мешает запуску
+	stale, err := net.Listen("unix", cfg.LineUnixSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+	server := setup(t, cfg)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve()
+	}()
+
+	var conn net.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var err error
+		if conn, err = net.Dial("unix", cfg.LineUnixSocket); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("не удалось подключиться к сокету: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer conn.Close()
+
+	if _, reply := handshake(t, conn, "valid_token_1 file1"); reply != "OK" {
+		t.Fatalf("ожидался ответ OK, получено %q", reply)
+	}
+	fmt.Fprintln(conn, "local")
+	waitFile(t, filepath.Join(cfg.FilesDir, "file1.txt"), []string{"local"})
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatalf("ошибка остановки: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve завершился с ошибкой: %v", err)
+	}
+}
+
+func TestRateLimitSlowsReading(t *testing.T) {
+	cfg := setupConfig(t)
+	// 20 сообщений в секунду, в корзине 2
+	cfg.TokenMessageRate = 20
+	cfg.RateLimitBurst = 0.1
+	server := setup(t, cfg)
+	addr := serveTCP(t, server, nil)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, reply := handshake(t, conn, "valid_token_1 file1"); reply != "OK" {
+		t.Fatalf("ожидался ответ OK, получено %q", reply)
+	}
+
+	// строки сверх лимита не отклоняются, а ждут своей очереди
+	var expected []string
+	for i := range 10 {
+		expected = append(expected, fmt.Sprintf("line %d", i))
+	}
+	start := time.Now()
+	fmt.Fprintln(conn, strings.Join(expected, "\n"))
+
+	waitFile(t, filepath.Join(cfg.FilesDir, "file1.txt"), expected)
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("ожидалось замедление приема лимитом, 10 строк приняты за %v", elapsed)
+	}
+}
+
+// writeCert создает самоподписанный сертификат для localhost.
+func writeCert(t *testing.T) (certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// Проверяет, что существующий файл, не являющийся сокетом, не удаляется.
+func TestUnixSocketKeepsRegularFile(t *testing.T) {
+	cfg := setupConfig(t)
+	cfg.LineUnixSocket = filepath.Join(t.TempDir(), "line.sock")
+	if err := os.WriteFile(cfg.LineUnixSocket, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	server := setup(t, cfg)
+
+	if err := server.Serve(); err == nil {
+		t.Fatal("ожидалась ошибка запуска")
+	}
+	if content, err := os.ReadFile(cfg.LineUnixSocket); err != nil || string(content) != "data" {
+		t.Fatalf("файл не должен изменяться: %q (%v)", content, err)
+	}
+}
+
+// Проверяет, что сокет запущенного процесса не удаляется.
+func TestUnixSocketKeepsLiveSocket(t *testing.T) {
+	cfg := setupConfig(t)
+	cfg.LineUnixSocket = filepath.Join(t.TempDir(), "line.sock")
+	live, err := net.Listen("unix", cfg.LineUnixSocket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	server := setup(t, cfg)
+
+	if err := server.Serve(); !errors.Is(err, syscall.EADDRINUSE) {
+		t.Fatalf("ожидалась ошибка %v, получено: %v", syscall.EADDRINUSE, err)
+	}
+	conn, err := net.Dial("unix", cfg.LineUnixSocket)
+	if err != nil {
+		t.Fatalf("сокет запущенного процесса удален: %v", err)
+	}
+	conn.Close()
+}
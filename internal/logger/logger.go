@@ -0,0 +1,129 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+)
+
+// Имена полей, которые используются во всех записях журнала.
+const (
+	KeyFileID    = "file_id"
+	KeyMsgID     = "msg_id"
+	KeyAttempt   = "attempt"
+	KeyRequestID = "request_id"
+	KeyToken     = "token"
+	KeyData      = "data"
+	KeyError     = "error"
+)
+
+const redacted = "[REDACTED]"
+
+// New создает логгер с уровнем и форматом из конфига. Токены и данные сообщений
+// скрываются, если в конфиге явно не включено логирование содержимого.
+func New(cfg *config.Config, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return nil, fmt.Errorf("неизвестный уровень логирования %q: %w", cfg.LogLevel, err)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactor(cfg.LogPayloads),
+	}
+
+	switch strings.ToLower(cfg.LogFormat) {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("неизвестный формат логирования %q", cfg.LogFormat)
+	}
+}
+
+func redactor(logPayloads bool) func(groups []string, attr slog.Attr) slog.Attr {
+	return func(_ []string, attr slog.Attr) slog.Attr {
+		if logPayloads {
+			return attr
+		}
+
+		switch attr.Key {
+		case KeyToken:
+			return slog.String(KeyToken, redacted)
+		case KeyData:
+			return slog.String(KeyData, fmt.Sprintf("%s len=%d", redacted, len(attr.Value.String())))
+		}
+		return attr
+	}
+}
+
+type ctxKey struct{}
+
+// WithRequestID сохраняет в контексте логгер, дополненный идентификатором запроса.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, FromContext(ctx).With(KeyRequestID, requestID))
+}
+
+// FromContext возвращает логгер запроса или логгер по умолчанию.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+		return l
+	}
+	return slog.Default()
+}
+
+func NewID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap открывает исходный ResponseWriter для http.ResponseController
+// (Hijack при переходе на WebSocket, Flush и т.п.).
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// HTTPMiddleware присваивает запросу идентификатор (или берет его из X-Request-ID),
+// кладет в контекст логгер с этим идентификатором и логирует итог запроса.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = NewID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		ctx := WithRequestID(r.Context(), requestID)
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		FromContext(ctx).Debug("запрос обработан",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", sw.status,
+			"duration", time.Since(start),
+		)
+	})
+}
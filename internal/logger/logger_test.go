@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+)
+
+type payload struct{ token, data string }
+
+func (p payload) LogValue() slog.Value {
+	return slog.GroupValue(slog.String(KeyToken, p.token), slog.String(KeyData, p.data))
+}
+
+// Проверяет, что токены и данные скрываются, в том числе во вложенных группах.
+func TestRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&config.Config{LogLevel: "info", LogFormat: "json"}, &buf)
+	if err != nil {
+		t.Fatalf("не удалось создать логгер: %v", err)
+	}
+
+	l.Info("test", KeyToken, "secret_token", "msg", payload{token: "secret_token", data: "secret_data"})
+
+	out := buf.String()
+	if strings.Contains(out, "secret") {
+		t.Fatalf("в журнал попали скрываемые данные: %s", out)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("ожидался JSON: %v", err)
+	}
+	if record[KeyToken] != redacted {
+		t.Errorf("Ожидался скрытый токен, получено: %v", record[KeyToken])
+	}
+}
+
+// Проверяет вывод содержимого при явно включенном логировании данных.
+func TestPayloadLogging(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&config.Config{LogLevel: "debug", LogFormat: "text", LogPayloads: true}, &buf)
+	if err != nil {
+		t.Fatalf("не удалось создать логгер: %v", err)
+	}
+
+	l.Debug("test", "msg", payload{token: "t1", data: "hello"})
+
+	if out := buf.String(); !strings.Contains(out, "msg.data=hello") || !strings.Contains(out, "msg.token=t1") {
+		t.Fatalf("ожидалось содержимое сообщения в журнале: %s", out)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := New(&config.Config{LogLevel: "info", LogFormat: "xml"}, &bytes.Buffer{}); err == nil {
+		t.Fatalf("ожидалась ошибка для неизвестного формата")
+	}
+}
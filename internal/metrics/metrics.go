@@ -0,0 +1,286 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// OverflowValue подставляется во все метки серии, когда у метрики
+// превышен лимит количества различных наборов меток.
+const OverflowValue = "__overflow__"
+
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10}
+
+// Default - реестр, в котором регистрируются метрики конвейера.
+var Default = NewRegistry()
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry хранит метрики и отдает их в текстовом формате Prometheus.
+type Registry struct {
+	mutex      sync.Mutex
+	metrics    []metric
+	hooks      []func()
+	labelLimit int
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// SetLabelLimit ограничивает количество серий у каждой метрики с метками (0 - без ограничения).
+func (r *Registry) SetLabelLimit(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.labelLimit = n
+}
+
+func (r *Registry) limit() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.labelLimit
+}
+
+// OnScrape регистрирует функцию, которая вызывается перед каждой выгрузкой
+// метрик. Используется для снятия значений, которые дешевле прочитать по запросу.
+func (r *Registry) OnScrape(fn func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.hooks = append(r.hooks, fn)
+}
+
+func (r *Registry) register(m metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	hooks := append([]func(){}, r.hooks...)
+	metrics := append([]metric{}, r.metrics...)
+	r.mutex.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // только для гистограмм, по одному на бакет
+	count       uint64
+}
+
+// family - общая часть всех метрик: имя, описание, метки и набор серий.
+type family struct {
+	reg        *Registry
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	buckets    []float64
+	mutex      sync.Mutex
+	series     map[string]*series
+}
+
+func (r *Registry) newFamily(name, help, typ string, buckets []float64, labelNames []string) *family {
+	f := &family{
+		reg:        r,
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labelNames,
+		buckets:    buckets,
+		series:     make(map[string]*series),
+	}
+	r.register(f)
+	return f
+}
+
+// get возвращает серию для набора меток. Вызывающий должен удерживать f.mutex.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metrics: %s ожидает %d меток, передано %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	if s, exists := f.series[key]; exists {
+		return s
+	}
+
+	if limit := f.reg.limit(); limit > 0 && len(labelValues) > 0 && len(f.series) >= limit {
+		labelValues = make([]string, len(f.labelNames))
+		for i := range labelValues {
+			labelValues[i] = OverflowValue
+		}
+		key = strings.Join(labelValues, "\xff")
+		if s, exists := f.series[key]; exists {
+			return s
+		}
+	}
+
+	s := &series{labelValues: append([]string{}, labelValues...)}
+	if f.buckets != nil {
+		s.counts = make([]uint64, len(f.buckets))
+	}
+	f.series[key] = s
+	return s
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.typ != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labels(s.labelValues, ""), formatFloat(s.value))
+			continue
+		}
+
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labels(s.labelValues, formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labels(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labels(s.labelValues, ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labels(s.labelValues, ""), s.count)
+	}
+}
+
+func (f *family) labels(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range f.labelNames {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(escape(values[i]))
+		sb.WriteByte('"')
+	}
+	if le != "" {
+		if len(values) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(`le="`)
+		sb.WriteString(le)
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type CounterVec struct{ f *family }
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{f: r.newFamily(name, help, "counter", nil, labelNames)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	c.f.mutex.Lock()
+	defer c.f.mutex.Unlock()
+	c.f.get(labelValues).value += v
+}
+
+type GaugeVec struct{ f *family }
+
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{f: r.newFamily(name, help, "gauge", nil, labelNames)}
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.f.mutex.Lock()
+	defer g.f.mutex.Unlock()
+	g.f.get(labelValues).value = v
+}
+
+// Add увеличивает значение серии. При снятии значений по запросу позволяет
+// суммировать в серию переполнения все наборы меток сверх лимита.
+func (g *GaugeVec) Add(v float64, labelValues ...string) {
+	g.f.mutex.Lock()
+	defer g.f.mutex.Unlock()
+	g.f.get(labelValues).value += v
+}
+
+// Reset удаляет все серии, например перед повторным снятием значений по запросу.
+func (g *GaugeVec) Reset() {
+	g.f.mutex.Lock()
+	defer g.f.mutex.Unlock()
+	g.f.series = make(map[string]*series)
+}
+
+type HistogramVec struct{ f *family }
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	return &HistogramVec{f: r.newFamily(name, help, "histogram", buckets, labelNames)}
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.f.mutex.Lock()
+	defer h.f.mutex.Unlock()
+
+	s := h.f.get(labelValues)
+	for i, bound := range h.f.buckets {
+		if v <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.value += v
+}
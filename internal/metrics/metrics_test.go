@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, reg *Registry) string {
+	var buf bytes.Buffer
+	if err := reg.Write(&buf); err != nil {
+		t.Fatalf("не удалось выгрузить метрики: %v", err)
+	}
+	return buf.String()
+}
+
+func expectLines(t *testing.T, out string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Ожидалась строка %q в выгрузке:\n%s", line, out)
+		}
+	}
+}
+
+// Проверяет текстовый формат счетчиков, гистограмм и экранирование меток.
+func TestTextFormat(t *testing.T) {
+	reg := NewRegistry()
+	counter := reg.NewCounterVec("test_total", "Счетчик", "file_id")
+	hist := reg.NewHistogramVec("test_seconds", "Гистограмма", []float64{0.1, 1})
+	gauge := reg.NewGaugeVec("test_depth", "Глубина")
+
+	counter.Inc("a\"b")
+	counter.Add(2, "c")
+	hist.Observe(0.05)
+	hist.Observe(0.5)
+	hist.Observe(5)
+	reg.OnScrape(func() { gauge.Set(7) })
+
+	expectLines(t, render(t, reg),
+		"# TYPE test_total counter",
+		`test_total{file_id="a\"b"} 1`,
+		`test_total{file_id="c"} 2`,
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{le="0.1"} 1`,
+		`test_seconds_bucket{le="1"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		"test_seconds_sum 5.55",
+		"test_seconds_count 3",
+		"test_depth 7",
+	)
+}
+
+// Проверяет, что серии сверх лимита сворачиваются в одну серию переполнения.
+func TestLabelLimit(t *testing.T) {
+	reg := NewRegistry()
+	reg.SetLabelLimit(2)
+	gauge := reg.NewGaugeVec("test_cache", "Кеш", "file_id")
+
+	for _, fileID := range []string{"f1", "f2", "f3", "f4"} {
+		gauge.Add(1, fileID)
+	}
+
+	out := render(t, reg)
+	expectLines(t, out,
+		`test_cache{file_id="f1"} 1`,
+		`test_cache{file_id="f2"} 1`,
+		`test_cache{file_id="`+OverflowValue+`"} 2`,
+	)
+	if strings.Contains(out, `"f3"`) {
+		t.Errorf("серия сверх лимита не должна выгружаться:\n%s", out)
+	}
+}
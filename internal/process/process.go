@@ -0,0 +1,273 @@
+// Package process - обработка данных сообщений перед постановкой в очередь:
+// фильтры по регулярным выражениям, скрытие персональных данных, префикс по
+// шаблону и обрезка. Цепочка обработчиков задается для каждого файла.
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/fileid"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+// Типы обработчиков в конфигурации.
+const (
+	TypeDrop     = "drop"
+	TypeKeep     = "keep"
+	TypeRedact   = "redact"
+	TypePrefix   = "prefix"
+	TypeTruncate = "truncate"
+)
+
+// Готовые шаблоны скрытия.
+const (
+	PresetEmail = "email"
+	PresetCard  = "card"
+)
+
+const defaultMask = "***"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// 13-19 цифр, допускаются пробелы и дефисы между группами
+	cardPattern = regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`)
+)
+
+// Processor изменяет данные сообщения. false - сообщение отбрасывается.
+type Processor interface {
+	Process(msg *types.Message, now time.Time) bool
+}
+
+// Chain применяет обработчики по порядку, пока сообщение не отброшено.
+type Chain []Processor
+
+func (c Chain) Process(msg *types.Message, now time.Time) bool {
+	for _, p := range c {
+		if !p.Process(msg, now) {
+			return false
+		}
+	}
+	return true
+}
+
+// New создает обработчик по описанию из конфигурации.
+func New(cfg config.ProcessorConfig) (Processor, error) {
+	switch cfg.Type {
+	case TypeDrop, TypeKeep:
+		if cfg.Pattern == "" {
+			return nil, fmt.Errorf("%s: нужен Pattern", cfg.Type)
+		}
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", cfg.Type, err)
+		}
+		return &Filter{Pattern: re, Keep: cfg.Type == TypeKeep}, nil
+	case TypeRedact:
+		return newRedact(cfg)
+	case TypePrefix:
+		tmpl, err := template.New("prefix").Option("missingkey=error").Parse(cfg.Template)
+		if err != nil {
+			return nil, fmt.Errorf("prefix: %w", err)
+		}
+		return &Prefix{Template: tmpl}, nil
+	case TypeTruncate:
+		if cfg.MaxBytes <= 0 {
+			return nil, fmt.Errorf("truncate: MaxBytes должен быть больше 0")
+		}
+		return &Truncate{MaxBytes: cfg.MaxBytes, Suffix: cfg.Replace}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный тип обработчика %q", cfg.Type)
+	}
+}
+
+// NewChain создает цепочку в порядке конфигурации.
+func NewChain(cfgs []config.ProcessorConfig) (Chain, error) {
+	chain := make(Chain, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		p, err := New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("обработчик %d: %w", i+1, err)
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+// Pipeline - цепочки обработчиков по идентификатору файла (types.FileKey).
+type Pipeline struct {
+	chains map[string]Chain
+}
+
+// NewPipeline создает цепочки для всех файлов из конфигурации.
+func NewPipeline(cfg map[string][]config.ProcessorConfig) (*Pipeline, error) {
+	p := &Pipeline{chains: make(map[string]Chain, len(cfg))}
+	for fileID, cfgs := range cfg {
+		if err := fileid.ValidateKey(fileID); err != nil {
+			return nil, fmt.Errorf("файл %s: %w", fileID, err)
+		}
+		chain, err := NewChain(cfgs)
+		if err != nil {
+			return nil, fmt.Errorf("файл %s: %w", fileID, err)
+		}
+		if len(chain) > 0 {
+			p.chains[fileID] = chain
+		}
+	}
+	return p, nil
+}
+
+// Process применяет цепочку файла сообщения. Сообщения файлов без цепочки
+// и nil Pipeline не меняются.
+func (p *Pipeline) Process(msg *types.Message, now time.Time) bool {
+	if p == nil {
+		return true
+	}
+	chain, exists := p.chains[msg.FileID]
+	if !exists {
+		return true
+	}
+	return chain.Process(msg, now)
+}
+
+// Filter отбрасывает сообщения, данные которых подходят под Pattern, или,
+// если Keep, - не подходящие под него.
+type Filter struct {
+	Pattern *regexp.Regexp
+	Keep    bool
+}
+
+func (f *Filter) Process(msg *types.Message, _ time.Time) bool {
+	return f.Pattern.MatchString(msg.Data) == f.Keep
+}
+
+// Redact заменяет найденные Pattern фрагменты на Mask. Если задан Check,
+// заменяются только фрагменты, для которых он возвращает true.
+type Redact struct {
+	Pattern *regexp.Regexp
+	Mask    string
+	Check   func(string) bool
+}
+
+func newRedact(cfg config.ProcessorConfig) (*Redact, error) {
+	r := &Redact{Mask: cfg.Replace}
+	if r.Mask == "" {
+		r.Mask = defaultMask
+	}
+
+	switch {
+	case cfg.Preset == PresetEmail && cfg.Pattern == "":
+		r.Pattern = emailPattern
+	case cfg.Preset == PresetCard && cfg.Pattern == "":
+		r.Pattern, r.Check = cardPattern, luhnValid
+	case cfg.Preset != "":
+		return nil, fmt.Errorf("redact: неизвестный шаблон %q или он задан вместе с Pattern", cfg.Preset)
+	case cfg.Pattern == "":
+		return nil, fmt.Errorf("redact: нужен Pattern или Preset")
+	default:
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact: %w", err)
+		}
+		r.Pattern = re
+	}
+	return r, nil
+}
+
+func (r *Redact) Process(msg *types.Message, _ time.Time) bool {
+	msg.Data = r.Pattern.ReplaceAllStringFunc(msg.Data, func(match string) string {
+		if r.Check != nil && !r.Check(match) {
+			return match
+		}
+		return r.Mask
+	})
+	return true
+}
+
+// luhnValid проверяет контрольную цифру номера карты, чтобы не скрывать
+// любые длинные числа.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// PrefixData - поля, доступные в шаблоне префикса.
+type PrefixData struct {
+	Time   time.Time
+	MsgID  string
+	Tenant string
+	FileID string
+	// User - первые 8 символов sha256 токена: пользователь различим,
+	// а сам токен не попадает в файл
+	User string
+}
+
+// Prefix добавляет перед данными результат шаблона text/template, например
+// `{{.Time.Format "2006-01-02T15:04:05Z07:00"}} {{.User}} `.
+type Prefix struct {
+	Template *template.Template
+}
+
+func (p *Prefix) Process(msg *types.Message, now time.Time) bool {
+	tenant, fileID := types.SplitFileKey(msg.FileID)
+	sum := sha256.Sum256([]byte(msg.Token))
+	data := PrefixData{
+		Time:   now,
+		MsgID:  msg.ID,
+		Tenant: tenant,
+		FileID: fileID,
+		User:   hex.EncodeToString(sum[:])[:8],
+	}
+
+	var b strings.Builder
+	if err := p.Template.Execute(&b, data); err != nil {
+		// шаблон проверен при создании, ошибка возможна только при выполнении -
+		// данные сообщения важнее префикса
+		return true
+	}
+	msg.Data = b.String() + msg.Data
+	return true
+}
+
+// Truncate обрезает данные до MaxBytes байт (с учетом Suffix) по границе символа.
+type Truncate struct {
+	MaxBytes int
+	Suffix   string
+}
+
+func (t *Truncate) Process(msg *types.Message, _ time.Time) bool {
+	if len(msg.Data) <= t.MaxBytes {
+		return true
+	}
+	suffix := t.Suffix
+	if len(suffix) > t.MaxBytes {
+		suffix = ""
+	}
+	n := t.MaxBytes - len(suffix)
+	for n > 0 && !utf8.RuneStart(msg.Data[n]) {
+		n--
+	}
+	msg.Data = msg.Data[:n] + suffix
+	return true
+}
@@ -0,0 +1,205 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+var now = time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+
+// run применяет обработчик из конфигурации к данным и возвращает результат.
+func run(t *testing.T, cfg config.ProcessorConfig, data string) (string, bool) {
+	p, err := New(cfg)
+	if err != nil {
+		t.Fatalf("не удалось создать обработчик: %v", err)
+	}
+	msg := types.Message{ID: "m1", Token: "valid_token_1", FileID: "acme/file1", Data: data}
+	keep := p.Process(&msg, now)
+	return msg.Data, keep
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.ProcessorConfig
+		data string
+		keep bool
+	}{
+		{"drop подходящее", config.ProcessorConfig{Type: TypeDrop, Pattern: `^DEBUG`}, "DEBUG cache miss", false},
+		{"drop не подходящее", config.ProcessorConfig{Type: TypeDrop, Pattern: `^DEBUG`}, "ERROR disk full", true},
+		{"keep подходящее", config.ProcessorConfig{Type: TypeKeep, Pattern: `(?i)error|warn`}, "Warning: low memory", true},
+		{"keep не подходящее", config.ProcessorConfig{Type: TypeKeep, Pattern: `(?i)error|warn`}, "user logged in", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, keep := run(t, tt.cfg, tt.data)
+			if keep != tt.keep {
+				t.Errorf("ожидалось keep=%v, получено %v", tt.keep, keep)
+			}
+			if data != tt.data {
+				t.Errorf("фильтр не должен менять данные, получено %q", data)
+			}
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.ProcessorConfig
+		data     string
+		expected string
+	}{
+		{
+			"email",
+			config.ProcessorConfig{Type: TypeRedact, Preset: PresetEmail},
+			"from ivan.petrov+news@mail.example.ru to a@b.co",
+			"from *** to ***",
+		},
+		{
+			"номер карты с проверкой Луна",
+			config.ProcessorConfig{Type: TypeRedact, Preset: PresetCard, Replace: "[card]"},
+			"paid 4111 1111 1111 1111, order 1234567890123, card 5500-0000-0000-0004",
+			"paid [card], order 1234567890123, card [card]",
+		},
+		{
+			"свой шаблон",
+			config.ProcessorConfig{Type: TypeRedact, Pattern: `password=\S+`, Replace: "password=?"},
+			"login ok password=secret123 ip=10.0.0.1",
+			"login ok password=? ip=10.0.0.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, keep := run(t, tt.cfg, tt.data)
+			if !keep {
+				t.Fatal("скрытие не должно отбрасывать сообщение")
+			}
+			if data != tt.expected {
+				t.Errorf("ожидалось %q, получено %q", tt.expected, data)
+			}
+		})
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"время и пользователь", `{{.Time.Format "2006-01-02T15:04:05Z07:00"}} [{{.User}}] `, "2026-10-18T12:30:00Z [67827422] hello"},
+		{"тенант и файл", `{{.Tenant}}/{{.FileID}}#{{.MsgID}}: `, "acme/file1#m1: hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := run(t, config.ProcessorConfig{Type: TypePrefix, Template: tt.template}, "hello")
+			if data != tt.expected {
+				t.Errorf("ожидалось %q, получено %q", tt.expected, data)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      config.ProcessorConfig
+		data     string
+		expected string
+	}{
+		{"короче лимита", config.ProcessorConfig{Type: TypeTruncate, MaxBytes: 10}, "short", "short"},
+		{"обрезка", config.ProcessorConfig{Type: TypeTruncate, MaxBytes: 5}, "0123456789", "01234"},
+		{"с окончанием", config.ProcessorConfig{Type: TypeTruncate, MaxBytes: 8, Replace: "..."}, "0123456789", "01234..."},
+		// "п" занимает два байта, обрезка посередине символа недопустима
+		{"по границе символа", config.ProcessorConfig{Type: TypeTruncate, MaxBytes: 3}, "ппп", "п"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := run(t, tt.cfg, tt.data)
+			if data != tt.expected {
+				t.Errorf("ожидалось %q, получено %q", tt.expected, data)
+			}
+		})
+	}
+}
+
+func TestNewRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.ProcessorConfig
+	}{
+		{"неизвестный тип", config.ProcessorConfig{Type: "upper"}},
+		{"drop без шаблона", config.ProcessorConfig{Type: TypeDrop}},
+		{"некорректное выражение", config.ProcessorConfig{Type: TypeKeep, Pattern: "("}},
+		{"неизвестный Preset", config.ProcessorConfig{Type: TypeRedact, Preset: "phone"}},
+		{"Preset вместе с Pattern", config.ProcessorConfig{Type: TypeRedact, Preset: PresetEmail, Pattern: "x"}},
+		{"redact без шаблона", config.ProcessorConfig{Type: TypeRedact}},
+		{"некорректный шаблон префикса", config.ProcessorConfig{Type: TypePrefix, Template: "{{.Time"}},
+		{"truncate без MaxBytes", config.ProcessorConfig{Type: TypeTruncate}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Error("ожидалась ошибка конфигурации")
+			}
+		})
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	pipeline, err := NewPipeline(map[string][]config.ProcessorConfig{
+		"file1": {
+			{Type: TypeDrop, Pattern: `^DEBUG`},
+			{Type: TypeRedact, Preset: PresetEmail},
+			{Type: TypePrefix, Template: "{{.FileID}}: "},
+			// обрезка после префикса учитывает его длину
+			{Type: TypeTruncate, MaxBytes: 12},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		fileID   string
+		data     string
+		expected string
+		keep     bool
+	}{
+		{"цепочка по порядку", "file1", "mail a@b.co now", "file1: mail ", true},
+		{"отброшено первым обработчиком", "file1", "DEBUG a@b.co", "DEBUG a@b.co", false},
+		{"файл без цепочки", "file2", "DEBUG a@b.co", "DEBUG a@b.co", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := types.Message{FileID: tt.fileID, Data: tt.data}
+			if keep := pipeline.Process(&msg, now); keep != tt.keep {
+				t.Errorf("ожидалось keep=%v, получено %v", tt.keep, keep)
+			}
+			if msg.Data != tt.expected {
+				t.Errorf("ожидалось %q, получено %q", tt.expected, msg.Data)
+			}
+		})
+	}
+
+	var empty *Pipeline
+	msg := types.Message{FileID: "file1", Data: "DEBUG"}
+	if !empty.Process(&msg, now) || msg.Data != "DEBUG" {
+		t.Error("nil Pipeline не должен менять сообщения")
+	}
+
+	if _, err := NewPipeline(map[string][]config.ProcessorConfig{"file1": {{Type: "upper"}}}); err == nil {
+		t.Error("ожидалась ошибка конфигурации")
+	}
+	// ключ, который не совпадет ни с одним файлом, - ошибка конфигурации, а не пропущенная цепочка
+	for _, key := range []string{"File1", "acme/orders/x", "../file1"} {
+		if _, err := NewPipeline(map[string][]config.ProcessorConfig{key: {{Type: TypeDrop, Pattern: "x"}}}); err == nil {
+			t.Errorf("ожидалась ошибка для ключа %q", key)
+		}
+	}
+}
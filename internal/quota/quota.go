@@ -0,0 +1,222 @@
+// Package quota ведет учет объема данных по ключам (файлам и пользователям)
+// и проверяет мягкие и жесткие квоты.
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrExceeded = errors.New("превышена квота на объем данных")
+
+// Limit - квоты в байтах (0 - без ограничения). При превышении мягкой квоты
+// данные принимаются с предупреждением, жесткой - отклоняются.
+type Limit struct {
+	Soft int64
+	Hard int64
+}
+
+// Usage - учтенный объем по ключу: записанные и еще не удаленные с диска данные
+// и принятые, но еще не записанные.
+type Usage struct {
+	Written  int64 `json:"written_bytes"`
+	Pending  int64 `json:"pending_bytes"`
+	Soft     int64 `json:"soft_limit,omitempty"`
+	Hard     int64 `json:"hard_limit,omitempty"`
+	OverSoft bool  `json:"over_soft_limit"`
+}
+
+func (u Usage) total() int64 {
+	return u.Written + u.Pending
+}
+
+// Request - проверка квоты ключа.
+type Request struct {
+	Key   string
+	Limit Limit
+}
+
+// ExceededError описывает квоту, из-за которой данные отклонены.
+type ExceededError struct {
+	Key   string
+	Usage Usage
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%v: %s (%d из %d байт)", ErrExceeded, e.Key, e.Usage.Written+e.Usage.Pending, e.Usage.Hard)
+}
+
+func (e *ExceededError) Unwrap() error {
+	return ErrExceeded
+}
+
+// Store хранит учет объема. Записанный объем сохраняется в файл и переживает
+// перезапуск, незаписанный существует только в памяти.
+type Store struct {
+	mutex   sync.Mutex
+	written map[string]int64
+	pending map[string]int64
+	dirty   bool
+}
+
+func NewStore() *Store {
+	return &Store{written: make(map[string]int64), pending: make(map[string]int64)}
+}
+
+// Load читает сохраненный учет, отсутствие файла - пустой учет.
+func Load(path string) (*Store, error) {
+	s := NewStore()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.written); err != nil {
+		return nil, fmt.Errorf("поврежден файл учета %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Save атомарно сохраняет записанный объем, если он изменился с прошлого сохранения.
+func (s *Store) Save(path string) error {
+	s.mutex.Lock()
+	if !s.dirty {
+		s.mutex.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(s.written, "", "  ")
+	s.dirty = false
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		s.markDirty()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		s.markDirty()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		s.markDirty()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		s.markDirty()
+		return err
+	}
+	return nil
+}
+
+func (s *Store) markDirty() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.dirty = true
+}
+
+// Reserve учитывает n байт как принятые для всех ключей сразу или не учитывает
+// ничего, если это превысит жесткую квоту хотя бы одного из них.
+// Возвращает true, если после учета превышена мягкая квота какого-либо ключа.
+func (s *Store) Reserve(n int64, requests ...Request) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	overSoft := false
+	for _, req := range requests {
+		usage := s.usageLocked(req.Key, req.Limit)
+		if req.Limit.Hard > 0 && usage.total()+n > req.Limit.Hard {
+			return false, &ExceededError{Key: req.Key, Usage: usage}
+		}
+		if req.Limit.Soft > 0 && usage.total()+n > req.Limit.Soft {
+			overSoft = true
+		}
+	}
+
+	for _, req := range requests {
+		s.pending[req.Key] += n
+	}
+	return overSoft, nil
+}
+
+// Commit снимает учет reserved принятых байт ключа и учитывает written
+// записанных: после форматирования объем на диске может отличаться от принятого.
+func (s *Store) Commit(key string, reserved, written int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.releaseLocked(key, reserved)
+	s.written[key] += written
+	s.dirty = true
+}
+
+// Release снимает учет n принятых байт, которые так и не будут записаны.
+func (s *Store) Release(key string, n int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.releaseLocked(key, n)
+}
+
+func (s *Store) releaseLocked(key string, n int64) {
+	if s.pending[key] -= n; s.pending[key] <= 0 {
+		delete(s.pending, key)
+	}
+}
+
+// Remove уменьшает записанный объем ключа на n байт, удаленных с диска.
+func (s *Store) Remove(key string, n int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.written[key] -= n; s.written[key] <= 0 {
+		delete(s.written, key)
+	}
+	s.dirty = true
+}
+
+// Reset обнуляет записанный объем ключа, например после удаления файлов оператором.
+func (s *Store) Reset(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.written, key)
+	s.dirty = true
+}
+
+func (s *Store) Usage(key string, limit Limit) Usage {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.usageLocked(key, limit)
+}
+
+func (s *Store) usageLocked(key string, limit Limit) Usage {
+	usage := Usage{Written: s.written[key], Pending: s.pending[key], Soft: limit.Soft, Hard: limit.Hard}
+	usage.OverSoft = limit.Soft > 0 && usage.total() > limit.Soft
+	return usage
+}
+
+// Keys возвращает все ключи с учтенным объемом.
+func (s *Store) Keys() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := make([]string, 0, len(s.written))
+	for key := range s.written {
+		keys = append(keys, key)
+	}
+	for key := range s.pending {
+		if _, exists := s.written[key]; !exists {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
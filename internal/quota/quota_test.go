@@ -0,0 +1,70 @@
+package quota
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// Проверяет мягкую и жесткую квоты и то, что при отказе ничего не учитывается.
+func TestReserve(t *testing.T) {
+	s := NewStore()
+	file := Request{Key: "file:f1", Limit: Limit{Soft: 10, Hard: 20}}
+	user := Request{Key: "user:u1", Limit: Limit{Hard: 100}}
+
+	if overSoft, err := s.Reserve(8, file, user); err != nil || overSoft {
+		t.Fatalf("ожидался успех без предупреждения: %v %v", overSoft, err)
+	}
+	if overSoft, err := s.Reserve(8, file, user); err != nil || !overSoft {
+		t.Fatalf("ожидалось превышение мягкой квоты: %v %v", overSoft, err)
+	}
+
+	_, err := s.Reserve(8, file, user)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || !errors.Is(err, ErrExceeded) || exceeded.Key != "file:f1" {
+		t.Fatalf("ожидалось превышение жесткой квоты файла, получено: %v", err)
+	}
+	if usage := s.Usage("user:u1", user.Limit); usage.Pending != 16 {
+		t.Fatalf("при отказе объем не должен учитываться, учтено: %+v", usage)
+	}
+
+	s.Commit("file:f1", 8, 10)
+	s.Release("file:f1", 8)
+	usage := s.Usage("file:f1", file.Limit)
+	if usage.Written != 10 || usage.Pending != 0 || usage.OverSoft {
+		t.Fatalf("неверный учет после записи: %+v", usage)
+	}
+
+	s.Remove("file:f1", 4)
+	if usage := s.Usage("file:f1", file.Limit); usage.Written != 6 {
+		t.Fatalf("неверный учет после удаления данных: %+v", usage)
+	}
+	s.Remove("file:f1", 100)
+	if usage := s.Usage("file:f1", file.Limit); usage.Written != 0 {
+		t.Fatalf("записанный объем не должен уходить в минус: %+v", usage)
+	}
+}
+
+// Проверяет, что записанный объем переживает перезапуск, а незаписанный - нет.
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+
+	s := NewStore()
+	s.Reserve(30, Request{Key: "file:f1"})
+	s.Commit("file:f1", 30, 20)
+	if err := s.Save(path); err != nil {
+		t.Fatalf("не удалось сохранить учет: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("не удалось загрузить учет: %v", err)
+	}
+	if usage := loaded.Usage("file:f1", Limit{}); usage.Written != 20 || usage.Pending != 0 {
+		t.Fatalf("неверный учет после загрузки: %+v", usage)
+	}
+
+	if s, err := Load(filepath.Join(t.TempDir(), "missing.json")); err != nil || len(s.Keys()) != 0 {
+		t.Fatalf("отсутствующий файл должен давать пустой учет: %v", err)
+	}
+}
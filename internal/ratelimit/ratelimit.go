@@ -0,0 +1,141 @@
+// Package ratelimit реализует ограничение скорости по алгоритму token bucket
+// с отдельной корзиной на каждый ключ.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit - скорость пополнения корзины (единиц в секунду) и ее емкость.
+// Нулевая скорость - без ограничения, нулевая емкость - равна скорости.
+type Limit struct {
+	Rate  float64
+	Burst float64
+}
+
+func (l Limit) burst() float64 {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Rate
+}
+
+// Request - запрос на списание n единиц из корзины key.
+type Request struct {
+	Key   string
+	Limit Limit
+	N     float64
+}
+
+// Result - итог проверки. Для отказа описывает корзину, которой не хватило
+// единиц, для успеха - корзину с наименьшим остатком.
+type Result struct {
+	Allowed    bool
+	Key        string
+	Limit      float64 // емкость корзины
+	Remaining  float64
+	RetryAfter time.Duration // через сколько запрос может пройти
+	Reset      time.Duration // через сколько корзина заполнится полностью
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type Limiter struct {
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func New() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow списывает единицы сразу из всех корзин запросов или не списывает
+// ничего, если хотя бы в одной их не хватает.
+func (l *Limiter) Allow(requests ...Request) Result {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	buckets := make([]*bucket, len(requests))
+	denied, tightest := -1, -1
+	var retryAfter time.Duration
+
+	for i, req := range requests {
+		if req.Limit.Rate <= 0 {
+			continue
+		}
+		b := l.refill(req.Key, req.Limit, now)
+		buckets[i] = b
+
+		// запрос больше емкости проходит только при полной корзине, иначе он не прошел бы никогда
+		need := math.Min(req.N, req.Limit.burst())
+		if b.tokens < need {
+			if wait := seconds((need - b.tokens) / req.Limit.Rate); denied < 0 || wait > retryAfter {
+				denied, retryAfter = i, wait
+			}
+			continue
+		}
+		// у корзин разные единицы, поэтому сравнивается доля остатка
+		if tightest < 0 || left(req, b) < left(requests[tightest], buckets[tightest]) {
+			tightest = i
+		}
+	}
+
+	if denied >= 0 {
+		result := l.result(requests[denied], buckets[denied])
+		result.RetryAfter = retryAfter
+		return result
+	}
+
+	for i, req := range requests {
+		if buckets[i] != nil {
+			buckets[i].tokens -= req.N
+		}
+	}
+	if tightest < 0 {
+		return Result{Allowed: true}
+	}
+	result := l.result(requests[tightest], buckets[tightest])
+	result.Allowed = true
+	return result
+}
+
+func left(req Request, b *bucket) float64 {
+	return (b.tokens - req.N) / req.Limit.burst()
+}
+
+func (l *Limiter) result(req Request, b *bucket) Result {
+	burst := req.Limit.burst()
+	remaining := math.Max(0, b.tokens)
+	return Result{
+		Key:       req.Key,
+		Limit:     burst,
+		Remaining: remaining,
+		Reset:     seconds((burst - b.tokens) / req.Limit.Rate),
+	}
+}
+
+// refill возвращает корзину ключа, пополненную на время с прошлого обращения.
+func (l *Limiter) refill(key string, limit Limit, now time.Time) *bucket {
+	burst := limit.burst()
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+	b.updated = now
+	return b
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
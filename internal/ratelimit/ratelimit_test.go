@@ -0,0 +1,95 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time { return c.t }
+
+func newTestLimiter() (*Limiter, *clock) {
+	c := &clock{t: time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)}
+	l := New()
+	l.now = c.now
+	return l, c
+}
+
+// Проверяет расход и пополнение корзины.
+func TestAllowRefill(t *testing.T) {
+	l, c := newTestLimiter()
+	limit := Limit{Rate: 2, Burst: 4}
+
+	for i := 0; i < 4; i++ {
+		if res := l.Allow(Request{Key: "token", Limit: limit, N: 1}); !res.Allowed {
+			t.Fatalf("запрос %d в пределах всплеска должен пройти", i)
+		}
+	}
+
+	res := l.Allow(Request{Key: "token", Limit: limit, N: 1})
+	if res.Allowed {
+		t.Fatalf("ожидался отказ после исчерпания корзины")
+	}
+	if res.RetryAfter != 500*time.Millisecond || res.Reset != 2*time.Second || res.Limit != 4 || res.Remaining != 0 {
+		t.Fatalf("неверный результат отказа: %+v", res)
+	}
+
+	c.t = c.t.Add(500 * time.Millisecond)
+	if res := l.Allow(Request{Key: "token", Limit: limit, N: 1}); !res.Allowed {
+		t.Fatalf("ожидалось пополнение корзины: %+v", res)
+	}
+
+	// корзины разных ключей независимы
+	if res := l.Allow(Request{Key: "other", Limit: limit, N: 1}); !res.Allowed || res.Remaining != 3 {
+		t.Fatalf("неверный результат для другого ключа: %+v", res)
+	}
+}
+
+// Проверяет, что при отказе одной корзины единицы не списываются из остальных.
+func TestAllowAllOrNothing(t *testing.T) {
+	l, _ := newTestLimiter()
+	messages := Limit{Rate: 10}
+	bytes := Limit{Rate: 100}
+
+	res := l.Allow(Request{Key: "msgs", Limit: messages, N: 1}, Request{Key: "bytes", Limit: bytes, N: 60})
+	if !res.Allowed || res.Key != "bytes" || res.Remaining != 40 {
+		t.Fatalf("ожидался успех с остатком по байтам: %+v", res)
+	}
+
+	res = l.Allow(Request{Key: "msgs", Limit: messages, N: 1}, Request{Key: "bytes", Limit: bytes, N: 60})
+	if res.Allowed || res.Key != "bytes" {
+		t.Fatalf("ожидался отказ по байтам: %+v", res)
+	}
+
+	if res := l.Allow(Request{Key: "msgs", Limit: messages, N: 9}); !res.Allowed {
+		t.Fatalf("при отказе не должно было списываться из корзины сообщений: %+v", res)
+	}
+}
+
+// Проверяет запрос больше емкости корзины и отсутствие ограничения.
+func TestAllowOversizedAndUnlimited(t *testing.T) {
+	l, c := newTestLimiter()
+	limit := Limit{Rate: 10}
+
+	if res := l.Allow(Request{Key: "bytes", Limit: limit, N: 25}); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("запрос больше емкости должен пройти при полной корзине: %+v", res)
+	}
+	if res := l.Allow(Request{Key: "bytes", Limit: limit, N: 1}); res.Allowed {
+		t.Fatalf("ожидался отказ до погашения долга")
+	}
+	c.t = c.t.Add(time.Second)
+	if res := l.Allow(Request{Key: "bytes", Limit: limit, N: 1}); res.Allowed {
+		t.Fatalf("ожидался отказ до погашения долга")
+	}
+	c.t = c.t.Add(time.Second)
+	if res := l.Allow(Request{Key: "bytes", Limit: limit, N: 1}); !res.Allowed {
+		t.Fatalf("ожидался успех после погашения долга: %+v", res)
+	}
+
+	for i := 0; i < 100; i++ {
+		if res := l.Allow(Request{Key: "free", N: 1}); !res.Allowed {
+			t.Fatalf("без ограничения запрос должен проходить")
+		}
+	}
+}
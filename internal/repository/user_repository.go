@@ -1,11 +1,17 @@
 package repository
 
 import (
-	"fmt"
+	"errors"
+	"sync"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/events"
 	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
 )
 
+var ErrTokenInUse = errors.New("токен уже используется другим пользователем")
+
 type UserRepository struct {
+	mutex       sync.RWMutex
 	users       map[string]types.User
 	validTokens map[string]bool
 }
@@ -23,20 +29,30 @@ func NewUserRepository(validTokens []string) *UserRepository {
 }
 
 func (r *UserRepository) IsValidToken(token string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 	return r.validTokens[token]
 }
 
+// AddUser регистрирует пользователя и публикует events.UserAdded после
+// снятия блокировки, чтобы подписчик мог обращаться к репозиторию.
 func (r *UserRepository) AddUser(user types.User) error {
+	r.mutex.Lock()
 	if _, exists := r.users[user.Token]; exists {
-		return fmt.Errorf("токен уже используется другим пользователем")
+		r.mutex.Unlock()
+		return ErrTokenInUse
 	}
 	r.users[user.Token] = user
 	r.validTokens[user.Token] = true
+	r.mutex.Unlock()
 
+	events.Default.Publish(events.UserAdded{User: user})
 	return nil
 }
 
 func (r *UserRepository) GetUserByToken(token string) (types.User, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 	user, exists := r.users[token]
 	return user, exists
 }
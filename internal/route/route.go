@@ -0,0 +1,97 @@
+// Package route выбирает файлы, в которые записывается сообщение: кроме
+// исходного файла, правила могут копировать сообщение в дополнительные файлы
+// (общий файл аудита, файлы по уровню важности) или переносить его туда.
+package route
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/fileid"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+type rule struct {
+	fileID string
+	match  *regexp.Regexp
+	to     []string
+	move   bool
+}
+
+func (r rule) matches(fileID, data string) bool {
+	if r.fileID != "" {
+		if ok, _ := path.Match(r.fileID, fileID); !ok {
+			return false
+		}
+	}
+	return r.match == nil || r.match.MatchString(data)
+}
+
+// Router - проверенные правила маршрутизации.
+type Router struct {
+	rules []rule
+}
+
+// NewRouter проверяет правила из конфигурации.
+func NewRouter(cfgs []config.RouteRule) (*Router, error) {
+	r := &Router{}
+	for i, cfg := range cfgs {
+		if _, err := path.Match(cfg.FileID, ""); err != nil {
+			return nil, fmt.Errorf("правило %d: шаблон fileID: %w", i+1, err)
+		}
+		if len(cfg.To) == 0 {
+			return nil, fmt.Errorf("правило %d: нужен хотя бы один файл назначения", i+1)
+		}
+		for _, to := range cfg.To {
+			if err := fileid.Validate(to); err != nil {
+				return nil, fmt.Errorf("правило %d: файл назначения %q: %w", i+1, to, err)
+			}
+		}
+
+		rl := rule{fileID: cfg.FileID, to: cfg.To, move: cfg.Move}
+		if cfg.Match != "" {
+			re, err := regexp.Compile(cfg.Match)
+			if err != nil {
+				return nil, fmt.Errorf("правило %d: %w", i+1, err)
+			}
+			rl.match = re
+		}
+		r.rules = append(r.rules, rl)
+	}
+	return r, nil
+}
+
+// Route возвращает идентификаторы файлов (types.FileKey), в которые нужно
+// записать сообщение файла fileKey с данными data. Исходный файл идет первым,
+// если ни одно подходящее правило не переносит сообщение. Файлы назначения
+// находятся в тенанте исходного файла, повторы исключаются.
+func (r *Router) Route(fileKey, data string) []string {
+	if r == nil || len(r.rules) == 0 {
+		return []string{fileKey}
+	}
+
+	tenant, fileID := types.SplitFileKey(fileKey)
+	var dests []string
+	moved := false
+	for _, rl := range r.rules {
+		if !rl.matches(fileID, data) {
+			continue
+		}
+		moved = moved || rl.move
+		for _, to := range rl.to {
+			if key := types.FileKey(tenant, to); !slices.Contains(dests, key) {
+				dests = append(dests, key)
+			}
+		}
+	}
+
+	if moved {
+		return dests
+	}
+	return append([]string{fileKey}, slices.DeleteFunc(dests, func(key string) bool {
+		return key == fileKey
+	})...)
+}
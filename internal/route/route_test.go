@@ -0,0 +1,66 @@
+package route
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+)
+
+func TestRoute(t *testing.T) {
+	r, err := NewRouter([]config.RouteRule{
+		{To: []string{"all"}},
+		{FileID: "app*", Match: `^ERROR`, To: []string{"errors"}},
+		{FileID: "debug", Move: true, To: []string{"debug-archive", "all"}},
+		{Match: `audit`, To: []string{"all", "audit"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		fileID   string
+		data     string
+		expected []string
+	}{
+		{"копия в общий файл", "app1", "INFO started", []string{"app1", "all"}},
+		{"по содержимому", "app1", "ERROR disk full", []string{"app1", "all", "errors"}},
+		{"шаблон fileID не подходит", "db", "ERROR disk full", []string{"db", "all"}},
+		{"перенос", "debug", "trace", []string{"all", "debug-archive"}},
+		{"повторы исключаются", "app1", "audit", []string{"app1", "all", "audit"}},
+		{"сам файл назначения", "all", "INFO", []string{"all"}},
+		{"в тенанте исходного файла", "acme/app1", "ERROR", []string{"acme/app1", "acme/all", "acme/errors"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if dests := r.Route(tt.fileID, tt.data); !reflect.DeepEqual(dests, tt.expected) {
+				t.Errorf("ожидалось %v, получено %v", tt.expected, dests)
+			}
+		})
+	}
+
+	var empty *Router
+	if dests := empty.Route("app1", "data"); !reflect.DeepEqual(dests, []string{"app1"}) {
+		t.Errorf("без правил сообщение идет только в исходный файл, получено %v", dests)
+	}
+}
+
+func TestNewRouterRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []config.RouteRule
+	}{
+		{"без файлов назначения", []config.RouteRule{{FileID: "app"}}},
+		{"недопустимый файл назначения", []config.RouteRule{{To: []string{"../etc"}}}},
+		{"некорректный шаблон fileID", []config.RouteRule{{FileID: "[", To: []string{"all"}}}},
+		{"некорректное выражение", []config.RouteRule{{Match: "(", To: []string{"all"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRouter(tt.rules); err == nil {
+				t.Error("ожидалась ошибка конфигурации")
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+// Package rpc - gRPC API приема сообщений ingest.v1.Ingest. Сервис и
+// сообщения описаны в api/ingest/v1/ingest.proto, код для них сгенерирован в
+// пакет ingestv1. Сообщения передаются в protobuf, по желанию клиента - в JSON
+// (см. CodecName).
+//
+// Токен пользователя передается в метаданных: authorization: Bearer <token>.
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc/metadata"
+)
+
+//go:generate protoc -I ../../api --go_out=../../api --go_opt=paths=source_relative --go-grpc_out=../../api --go-grpc_opt=paths=source_relative ingest/v1/ingest.proto
+
+// WithToken добавляет токен пользователя в метаданные вызова.
+func WithToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
@@ -0,0 +1,40 @@
+package rpc
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// CodecName - подтип содержимого gRPC (application/grpc+json) для клиентов,
+// которым удобнее JSON: grpc.CallContentSubtype(CodecName). По умолчанию
+// сообщения передаются в protobuf.
+const CodecName = "json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("сообщение %T не является protobuf-сообщением", v)
+	}
+	return protojson.Marshal(msg)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("сообщение %T не является protobuf-сообщением", v)
+	}
+	return protojson.Unmarshal(data, msg)
+}
+
+func (jsonCodec) Name() string {
+	return CodecName
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
@@ -0,0 +1,227 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	ingestv1 "github.com/asb1302/innopolis_go_assesment_1/api/ingest/v1"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+// setup запускает приложение и gRPC-сервер поверх bufconn и возвращает клиента.
+func setup(t *testing.T) (ingestv1.IngestClient, *Server, string) {
+	filesDir := t.TempDir()
+	cfg := &config.Config{
+		ValidTokens:    []string{"valid_token_1", "valid_token_2"},
+		WorkerInterval: 100 * time.Millisecond,
+		FilesDir:       filesDir,
+		NumWorkers:     1,
+		MaxRetries:     3,
+		RetryInterval:  100 * time.Millisecond,
+		TokenTenants:   map[string]string{"valid_token_2": "acme"},
+	}
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := app.NewApp(cfg, &types.DefaultFileWriter{}, userRepo)
+	msgHandler := handler.NewMessageHandler(userRepo, application, cfg)
+	server := NewServer("", ingest.NewService(application, msgHandler, userRepo), filesDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+
+	lis := bufconn.Listen(1 << 20)
+	go server.ServeListener(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("не удалось подключиться: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+		server.Shutdown(context.Background())
+		cancel()
+		<-done
+	})
+	return ingestv1.NewIngestClient(conn), server, filesDir
+}
+
+func TestAddUserAndSendMessage(t *testing.T) {
+	client, _, _ := setup(t)
+	ctx := WithToken(context.Background(), "valid_token_1")
+
+	if _, err := client.AddUser(ctx, &ingestv1.AddUserRequest{FileId: "bad/id"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("недопустимый fileID: ожидался код InvalidArgument, получено %v", err)
+	}
+	if _, err := client.AddUser(ctx, &ingestv1.AddUserRequest{FileId: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	resp, err := client.SendMessage(ctx, &ingestv1.SendMessageRequest{FileId: "file1", Data: "Hello"})
+	if err != nil {
+		t.Fatalf("не удалось отправить сообщение: %v", err)
+	}
+	if resp.GetId() == "" {
+		t.Error("ожидался идентификатор сообщения")
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		file  string
+		code  codes.Code
+	}{
+		{"без токена", "", "file1", codes.InvalidArgument},
+		{"неизвестный токен", "invalid_token", "file1", codes.Unauthenticated},
+		{"чужой файл", "valid_token_1", "file2", codes.InvalidArgument},
+		{"пользователь не добавлен", "valid_token_2", "file1", codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != "" {
+				ctx = WithToken(ctx, tt.token)
+			}
+			_, err := client.SendMessage(ctx, &ingestv1.SendMessageRequest{FileId: tt.file, Data: "x"})
+			if status.Code(err) != tt.code {
+				t.Errorf("ожидался код %v, получено %v", tt.code, err)
+			}
+		})
+	}
+
+	// тенант берется из настроек токена
+	ctx = WithToken(context.Background(), "valid_token_2")
+	added, err := client.AddUser(ctx, &ingestv1.AddUserRequest{FileId: "file1"})
+	if err != nil || added.GetFileId() != "acme/file1" {
+		t.Fatalf("ожидался файл acme/file1, получено %v (%v)", added, err)
+	}
+	if _, err := client.SendMessage(ctx, &ingestv1.SendMessageRequest{FileId: "file1", Data: "x"}); err != nil {
+		t.Errorf("не удалось отправить сообщение в файл тенанта: %v", err)
+	}
+}
+
+func TestSendMessagesAndTailFile(t *testing.T) {
+	client, _, filesDir := setup(t)
+	ctx, cancel := context.WithTimeout(WithToken(context.Background(), "valid_token_1"), 10*time.Second)
+	defer cancel()
+
+	if _, err := client.AddUser(ctx, &ingestv1.AddUserRequest{FileId: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	tail, err := client.TailFile(ctx, &ingestv1.TailFileRequest{FromStart: true})
+	if err != nil {
+		t.Fatalf("не удалось открыть поток TailFile: %v", err)
+	}
+
+	stream, err := client.SendMessages(ctx)
+	if err != nil {
+		t.Fatalf("не удалось открыть поток SendMessages: %v", err)
+	}
+	for _, req := range []*ingestv1.SendMessageRequest{
+		{FileId: "file1", Data: "one"},
+		{FileId: "file2", Data: "other"},
+		{FileId: "file1", Data: "two"},
+	} {
+		if err := stream.Send(req); err != nil {
+			t.Fatalf("не удалось отправить сообщение: %v", err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("не удалось завершить поток: %v", err)
+	}
+	if resp.Accepted != 2 || len(resp.Rejected) != 1 || resp.Rejected[0].Index != 1 ||
+		resp.Rejected[0].Code != codes.InvalidArgument.String() {
+		t.Fatalf("неожиданный итог приема: %+v", resp)
+	}
+
+	for _, expected := range []string{"one", "two"} {
+		line, err := tail.Recv()
+		if err != nil {
+			t.Fatalf("не удалось прочитать строку: %v", err)
+		}
+		if line.GetLine() != expected {
+			t.Errorf("ожидалась строка %q, получено %q", expected, line.Line)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(filesDir, "file1.txt")); err != nil {
+		t.Errorf("ожидался файл file1.txt: %v", err)
+	}
+}
+
+func TestSendMessagesRequiresToken(t *testing.T) {
+	client, _, _ := setup(t)
+
+	stream, err := client.SendMessages(context.Background())
+	if err != nil {
+		t.Fatalf("не удалось открыть поток: %v", err)
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ожидался код Unauthenticated, получено %v", err)
+	}
+}
+
+func TestShutdownEndsTailFile(t *testing.T) {
+	client, server, _ := setup(t)
+	ctx := WithToken(context.Background(), "valid_token_1")
+
+	if _, err := client.AddUser(ctx, &ingestv1.AddUserRequest{FileId: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+	tail, err := client.TailFile(ctx, &ingestv1.TailFileRequest{})
+	if err != nil {
+		t.Fatalf("не удалось открыть поток TailFile: %v", err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("ожидалась остановка без ожидания потока TailFile: %v", err)
+	}
+	if _, err := tail.Recv(); err == nil {
+		t.Error("ожидалось завершение потока TailFile")
+	}
+}
+
+// Проверяет, что по желанию клиента сообщения передаются в JSON.
+func TestJSONCodec(t *testing.T) {
+	client, _, _ := setup(t)
+	ctx := WithToken(context.Background(), "valid_token_1")
+	jsonCall := grpc.CallContentSubtype(CodecName)
+
+	if _, err := client.AddUser(ctx, &ingestv1.AddUserRequest{FileId: "file1"}, jsonCall); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+	resp, err := client.SendMessage(ctx, &ingestv1.SendMessageRequest{FileId: "file1", Data: "Hello"}, jsonCall)
+	if err != nil {
+		t.Fatalf("не удалось отправить сообщение: %v", err)
+	}
+	if resp.GetId() == "" {
+		t.Error("ожидался идентификатор сообщения")
+	}
+}
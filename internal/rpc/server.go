@@ -0,0 +1,235 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	ingestv1 "github.com/asb1302/innopolis_go_assesment_1/api/ingest/v1"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/storage"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+var ingestCodes = map[ingest.Code]codes.Code{
+	ingest.CodeInvalidArgument: codes.InvalidArgument,
+	ingest.CodeUnauthenticated: codes.Unauthenticated,
+	ingest.CodeForbidden:       codes.PermissionDenied,
+	ingest.CodeNotFound:        codes.NotFound,
+	ingest.CodeRateLimited:     codes.ResourceExhausted,
+	ingest.CodeQuotaExceeded:   codes.ResourceExhausted,
+	ingest.CodeUnavailable:     codes.Unavailable,
+}
+
+// Server - gRPC-сервер приема сообщений поверх того же ingest.Service, что и HTTP.
+type Server struct {
+	ingestv1.UnimplementedIngestServer
+
+	addr     string
+	svc      *ingest.Service
+	filesDir string
+	grpc     *grpc.Server
+	stopping chan struct{} // закрывается в Shutdown, завершает потоки TailFile
+	stopOnce sync.Once
+}
+
+func NewServer(addr string, svc *ingest.Service, filesDir string) *Server {
+	s := &Server{addr: addr, svc: svc, filesDir: filesDir, stopping: make(chan struct{})}
+	s.grpc = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unaryRequestID),
+		grpc.ChainStreamInterceptor(streamRequestID),
+	)
+	ingestv1.RegisterIngestServer(s.grpc, s)
+	return s
+}
+
+func (s *Server) Name() string {
+	return "grpc"
+}
+
+func (s *Server) Serve() error {
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeListener(lis)
+}
+
+func (s *Server) ServeListener(lis net.Listener) error {
+	slog.Info("gRPC-сервер запущен", "addr", lis.Addr().String())
+	err := s.grpc.Serve(lis)
+	if errors.Is(err, grpc.ErrServerStopped) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown дожидается завершения вызовов, а по истечении ctx обрывает их.
+// Потоки TailFile бесконечны, поэтому они завершаются сразу.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stopping) })
+
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
+
+// token извлекает токен пользователя из метаданных authorization: Bearer <token>.
+func token(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+// toStatus переводит ошибку приема в статус gRPC. Для превышения лимита
+// скорости в метаданные ответа добавляется retry-after (в секундах).
+func toStatus(ctx context.Context, err error) error {
+	code, exists := ingestCodes[ingest.CodeOf(err)]
+	if !exists {
+		code = codes.Unavailable
+	}
+
+	var rateErr *handler.RateLimitError
+	if errors.As(err, &rateErr) {
+		seconds := int(rateErr.RetryAfter.Seconds() + 0.999)
+		grpc.SetTrailer(ctx, metadata.Pairs("retry-after", strconv.Itoa(seconds)))
+	}
+	return status.Error(code, err.Error())
+}
+
+func (s *Server) AddUser(ctx context.Context, req *ingestv1.AddUserRequest) (*ingestv1.AddUserResponse, error) {
+	user, err := s.svc.AddUser(ctx, ingest.NewUser{
+		Token:  token(ctx),
+		FileID: req.GetFileId(),
+	})
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return &ingestv1.AddUserResponse{FileId: types.FileKey(user.Tenant, user.FileID)}, nil
+}
+
+func (s *Server) SendMessage(ctx context.Context, req *ingestv1.SendMessageRequest) (*ingestv1.SendMessageResponse, error) {
+	msg, err := s.svc.SendMessage(ctx, token(ctx), req.GetFileId(), req.GetData())
+	if err != nil {
+		return nil, toStatus(ctx, err)
+	}
+	return &ingestv1.SendMessageResponse{Id: msg.ID}, nil
+}
+
+// SendMessages принимает поток сообщений. Ошибка отдельного сообщения не
+// прерывает поток и возвращается в списке отклоненных, кроме ошибки токена.
+func (s *Server) SendMessages(stream grpc.ClientStreamingServer[ingestv1.SendMessageRequest, ingestv1.SendMessagesResponse]) error {
+	ctx := stream.Context()
+	tok := token(ctx)
+	if _, err := s.svc.Authenticate(tok); err != nil {
+		return toStatus(ctx, err)
+	}
+
+	resp := &ingestv1.SendMessagesResponse{}
+	for i := int32(0); ; i++ {
+		req, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return stream.SendAndClose(resp)
+			}
+			return err
+		}
+
+		if _, err := s.svc.SendMessage(ctx, tok, req.GetFileId(), req.GetData()); err != nil {
+			resp.Rejected = append(resp.Rejected, &ingestv1.Rejection{
+				Index: i,
+				Code:  status.Code(toStatus(ctx, err)).String(),
+				Error: err.Error(),
+			})
+			continue
+		}
+		resp.Accepted++
+	}
+}
+
+// TailFile передает строки, дописываемые в файл пользователя.
+func (s *Server) TailFile(req *ingestv1.TailFileRequest, stream grpc.ServerStreamingServer[ingestv1.TailFileResponse]) error {
+	ctx := stream.Context()
+	user, err := s.svc.Authenticate(token(ctx))
+	if err != nil {
+		return toStatus(ctx, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stopping:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	filePath := filepath.Join(s.filesDir, types.FileKey(user.Tenant, user.FileID)+".txt")
+	logger.FromContext(ctx).Info("чтение файла через gRPC", logger.KeyFileID, user.FileID, "from_start", req.GetFromStart())
+	err = storage.Tail(ctx, s.filesDir, filePath, req.GetFromStart(), func(line string) error {
+		return stream.Send(&ingestv1.TailFileResponse{Line: line})
+	})
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+// unaryRequestID и streamRequestID привязывают к вызову логгер с request_id
+// из метаданных x-request-id или новым, как HTTPMiddleware.
+func unaryRequestID(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+	ctx = withRequestID(ctx, info.FullMethod)
+	return next(ctx, req)
+}
+
+func streamRequestID(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+	return next(srv, &contextStream{ServerStream: ss, ctx: withRequestID(ss.Context(), info.FullMethod)})
+}
+
+func withRequestID(ctx context.Context, method string) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	requestID := logger.NewID()
+	if ids := md.Get("x-request-id"); len(ids) > 0 && ids[0] != "" {
+		requestID = ids[0]
+	}
+	ctx = logger.WithRequestID(ctx, requestID)
+	logger.FromContext(ctx).Debug("gRPC-вызов", "method", method)
+	return ctx
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,287 @@
+// Package schema проверяет данные сообщений по схеме файла: данные должны
+// быть JSON-объектом, поля которого описаны типами и ограничениями.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/fileid"
+)
+
+// Типы полей.
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeAny     = "any"
+)
+
+var ErrInvalid = errors.New("данные не соответствуют схеме")
+
+// FieldError - нарушение схемы в одном поле. Field - путь через точку,
+// пустой - данные целиком.
+type FieldError struct {
+	Field  string
+	Reason string
+}
+
+func (e FieldError) String() string {
+	if e.Field == "" {
+		return e.Reason
+	}
+	return fmt.Sprintf("поле %s: %s", e.Field, e.Reason)
+}
+
+// ValidationError перечисляет все нарушения схемы в данных сообщения.
+type ValidationError struct {
+	Version string
+	Fields  []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		reasons[i] = f.String()
+	}
+	return fmt.Sprintf("%v %s: %s", ErrInvalid, e.Version, strings.Join(reasons, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalid
+}
+
+type field struct {
+	path     []string
+	name     string
+	typ      string
+	required bool
+	pattern  *regexp.Regexp
+	enum     []string
+}
+
+// Schema - проверенная схема файла.
+type Schema struct {
+	Version    string
+	fields     []field
+	allowExtra bool
+	known      map[string]bool // пути описанных полей и их родителей
+}
+
+// Compile проверяет описание схемы.
+func Compile(cfg config.SchemaConfig) (*Schema, error) {
+	if cfg.Version == "" {
+		return nil, errors.New("нужна версия схемы")
+	}
+	s := &Schema{Version: cfg.Version, allowExtra: cfg.AllowExtra, known: make(map[string]bool)}
+
+	for _, fc := range cfg.Fields {
+		if fc.Name == "" || slices.Contains(strings.Split(fc.Name, "."), "") {
+			return nil, fmt.Errorf("некорректное имя поля %q", fc.Name)
+		}
+		if s.known[fc.Name] {
+			return nil, fmt.Errorf("поле %s описано дважды", fc.Name)
+		}
+		f := field{path: strings.Split(fc.Name, "."), name: fc.Name, typ: fc.Type, required: fc.Required, enum: fc.Enum}
+
+		switch fc.Type {
+		case TypeString, TypeNumber, TypeInteger, TypeBoolean, TypeObject, TypeArray, TypeAny:
+		default:
+			return nil, fmt.Errorf("поле %s: неизвестный тип %q", fc.Name, fc.Type)
+		}
+		if (fc.Pattern != "" || len(fc.Enum) > 0) && fc.Type != TypeString {
+			return nil, fmt.Errorf("поле %s: Pattern и Enum допустимы только для строк", fc.Name)
+		}
+		if fc.Pattern != "" {
+			re, err := regexp.Compile(fc.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("поле %s: %w", fc.Name, err)
+			}
+			f.pattern = re
+		}
+
+		for i := range f.path {
+			s.known[strings.Join(f.path[:i+1], ".")] = true
+		}
+		s.fields = append(s.fields, f)
+	}
+	return s, nil
+}
+
+// Validate проверяет данные сообщения и возвращает *ValidationError со всеми
+// нарушениями.
+func (s *Schema) Validate(data string) error {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return s.invalid(FieldError{Reason: "некорректный JSON: " + err.Error()})
+	}
+	if dec.More() {
+		return s.invalid(FieldError{Reason: "после JSON-объекта есть лишние данные"})
+	}
+	obj, ok := doc.(map[string]any)
+	if !ok {
+		return s.invalid(FieldError{Reason: "данные должны быть JSON-объектом"})
+	}
+
+	var errs []FieldError
+	for _, f := range s.fields {
+		value, exists := lookup(obj, f.path)
+		if !exists {
+			if f.required {
+				errs = append(errs, FieldError{f.name, "обязательное поле отсутствует"})
+			}
+			continue
+		}
+		if reason := f.check(value); reason != "" {
+			errs = append(errs, FieldError{f.name, reason})
+		}
+	}
+	if !s.allowExtra {
+		errs = append(errs, s.extra(obj, "")...)
+	}
+
+	if len(errs) > 0 {
+		return s.invalid(errs...)
+	}
+	return nil
+}
+
+func (s *Schema) invalid(errs ...FieldError) error {
+	return &ValidationError{Version: s.Version, Fields: errs}
+}
+
+// extra находит поля, не описанные схемой. Содержимое полей типа object
+// и any без описанных вложенных полей не проверяется.
+func (s *Schema) extra(obj map[string]any, prefix string) []FieldError {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var errs []FieldError
+	for _, key := range keys {
+		path := prefix + key
+		if !s.known[path] {
+			errs = append(errs, FieldError{path, "поле не описано в схеме"})
+			continue
+		}
+		if nested, ok := obj[key].(map[string]any); ok && s.hasChildren(path) {
+			errs = append(errs, s.extra(nested, path+".")...)
+		}
+	}
+	return errs
+}
+
+func (s *Schema) hasChildren(path string) bool {
+	for known := range s.known {
+		if strings.HasPrefix(known, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func lookup(obj map[string]any, path []string) (any, bool) {
+	var value any = obj
+	for _, key := range path {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// check возвращает причину, по которой значение не подходит полю, или "".
+func (f field) check(value any) string {
+	if value == nil {
+		if f.required {
+			return "обязательное поле равно null"
+		}
+		return ""
+	}
+
+	actual := typeOf(value)
+	switch {
+	case f.typ == TypeAny:
+	case f.typ == TypeNumber && actual == TypeInteger:
+	case f.typ != actual:
+		return fmt.Sprintf("ожидался тип %s, получен %s", f.typ, actual)
+	}
+
+	if str, ok := value.(string); ok {
+		if f.pattern != nil && !f.pattern.MatchString(str) {
+			return fmt.Sprintf("значение %q не соответствует шаблону %s", str, f.pattern)
+		}
+		if len(f.enum) > 0 && !slices.Contains(f.enum, str) {
+			return fmt.Sprintf("значение %q не входит в [%s]", str, strings.Join(f.enum, ", "))
+		}
+	}
+	return ""
+}
+
+func typeOf(value any) string {
+	switch v := value.(type) {
+	case string:
+		return TypeString
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return TypeInteger
+		}
+		return TypeNumber
+	case bool:
+		return TypeBoolean
+	case []any:
+		return TypeArray
+	default:
+		return TypeObject
+	}
+}
+
+// Registry - схемы по идентификатору файла (types.FileKey).
+type Registry struct {
+	schemas map[string]*Schema
+}
+
+// NewRegistry проверяет схемы всех файлов из конфигурации.
+func NewRegistry(cfg map[string]config.SchemaConfig) (*Registry, error) {
+	r := &Registry{schemas: make(map[string]*Schema, len(cfg))}
+	for fileID, sc := range cfg {
+		if err := fileid.ValidateKey(fileID); err != nil {
+			return nil, fmt.Errorf("схема файла %s: %w", fileID, err)
+		}
+		s, err := Compile(sc)
+		if err != nil {
+			return nil, fmt.Errorf("схема файла %s: %w", fileID, err)
+		}
+		r.schemas[fileID] = s
+	}
+	return r, nil
+}
+
+// Validate проверяет данные по схеме файла и возвращает версию схемы.
+// Для файлов без схемы и nil Registry возвращается пустая версия.
+func (r *Registry) Validate(fileID, data string) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	s, exists := r.schemas[fileID]
+	if !exists {
+		return "", nil
+	}
+	return s.Version, s.Validate(data)
+}
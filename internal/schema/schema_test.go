@@ -0,0 +1,160 @@
+package schema
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+)
+
+func TestValidate(t *testing.T) {
+	s, err := Compile(config.SchemaConfig{
+		Version: "v1",
+		Fields: []config.SchemaField{
+			{Name: "level", Type: TypeString, Required: true, Enum: []string{"info", "warn", "error"}},
+			{Name: "code", Type: TypeString, Pattern: `^[A-Z]{3}-\d+$`},
+			{Name: "count", Type: TypeInteger},
+			{Name: "amount", Type: TypeNumber},
+			{Name: "user.id", Type: TypeInteger, Required: true},
+			{Name: "user.admin", Type: TypeBoolean},
+			{Name: "tags", Type: TypeArray},
+			{Name: "extra", Type: TypeAny},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     string
+		expected []FieldError
+	}{
+		{name: "все поля", data: `{"level":"info","code":"ABC-1","count":3,"amount":1.5,"user":{"id":7,"admin":false},"tags":["a"],"extra":{"x":1}}`},
+		{name: "только обязательные", data: `{"level":"warn","user":{"id":1},"count":null}`},
+		{name: "целое в поле number", data: `{"level":"info","amount":10,"user":{"id":1}}`},
+		{
+			name:     "отсутствуют обязательные",
+			data:     `{"user":{}}`,
+			expected: []FieldError{{"level", "обязательное поле отсутствует"}, {"user.id", "обязательное поле отсутствует"}},
+		},
+		{
+			name: "неверные типы",
+			data: `{"level":1,"count":1.5,"user":{"id":"7","admin":"yes"},"tags":{}}`,
+			expected: []FieldError{
+				{"level", "ожидался тип string, получен integer"},
+				{"count", "ожидался тип integer, получен number"},
+				{"user.id", "ожидался тип integer, получен string"},
+				{"user.admin", "ожидался тип boolean, получен string"},
+				{"tags", "ожидался тип array, получен object"},
+			},
+		},
+		{
+			name: "ограничения строк",
+			data: `{"level":"debug","code":"abc-1","user":{"id":1}}`,
+			expected: []FieldError{
+				{"level", `значение "debug" не входит в [info, warn, error]`},
+				{"code", `значение "abc-1" не соответствует шаблону ^[A-Z]{3}-\d+$`},
+			},
+		},
+		{
+			name:     "обязательное поле null",
+			data:     `{"level":null,"user":{"id":1}}`,
+			expected: []FieldError{{"level", "обязательное поле равно null"}},
+		},
+		{
+			name:     "неописанные поля",
+			data:     `{"level":"info","user":{"id":1,"name":"x"},"zone":"eu"}`,
+			expected: []FieldError{{"user.name", "поле не описано в схеме"}, {"zone", "поле не описано в схеме"}},
+		},
+		{name: "не JSON", data: `level=info`, expected: []FieldError{{"", "некорректный JSON: invalid character 'l' looking for beginning of value"}}},
+		{name: "не объект", data: `["info"]`, expected: []FieldError{{"", "данные должны быть JSON-объектом"}}},
+		{name: "лишние данные", data: `{"level":"info","user":{"id":1}} {}`, expected: []FieldError{{"", "после JSON-объекта есть лишние данные"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate(tt.data)
+			if tt.expected == nil {
+				if err != nil {
+					t.Fatalf("данные по схеме отклонены: %v", err)
+				}
+				return
+			}
+
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || !errors.Is(err, ErrInvalid) {
+				t.Fatalf("ожидалась ошибка проверки, получено %v", err)
+			}
+			if invalid.Version != "v1" || !reflect.DeepEqual(invalid.Fields, tt.expected) {
+				t.Errorf("ожидалось %v, получено %v", tt.expected, invalid.Fields)
+			}
+		})
+	}
+}
+
+func TestValidateAllowExtra(t *testing.T) {
+	s, err := Compile(config.SchemaConfig{
+		Version:    "v1",
+		Fields:     []config.SchemaField{{Name: "level", Type: TypeString}},
+		AllowExtra: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Validate(`{"level":"info","zone":"eu"}`); err != nil {
+		t.Errorf("неописанные поля должны допускаться: %v", err)
+	}
+}
+
+func TestCompileRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.SchemaConfig
+	}{
+		{"без версии", config.SchemaConfig{}},
+		{"пустое имя", config.SchemaConfig{Version: "v1", Fields: []config.SchemaField{{Type: TypeString}}}},
+		{"пустая часть пути", config.SchemaConfig{Version: "v1", Fields: []config.SchemaField{{Name: "user..id", Type: TypeString}}}},
+		{"неизвестный тип", config.SchemaConfig{Version: "v1", Fields: []config.SchemaField{{Name: "a", Type: "date"}}}},
+		{"Enum не у строки", config.SchemaConfig{Version: "v1", Fields: []config.SchemaField{{Name: "a", Type: TypeInteger, Enum: []string{"1"}}}}},
+		{"некорректный Pattern", config.SchemaConfig{Version: "v1", Fields: []config.SchemaField{{Name: "a", Type: TypeString, Pattern: "("}}}},
+		{"поле дважды", config.SchemaConfig{Version: "v1", Fields: []config.SchemaField{{Name: "a", Type: TypeString}, {Name: "a", Type: TypeAny}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(tt.cfg); err == nil {
+				t.Error("ожидалась ошибка конфигурации")
+			}
+		})
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r, err := NewRegistry(map[string]config.SchemaConfig{
+		"acme/orders": {Version: "2026-10", Fields: []config.SchemaField{{Name: "id", Type: TypeInteger, Required: true}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version, err := r.Validate("acme/orders", `{"id":1}`); err != nil || version != "2026-10" {
+		t.Errorf("ожидалась версия 2026-10 без ошибки, получено %q (%v)", version, err)
+	}
+	if _, err := r.Validate("acme/orders", `{}`); !errors.Is(err, ErrInvalid) {
+		t.Errorf("ожидалась ошибка %v, получено %v", ErrInvalid, err)
+	}
+	if version, err := r.Validate("orders", "любые данные"); err != nil || version != "" {
+		t.Errorf("файл без схемы не проверяется, получено %q (%v)", version, err)
+	}
+
+	for _, key := range []string{"Acme/orders", "acme/orders/v1", "acme/"} {
+		if _, err := NewRegistry(map[string]config.SchemaConfig{key: {Version: "v1"}}); err == nil {
+			t.Errorf("ожидалась ошибка для ключа %q", key)
+		}
+	}
+
+	var empty *Registry
+	if _, err := empty.Validate("acme/orders", "любые данные"); err != nil {
+		t.Errorf("nil Registry не должен проверять данные: %v", err)
+	}
+}
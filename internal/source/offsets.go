@@ -0,0 +1,136 @@
+package source
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fingerprintBytes - сколько байт с начала файла определяют его содержимое.
+// По отпечатку после перезапуска отличается тот же файл от нового с тем же именем.
+const fingerprintBytes = 256
+
+// Offset - позиция чтения файла.
+type Offset struct {
+	Offset      int64  `json:"offset"`
+	Fingerprint string `json:"fingerprint"`
+	Length      int    `json:"fingerprint_length"` // сколько байт вошло в отпечаток
+}
+
+// Offsets - позиции чтения файлов по пути.
+type Offsets struct {
+	mutex   sync.Mutex
+	offsets map[string]Offset
+	dirty   bool
+}
+
+func NewOffsets() *Offsets {
+	return &Offsets{offsets: make(map[string]Offset)}
+}
+
+// LoadOffsets читает позиции из файла. Если файла нет, позиции пустые.
+func LoadOffsets(path string) (*Offsets, error) {
+	o := NewOffsets()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &o.offsets); err != nil {
+		return nil, fmt.Errorf("поврежден файл позиций %s: %w", path, err)
+	}
+	return o, nil
+}
+
+func (o *Offsets) Get(path string) (Offset, bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	offset, exists := o.offsets[path]
+	return offset, exists
+}
+
+func (o *Offsets) Set(path string, offset Offset) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.offsets[path] != offset {
+		o.offsets[path] = offset
+		o.dirty = true
+	}
+}
+
+// Save атомарно записывает позиции, если они изменились после прошлой записи.
+func (o *Offsets) Save(path string) error {
+	o.mutex.Lock()
+	if !o.dirty {
+		o.mutex.Unlock()
+		return nil
+	}
+	data, err := json.MarshalIndent(o.offsets, "", "  ")
+	o.dirty = false
+	o.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	markDirty := func() {
+		o.mutex.Lock()
+		o.dirty = true
+		o.mutex.Unlock()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		markDirty()
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		markDirty()
+		return err
+	}
+	return nil
+}
+
+// fingerprint возвращает отпечаток первых байт файла (не больше limit).
+func fingerprint(file *os.File, limit int64) (string, int, error) {
+	buf := make([]byte, min(limit, fingerprintBytes))
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+	sum := sha256.Sum256(buf[:n])
+	return hex.EncodeToString(sum[:]), n, nil
+}
+
+// resume возвращает позицию, с которой продолжить чтение file: сохраненную,
+// если файл тот же и не стал короче, иначе 0.
+func resume(file *os.File, saved Offset) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if saved.Offset == 0 || info.Size() < saved.Offset {
+		return 0, nil
+	}
+	fp, _, err := fingerprint(file, int64(saved.Length))
+	if err != nil {
+		return 0, err
+	}
+	if fp != saved.Fingerprint {
+		return 0, nil
+	}
+	return saved.Offset, nil
+}
@@ -0,0 +1,430 @@
+// Package source - прием сообщений из локальных файлов: каждая строка файла
+// становится сообщением для FileID источника. В режиме tail источник следит
+// за дописыванием в файл, переживая ротацию и обрезку, в режиме import -
+// читает файлы каталога один раз. Позиции чтения сохраняются, поэтому после
+// перезапуска уже принятые строки не отправляются повторно.
+package source
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/metrics"
+)
+
+const (
+	ModeTail   = "tail"
+	ModeImport = "import"
+
+	saveInterval        = 5 * time.Second
+	defaultPollInterval = time.Second
+)
+
+var sourceLines = metrics.Default.NewCounterVec(
+	"app_source_lines_total", "Количество строк, прочитанных из локальных файлов", "result")
+
+type Source struct {
+	svc     *ingest.Service
+	cfg     *config.Config
+	offsets *Offsets
+	poll    time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSource проверяет источники из конфигурации и загружает сохраненные позиции.
+func NewSource(svc *ingest.Service, cfg *config.Config) (*Source, error) {
+	for i, src := range cfg.FileSources {
+		if src.Mode != ModeTail && src.Mode != ModeImport {
+			return nil, fmt.Errorf("источник %d: неизвестный режим %q", i+1, src.Mode)
+		}
+		if src.Path == "" || src.Token == "" || src.FileID == "" {
+			return nil, fmt.Errorf("источник %d: нужны Path, Token и FileID", i+1)
+		}
+	}
+
+	offsets := NewOffsets()
+	if cfg.FileSourceOffsets != "" {
+		var err error
+		if offsets, err = LoadOffsets(cfg.FileSourceOffsets); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &Source{
+		svc:     svc,
+		cfg:     cfg,
+		offsets: offsets,
+		poll:    cfg.FileSourcePollInterval,
+	}
+	if s.poll <= 0 {
+		s.poll = defaultPollInterval
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s, nil
+}
+
+// Enabled сообщает, заданы ли в конфигурации источники.
+func Enabled(cfg *config.Config) bool {
+	return len(cfg.FileSources) > 0
+}
+
+func (s *Source) Name() string {
+	return "files"
+}
+
+// Serve читает все источники. Возвращается, когда импорт завершен и нет
+// источников tail, или после Shutdown.
+func (s *Source) Serve() error {
+	s.wg.Add(len(s.cfg.FileSources))
+	for _, src := range s.cfg.FileSources {
+		go func() {
+			defer s.wg.Done()
+			log := slog.With("path", src.Path, logger.KeyFileID, src.FileID, "mode", src.Mode)
+			ctx := logger.WithRequestID(s.ctx, logger.NewID())
+			var err error
+			if src.Mode == ModeTail {
+				err = s.tail(ctx, src, log)
+			} else {
+				err = s.importFiles(ctx, src, log)
+			}
+			if err != nil && s.ctx.Err() == nil {
+				log.Error("чтение источника остановлено", logger.KeyError, err)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			s.saveOffsets()
+			return nil
+		case <-ticker.C:
+			s.saveOffsets()
+		}
+	}
+}
+
+// Shutdown прекращает чтение и сохраняет позиции. Строки, уже принятые
+// приложением, будут записаны при его остановке.
+func (s *Source) Shutdown(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	s.saveOffsets()
+	return nil
+}
+
+func (s *Source) saveOffsets() {
+	if s.cfg.FileSourceOffsets == "" {
+		return
+	}
+	if err := s.offsets.Save(s.cfg.FileSourceOffsets); err != nil {
+		slog.Error("не удалось сохранить позиции чтения источников", logger.KeyError, err)
+	}
+}
+
+// importFiles читает один раз каждый файл каталога или шаблона src.Path.
+func (s *Source) importFiles(ctx context.Context, src config.FileSource, log *slog.Logger) error {
+	paths, err := expand(src.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		r, err := s.open(path, true)
+		if err != nil {
+			return err
+		}
+		err = s.drain(ctx, r, src, true)
+		r.close()
+		if err != nil {
+			return err
+		}
+		log.Info("файл импортирован", "file", path, "offset", r.pos)
+		s.saveOffsets()
+	}
+	return nil
+}
+
+// expand возвращает файлы каталога (без вложенных) или файлы по шаблону.
+func expand(pattern string) ([]string, error) {
+	info, err := os.Stat(pattern)
+	if err == nil && info.IsDir() {
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, err
+		}
+		var paths []string
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				paths = append(paths, filepath.Join(pattern, entry.Name()))
+			}
+		}
+		return paths, nil
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// tail следит за файлом src.Path. Файл, заменивший прежний при ротации или
+// появившийся после запуска, читается с начала; обрезанный файл - тоже.
+func (s *Source) tail(ctx context.Context, src config.FileSource, log *slog.Logger) error {
+	var r *reader
+	defer func() {
+		if r != nil {
+			r.close()
+		}
+	}()
+	resumeSaved := true
+
+	for {
+		if r == nil {
+			var err error
+			r, err = s.open(src.Path, resumeSaved)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if r != nil {
+				resumeSaved = false
+				log.Info("чтение файла", "offset", r.pos)
+			}
+		}
+
+		// ротация проверяется до чтения, чтобы дочитать прежний файл до конца
+		isRotated := r != nil && r.rotated()
+		if r != nil && !isRotated && r.truncated() {
+			log.Warn("файл обрезан, чтение с начала")
+			if err := r.reset(); err != nil {
+				return err
+			}
+		}
+
+		if r != nil {
+			if err := s.drain(ctx, r, src, isRotated); err != nil {
+				return err
+			}
+		}
+
+		if isRotated {
+			log.Info("файл ротирован, чтение нового файла")
+			r.close()
+			r = nil
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.poll):
+		}
+	}
+}
+
+// drain отправляет строки, дописанные в файл. Незаконченная последняя строка
+// ждет продолжения, если не final.
+func (s *Source) drain(ctx context.Context, r *reader, src config.FileSource, final bool) error {
+	for {
+		line, n, err := r.readLine(final)
+		if err != nil || n == 0 {
+			return err
+		}
+		// файл могли обрезать и дописать между проверкой в tail и чтением:
+		// такая строка - середина нового содержимого, файл читается с начала
+		if !final && r.truncated() {
+			return r.reset()
+		}
+		if strings.TrimSpace(line) != "" {
+			if sendErr := s.send(ctx, src, line); sendErr != nil {
+				return sendErr
+			}
+		}
+		r.advance(n)
+		s.offsets.Set(r.path, r.offset())
+	}
+}
+
+// send передает строку как сообщение. При превышении лимита скорости и пока
+// пользователь файла еще не добавлен, отправка повторяется. Строки, которые
+// приложение отклонило (например, сверх квоты), пропускаются.
+func (s *Source) send(ctx context.Context, src config.FileSource, line string) error {
+	waitingUser := false
+	for {
+		_, err := s.svc.SendMessage(ctx, src.Token, src.FileID, line)
+		if err == nil {
+			sourceLines.Inc("accepted")
+			return nil
+		}
+
+		wait := s.poll
+		var rateErr *handler.RateLimitError
+		switch {
+		case errors.As(err, &rateErr):
+			wait = rateErr.RetryAfter
+		case errors.Is(err, ingest.ErrUserNotFound), errors.Is(err, ingest.ErrNoChannel):
+			// пользователи добавляются через API, источник ждет своего
+			if !waitingUser {
+				slog.Warn("источник ждет добавления пользователя", logger.KeyFileID, src.FileID)
+				waitingUser = true
+			}
+		case ingest.CodeOf(err) == ingest.CodeUnavailable:
+			return err
+		default:
+			slog.Warn("строка источника не принята", logger.KeyFileID, src.FileID, logger.KeyError, err)
+			sourceLines.Inc("rejected")
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// reader читает строки файла и помнит позицию после последней отправленной.
+type reader struct {
+	path    string
+	file    *os.File
+	r       *bufio.Reader
+	pos     int64
+	partial strings.Builder // начало строки, которая еще не дописана
+	fp      string
+	fpLen   int
+}
+
+// open открывает файл и, если resumeSaved, продолжает с сохраненной позиции.
+func (s *Source) open(path string, resumeSaved bool) (*reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{path: path, file: file}
+
+	if saved, exists := s.offsets.Get(path); exists && resumeSaved {
+		if r.pos, err = resume(file, saved); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	if _, err := file.Seek(r.pos, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	r.r = bufio.NewReader(file)
+	return r, nil
+}
+
+func (r *reader) close() {
+	r.file.Close()
+}
+
+// readLine возвращает следующую строку без перевода строки и число байт,
+// которое она занимает в файле. n == 0 - полной строки пока нет.
+func (r *reader) readLine(final bool) (string, int, error) {
+	for {
+		chunk, err := r.r.ReadString('\n')
+		r.partial.WriteString(chunk)
+		if err == nil || (final && err == io.EOF && r.partial.Len() > 0) {
+			raw := r.partial.String()
+			r.partial.Reset()
+			return strings.TrimRight(raw, "\r\n"), len(raw), nil
+		}
+		if err == io.EOF {
+			return "", 0, nil
+		}
+		return "", 0, err
+	}
+}
+
+func (r *reader) advance(n int) {
+	r.pos += int64(n)
+}
+
+// offset возвращает позицию для сохранения. Отпечаток строится по уже
+// прочитанному началу файла, пока оно короче fingerprintBytes.
+func (r *reader) offset() Offset {
+	if r.fpLen < fingerprintBytes && int64(r.fpLen) < r.pos {
+		if fp, n, err := fingerprint(r.file, r.pos); err == nil {
+			r.fp, r.fpLen = fp, n
+		}
+	}
+	return Offset{Offset: r.pos, Fingerprint: r.fp, Length: r.fpLen}
+}
+
+// rotated сообщает, что под путем теперь другой файл или файла нет.
+func (r *reader) rotated() bool {
+	current, err := os.Stat(r.path)
+	if err != nil {
+		return true
+	}
+	opened, err := r.file.Stat()
+	return err != nil || !os.SameFile(current, opened)
+}
+
+// truncated сообщает, что файл стал короче прочитанного или его начало
+// изменилось: файл обрезали и сразу записали в него больше, чем было.
+func (r *reader) truncated() bool {
+	info, err := r.file.Stat()
+	if err != nil {
+		return false
+	}
+	if info.Size() < r.pos+int64(r.partial.Len()) {
+		return true
+	}
+	if r.fpLen == 0 {
+		return false
+	}
+	fp, n, err := fingerprint(r.file, int64(r.fpLen))
+	return err == nil && (n != r.fpLen || fp != r.fp)
+}
+
+func (r *reader) reset() error {
+	if _, err := r.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r.pos, r.fp, r.fpLen = 0, "", 0
+	r.partial.Reset()
+	r.r.Reset(r.file)
+	return nil
+}
@@ -0,0 +1,239 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+func setupConfig(t *testing.T, sources ...config.FileSource) *config.Config {
+	return &config.Config{
+		ValidTokens:            []string{"valid_token_1"},
+		WorkerInterval:         50 * time.Millisecond,
+		FilesDir:               t.TempDir(),
+		NumWorkers:             1,
+		MaxRetries:             3,
+		RetryInterval:          50 * time.Millisecond,
+		FileSources:            sources,
+		FileSourceOffsets:      filepath.Join(t.TempDir(), "offsets.json"),
+		FileSourcePollInterval: 20 * time.Millisecond,
+	}
+}
+
+// start запускает приложение и, если addUser, добавляет пользователя valid_token_1
+// с файлом file1. Возвращает сервис приема и функцию добавления пользователя.
+func start(t *testing.T, cfg *config.Config, addUser bool) (*ingest.Service, func()) {
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := app.NewApp(cfg, &types.DefaultFileWriter{}, userRepo)
+	msgHandler := handler.NewMessageHandler(userRepo, application, cfg)
+	svc := ingest.NewService(application, msgHandler, userRepo)
+
+	add := func() {
+		if _, err := svc.AddUser(context.Background(), ingest.NewUser{Token: "valid_token_1", FileID: "file1"}); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+	if addUser {
+		add()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return svc, add
+}
+
+// serve запускает источник и останавливает его в конце теста.
+func serve(t *testing.T, svc *ingest.Service, cfg *config.Config) *Source {
+	s, err := NewSource(svc, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan struct{})
+	go func() {
+		s.Serve()
+		close(served)
+	}()
+	t.Cleanup(func() {
+		s.Shutdown(context.Background())
+		<-served
+	})
+	return s
+}
+
+func waitFile(t *testing.T, path string, expected []string) {
+	want := strings.Join(expected, "\n") + "\n"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if string(data) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ожидалось содержимое файла %q, получено %q", want, data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func writeFile(t *testing.T, path, data string, flag int) {
+	file, err := os.OpenFile(path, flag|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportResumesWithoutDuplicates(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.log"), "a1\r\n\na2\n", os.O_TRUNC)
+	writeFile(t, filepath.Join(dir, "b.log"), "b1\nb2 без перевода строки", os.O_TRUNC)
+
+	cfg := setupConfig(t, config.FileSource{Path: dir, Mode: ModeImport, Token: "valid_token_1", FileID: "file1"})
+	svc, _ := start(t, cfg, true)
+	target := filepath.Join(cfg.FilesDir, "file1.txt")
+
+	s, err := NewSource(svc, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(); err != nil {
+		t.Fatalf("импорт завершился с ошибкой: %v", err)
+	}
+	waitFile(t, target, []string{"a1", "a2", "b1", "b2 без перевода строки"})
+
+	// повторный импорт после перезапуска передает только новые строки
+	writeFile(t, filepath.Join(dir, "a.log"), "a3\n", os.O_APPEND)
+	s, err = NewSource(svc, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Serve(); err != nil {
+		t.Fatalf("импорт завершился с ошибкой: %v", err)
+	}
+	waitFile(t, target, []string{"a1", "a2", "b1", "b2 без перевода строки", "a3"})
+}
+
+func TestTailRotationAndTruncation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, path, "old\n", os.O_TRUNC)
+
+	cfg := setupConfig(t, config.FileSource{Path: path, Mode: ModeTail, Token: "valid_token_1", FileID: "file1"})
+	svc, _ := start(t, cfg, true)
+	serve(t, svc, cfg)
+	target := filepath.Join(cfg.FilesDir, "file1.txt")
+	waitFile(t, target, []string{"old"})
+
+	// незаконченная строка ждет продолжения
+	writeFile(t, path, "par", os.O_APPEND)
+	time.Sleep(100 * time.Millisecond)
+	writeFile(t, path, "tial\n", os.O_APPEND)
+	waitFile(t, target, []string{"old", "partial"})
+
+	// строки, дописанные перед ротацией, дочитываются из прежнего файла
+	writeFile(t, path, "before rotation\n", os.O_APPEND)
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "rotated\n", os.O_TRUNC)
+	waitFile(t, target, []string{"old", "partial", "before rotation", "rotated"})
+
+	writeFile(t, path, "truncated\n", os.O_TRUNC)
+	waitFile(t, target, []string{"old", "partial", "before rotation", "rotated", "truncated"})
+}
+
+func TestTailWaitsForUserAndResumes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, path, "one\n", os.O_TRUNC)
+
+	cfg := setupConfig(t, config.FileSource{Path: path, Mode: ModeTail, Token: "valid_token_1", FileID: "file1"})
+	svc, addUser := start(t, cfg, false)
+	s, err := NewSource(svc, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan struct{})
+	go func() {
+		s.Serve()
+		close(served)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	addUser()
+	target := filepath.Join(cfg.FilesDir, "file1.txt")
+	waitFile(t, target, []string{"one"})
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	<-served
+
+	// после перезапуска источника чтение продолжается с сохраненной позиции
+	writeFile(t, path, "two\n", os.O_APPEND)
+	serve(t, svc, cfg)
+	waitFile(t, target, []string{"one", "two"})
+}
+
+func TestResumeChecksFingerprint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	writeFile(t, path, "first line\nsecond line\n", os.O_TRUNC)
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, n, err := fingerprint(file, 11)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := Offset{Offset: 11, Fingerprint: fp, Length: n}
+
+	tests := []struct {
+		name     string
+		data     string
+		expected int64
+	}{
+		{"тот же файл дописан", "first line\nsecond line\nthird\n", 11},
+		{"файл заменен другим", "other line\nsecond line\n", 0},
+		{"файл короче позиции", "first\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeFile(t, path, tt.data, os.O_TRUNC)
+			file, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			offset, err := resume(file, saved)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offset != tt.expected {
+				t.Errorf("ожидалась позиция %d, получено %d", tt.expected, offset)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Retention - правила хранения ротированных сегментов одного файла (0 - без ограничения).
+// Текущий файл <fileID>.txt правилами не затрагивается.
+type Retention struct {
+	MaxSegments   int
+	MaxAge        time.Duration
+	MaxTotalBytes int64
+}
+
+func (r Retention) Enabled() bool {
+	return r.MaxSegments > 0 || r.MaxAge > 0 || r.MaxTotalBytes > 0
+}
+
+var segmentRe = regexp.MustCompile(`^(.+)\.\d{4}-\d{2}-\d{2}(T\d{2})?(\.\d+)?\.txt(\.gz)?$`)
+
+type segment struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// RemovedSegment - удаленный сегмент файла FileID и объем записанных в него
+// данных (у сжатого сегмента - до сжатия).
+type RemovedSegment struct {
+	Path     string
+	FileID   string
+	DataSize int64
+}
+
+// EnforceRetention удаляет в каталоге dir сегменты, выходящие за правила хранения,
+// и возвращает удаленные сегменты.
+func EnforceRetention(dir string, retention Retention, now time.Time) ([]RemovedSegment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byFile := make(map[string][]segment)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := segmentRe.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		byFile[m[1]] = append(byFile[m[1]], segment{
+			path:    filepath.Join(dir, entry.Name()),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+
+	var removed []RemovedSegment
+	for fileID, segments := range byFile {
+		// от новых к старым: удаляются всегда самые старые сегменты
+		sort.Slice(segments, func(i, j int) bool {
+			return segments[i].modTime.After(segments[j].modTime)
+		})
+
+		var total int64
+		for i, seg := range segments {
+			total += seg.size
+			expired := (retention.MaxSegments > 0 && i >= retention.MaxSegments) ||
+				(retention.MaxAge > 0 && now.Sub(seg.modTime) > retention.MaxAge) ||
+				(retention.MaxTotalBytes > 0 && total > retention.MaxTotalBytes)
+			if !expired {
+				continue
+			}
+			dataSize := seg.dataSize()
+			if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+				return removed, err
+			}
+			removed = append(removed, RemovedSegment{Path: seg.path, FileID: fileID, DataSize: dataSize})
+		}
+	}
+
+	return removed, nil
+}
+
+// dataSize возвращает объем данных сегмента. Для сжатого сегмента он берется
+// из трейлера gzip (ISIZE - размер до сжатия по модулю 4 ГиБ, сегменты
+// ротируются раньше), при ошибке чтения - размер файла на диске.
+func (s segment) dataSize() int64 {
+	if filepath.Ext(s.path) != ".gz" || s.size < 4 {
+		return s.size
+	}
+	file, err := os.Open(s.path)
+	if err != nil {
+		return s.size
+	}
+	defer file.Close()
+
+	var isize [4]byte
+	if _, err := file.ReadAt(isize[:], s.size-4); err != nil {
+		return s.size
+	}
+	return int64(binary.LittleEndian.Uint32(isize[:]))
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+const (
+	RotateHourly = "hourly"
+	RotateDaily  = "daily"
+)
+
+// Rotation - правила ротации файлов. Текущие данные всегда пишутся в
+// <fileID>.txt, при ротации он переименовывается в сегмент вида
+// <fileID>.2026-10-16.txt (или <fileID>.2026-10-16T15.txt для почасовой).
+type Rotation struct {
+	MaxBytes int64  // ротация по размеру (0 - отключена)
+	Interval string // ротация по времени: hourly, daily или пусто
+	Compress bool   // сжимать сегменты gzip
+}
+
+type segmentState struct {
+	mutex  sync.Mutex
+	period time.Time
+	size   int64
+	loaded bool
+}
+
+// RotatingFileWriter пишет сообщения так же, как DefaultFileWriter, но
+// ротирует файл по размеру и по времени. Все операции с файлами выполняются
+// относительно каталога root (см. types.OpenRoot).
+type RotatingFileWriter struct {
+	root     string
+	rotation Rotation
+	now      func() time.Time
+
+	mutex sync.Mutex
+	files map[string]*segmentState
+}
+
+func NewRotatingFileWriter(root string, rotation Rotation) *RotatingFileWriter {
+	return &RotatingFileWriter{
+		root:     root,
+		rotation: rotation,
+		now:      time.Now,
+		files:    make(map[string]*segmentState),
+	}
+}
+
+func (w *RotatingFileWriter) state(filePath string) *segmentState {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	st, exists := w.files[filePath]
+	if !exists {
+		st = &segmentState{}
+		w.files[filePath] = st
+	}
+	return st
+}
+
+func (w *RotatingFileWriter) WriteToFile(filePath string, messages []types.Message) error {
+	st := w.state(filePath)
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	root, name, err := types.OpenRoot(w.root, filePath)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	now := w.now()
+	if !st.loaded {
+		// состояние уже существующего файла восстанавливается по его размеру и времени изменения
+		st.period = w.periodStart(now)
+		if info, err := root.Stat(name); err == nil {
+			st.size = info.Size()
+			st.period = w.periodStart(info.ModTime())
+		}
+		st.loaded = true
+	}
+
+	var batchSize int64
+	for _, msg := range messages {
+		batchSize += int64(len(msg.Data)) + 1
+	}
+
+	period := w.periodStart(now)
+	needRotate := st.size > 0 && (!period.Equal(st.period) ||
+		(w.rotation.MaxBytes > 0 && st.size+batchSize > w.rotation.MaxBytes))
+	if needRotate {
+		if err := w.rotate(root, name, st.period); err != nil {
+			return fmt.Errorf("не удалось ротировать файл %s: %w", filePath, err)
+		}
+		st.size = 0
+	}
+	st.period = period
+
+	if err := (&types.DefaultFileWriter{Root: w.root}).WriteToFile(filePath, messages); err != nil {
+		// размер файла после частичной записи неизвестен, перечитаем его при следующей записи
+		st.loaded = false
+		return err
+	}
+	st.size += batchSize
+
+	return nil
+}
+
+// periodStart возвращает начало периода ротации по времени, в который попадает t.
+func (w *RotatingFileWriter) periodStart(t time.Time) time.Time {
+	switch w.rotation.Interval {
+	case RotateHourly:
+		return t.Truncate(time.Hour)
+	case RotateDaily:
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+func (w *RotatingFileWriter) stamp(period time.Time) string {
+	if period.IsZero() {
+		period = w.now()
+	}
+	if w.rotation.Interval == RotateHourly {
+		return period.Format("2006-01-02T15")
+	}
+	return period.Format("2006-01-02")
+}
+
+// rotate переименовывает текущий файл в сегмент периода. Если сегмент за этот
+// период уже есть (ротация по размеру), добавляется порядковый номер.
+func (w *RotatingFileWriter) rotate(root *os.Root, name string, period time.Time) error {
+	base := strings.TrimSuffix(name, ".txt") + "." + w.stamp(period)
+
+	var segment string
+	for i := 0; ; i++ {
+		segment = base + ".txt"
+		if i > 0 {
+			segment = fmt.Sprintf("%s.%d.txt", base, i)
+		}
+		if !exists(root, segment) && !exists(root, segment+".gz") {
+			break
+		}
+	}
+
+	if err := root.Rename(name, segment); err != nil {
+		return err
+	}
+	slog.Info("файл ротирован", "path", name, "segment", filepath.Base(segment))
+
+	if w.rotation.Compress {
+		if err := compress(root, segment); err != nil {
+			// несжатый сегмент остается на диске, данные не теряются
+			slog.Error("не удалось сжать сегмент", "segment", segment, logger.KeyError, err)
+		}
+	}
+	return nil
+}
+
+func exists(root *os.Root, name string) bool {
+	_, err := root.Lstat(name)
+	return err == nil
+}
+
+func compress(root *os.Root, name string) error {
+	src, err := root.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := root.OpenFile(name+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		root.Remove(name + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		root.Remove(name + ".gz")
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		root.Remove(name + ".gz")
+		return err
+	}
+
+	return root.Remove(name)
+}
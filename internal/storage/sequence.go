@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+// sequencePath - файл с последним номером записанного сообщения файла fileID
+// (types.FileKey): <dir>/<fileID>.seq. Каталог dir находится вне каталога
+// файлов, поэтому ротация и правила хранения его не затрагивают.
+func sequencePath(dir, fileID string) string {
+	return filepath.Join(dir, filepath.FromSlash(fileID)+".seq")
+}
+
+// LoadSequence возвращает номер последнего записанного сообщения файла fileID,
+// сохраненный SaveSequence в каталоге dir; отсутствие сохраненного номера - 0.
+func LoadSequence(dir, fileID string) (int64, error) {
+	r, name, err := types.OpenRoot(dir, sequencePath(dir, fileID))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	data, err := r.ReadFile(name)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("поврежден файл номера сообщений %s: %w", name, err)
+	}
+	return seq, nil
+}
+
+// SaveSequence атомарно сохраняет номер последнего записанного сообщения файла fileID.
+func SaveSequence(dir, fileID string, seq int64) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	r, name, err := types.OpenRoot(dir, sequencePath(dir, fileID))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := r.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	tmp := name + ".tmp"
+	if err := r.WriteFile(tmp, []byte(strconv.FormatInt(seq, 10)+"\n"), 0644); err != nil {
+		r.Remove(tmp)
+		return err
+	}
+	if err := r.Rename(tmp, name); err != nil {
+		r.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+func messages(data ...string) []types.Message {
+	result := make([]types.Message, len(data))
+	for i, d := range data {
+		result[i] = types.Message{FileID: "file1", Data: d}
+	}
+	return result
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("не удалось прочитать файл %s: %v", path, err)
+	}
+	return string(content)
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("не удалось прочитать каталог: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Проверяет ротацию по размеру: при превышении MaxBytes текущий файл
+// переносится в пронумерованный сегмент текущего периода.
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file1.txt")
+	w := NewRotatingFileWriter(dir, Rotation{MaxBytes: 10, Interval: RotateDaily})
+	w.now = func() time.Time { return time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC) }
+
+	for _, batch := range [][]string{{"aaaa"}, {"bbbb"}, {"cccc"}, {"dddd", "eeee"}} {
+		if err := w.WriteToFile(path, messages(batch...)); err != nil {
+			t.Fatalf("ошибка записи: %v", err)
+		}
+	}
+
+	expected := []string{"file1.2026-10-16.1.txt", "file1.2026-10-16.txt", "file1.txt"}
+	if names := listDir(t, dir); !slices.Equal(names, expected) {
+		t.Fatalf("Ожидались файлы %v, получено: %v", expected, names)
+	}
+	if content := readFile(t, filepath.Join(dir, "file1.2026-10-16.txt")); content != "aaaa\nbbbb\n" {
+		t.Errorf("неверное содержимое первого сегмента: %q", content)
+	}
+	if content := readFile(t, path); content != "dddd\neeee\n" {
+		t.Errorf("неверное содержимое текущего файла: %q", content)
+	}
+}
+
+// Проверяет ротацию по времени со сжатием: сегмент получает дату периода,
+// в который были записаны данные.
+func TestRotateByTimeCompressed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file1.txt")
+	now := time.Date(2026, 10, 16, 23, 59, 0, 0, time.UTC)
+	w := NewRotatingFileWriter(dir, Rotation{Interval: RotateDaily, Compress: true})
+	w.now = func() time.Time { return now }
+
+	if err := w.WriteToFile(path, messages("day1")); err != nil {
+		t.Fatalf("ошибка записи: %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+	if err := w.WriteToFile(path, messages("day2")); err != nil {
+		t.Fatalf("ошибка записи: %v", err)
+	}
+
+	expected := []string{"file1.2026-10-16.txt.gz", "file1.txt"}
+	if names := listDir(t, dir); !slices.Equal(names, expected) {
+		t.Fatalf("Ожидались файлы %v, получено: %v", expected, names)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "file1.2026-10-16.txt.gz"))
+	if err != nil {
+		t.Fatalf("не удалось открыть сегмент: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("сегмент не сжат: %v", err)
+	}
+	content, _ := io.ReadAll(zr)
+	if string(content) != "day1\n" {
+		t.Errorf("неверное содержимое сегмента: %q", content)
+	}
+	if content := readFile(t, path); content != "day2\n" {
+		t.Errorf("неверное содержимое текущего файла: %q", content)
+	}
+}
+
+// Проверяет, что без настроек ротации писатель ведет себя как DefaultFileWriter.
+func TestNoRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file1.txt")
+	w := NewRotatingFileWriter(dir, Rotation{})
+
+	for i := 0; i < 3; i++ {
+		if err := w.WriteToFile(path, messages("data")); err != nil {
+			t.Fatalf("ошибка записи: %v", err)
+		}
+	}
+
+	if names := listDir(t, dir); !slices.Equal(names, []string{"file1.txt"}) {
+		t.Fatalf("не ожидалось ротированных сегментов: %v", names)
+	}
+	if content := readFile(t, path); content != "data\ndata\ndata\n" {
+		t.Errorf("неверное содержимое файла: %q", content)
+	}
+}
+
+func TestEnforceRetention(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	segments := []struct {
+		name string
+		age  time.Duration
+		size int
+	}{
+		{"file1.txt", 0, 100},
+		{"file1.2026-10-17.txt.gz", 24 * time.Hour, 10},
+		{"file1.2026-10-16.txt", 48 * time.Hour, 10},
+		{"file1.2026-10-15.txt", 72 * time.Hour, 10},
+		{"file1.2026-10-01.txt", 17 * 24 * time.Hour, 10},
+		{"file2.2026-10-17T05.txt", 24 * time.Hour, 30},
+		{"file2.2026-10-16T05.txt", 48 * time.Hour, 30},
+		{"notes.md", 30 * 24 * time.Hour, 10},
+	}
+
+	cases := []struct {
+		name      string
+		retention Retention
+		expected  []string
+	}{
+		{
+			name:      "количество сегментов",
+			retention: Retention{MaxSegments: 2},
+			expected: []string{"file1.2026-10-16.txt", "file1.2026-10-17.txt.gz", "file1.txt",
+				"file2.2026-10-16T05.txt", "file2.2026-10-17T05.txt", "notes.md"},
+		},
+		{
+			name:      "возраст",
+			retention: Retention{MaxAge: 60 * time.Hour},
+			expected: []string{"file1.2026-10-16.txt", "file1.2026-10-17.txt.gz", "file1.txt",
+				"file2.2026-10-16T05.txt", "file2.2026-10-17T05.txt", "notes.md"},
+		},
+		{
+			name:      "общий размер",
+			retention: Retention{MaxTotalBytes: 30},
+			expected: []string{"file1.2026-10-15.txt", "file1.2026-10-16.txt", "file1.2026-10-17.txt.gz", "file1.txt",
+				"file2.2026-10-17T05.txt", "notes.md"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, seg := range segments {
+				path := filepath.Join(dir, seg.name)
+				if err := os.WriteFile(path, make([]byte, seg.size), 0644); err != nil {
+					t.Fatalf("не удалось создать файл: %v", err)
+				}
+				modTime := now.Add(-seg.age)
+				if err := os.Chtimes(path, modTime, modTime); err != nil {
+					t.Fatalf("не удалось изменить время файла: %v", err)
+				}
+			}
+
+			removed, err := EnforceRetention(dir, tc.retention, now)
+			if err != nil {
+				t.Fatalf("ошибка при удалении сегментов: %v", err)
+			}
+			if names := listDir(t, dir); !slices.Equal(names, tc.expected) {
+				t.Fatalf("Ожидались файлы %v, получено: %v", tc.expected, names)
+			}
+			if len(removed) != len(segments)-len(tc.expected) {
+				t.Fatalf("неверный список удаленных сегментов: %+v", removed)
+			}
+			for _, seg := range removed {
+				if !strings.HasPrefix(filepath.Base(seg.Path), seg.FileID+".") || seg.DataSize != 10 && seg.DataSize != 30 {
+					t.Errorf("неверное описание удаленного сегмента: %+v", seg)
+				}
+			}
+		})
+	}
+}
+
+// Проверяет, что для сжатого сегмента возвращается объем данных до сжатия.
+func TestEnforceRetentionCompressedSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file1.txt")
+	w := NewRotatingFileWriter(dir, Rotation{MaxBytes: 10, Compress: true})
+	for i := 0; i < 2; i++ {
+		if err := w.WriteToFile(path, messages("data-data")); err != nil {
+			t.Fatalf("ошибка записи: %v", err)
+		}
+	}
+
+	removed, err := EnforceRetention(dir, Retention{MaxAge: time.Nanosecond}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ошибка при удалении сегментов: %v", err)
+	}
+	if len(removed) != 1 || removed[0].FileID != "file1" || removed[0].DataSize != 10 {
+		t.Fatalf("ожидался сжатый сегмент file1 с 10 байтами данных, получено: %+v", removed)
+	}
+}
+
+// Проверяет, что никакой путь, в том числе через символическую ссылку на
+// внешний каталог, не приводит к записи за пределами каталога файлов.
+func FuzzWriteInsideSandbox(f *testing.F) {
+	for _, seed := range []string{"file1.txt", "../escape.txt", "link/escape.txt", "a/../../escape.txt", "/etc/escape.txt", "link", ".."} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		outside := t.TempDir()
+		sandbox := filepath.Join(outside, "files")
+		if err := os.Mkdir(sandbox, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(outside, filepath.Join(sandbox, "link")); err != nil {
+			t.Skip("символические ссылки не поддерживаются")
+		}
+
+		path := filepath.Join(sandbox, name)
+		(&types.DefaultFileWriter{Root: sandbox}).WriteToFile(path, messages("data"))
+		NewRotatingFileWriter(sandbox, Rotation{MaxBytes: 1}).WriteToFile(path, messages("data"))
+		NewRotatingFileWriter(sandbox, Rotation{MaxBytes: 1, Compress: true}).WriteToFile(path, messages("data"))
+
+		if names := listDir(t, outside); !slices.Equal(names, []string{"files"}) {
+			t.Fatalf("запись по пути %q вышла за пределы каталога: %v", name, names)
+		}
+	})
+}
+
+func TestTailFollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file1.txt")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lines := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- Tail(ctx, dir, path, false, func(line string) error {
+			lines <- line
+			return nil
+		})
+	}()
+
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-ctx.Done():
+			t.Fatal("не дождались строки")
+			return ""
+		}
+	}
+
+	// дописанное до ротации дочитывается из старого файла, затем читается новый
+	time.Sleep(2 * tailPollInterval)
+	appendFile(t, path, "one\n")
+	if line := next(); line != "one" {
+		t.Fatalf("ожидалась строка one, получено %q", line)
+	}
+	appendFile(t, path, "two\n")
+	if err := os.Rename(path, filepath.Join(dir, "file1.2026-10-16.txt")); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "three\n")
+
+	for _, expected := range []string{"two", "three"} {
+		if line := next(); line != expected {
+			t.Errorf("ожидалась строка %q, получено %q", expected, line)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Tail завершился с ошибкой: %v", err)
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+const tailPollInterval = 200 * time.Millisecond
+
+// Tail передает в fn строки, дописываемые в файл, пока не будет отменен ctx
+// или fn не вернет ошибку. Если fromStart, сначала передается уже записанное.
+// Файл открывается относительно root (см. types.OpenRoot); ротация файла
+// отслеживается, после нее чтение продолжается с начала нового файла.
+func Tail(ctx context.Context, root, filePath string, fromStart bool, fn func(line string) error) error {
+	r, name, err := types.OpenRoot(root, filePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var (
+		file    *os.File
+		reader  *bufio.Reader
+		partial strings.Builder
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if file == nil {
+			file, err = r.Open(name)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			if file != nil {
+				if !fromStart {
+					if _, err := file.Seek(0, io.SeekEnd); err != nil {
+						return err
+					}
+				}
+				reader = bufio.NewReader(file)
+				// файлы, появившиеся после начала чтения, читаются целиком
+				fromStart = true
+			}
+		}
+
+		// ротация проверяется до чтения, чтобы дочитать старый файл до конца
+		isRotated := file != nil && rotated(r, name, file)
+
+		for file != nil {
+			chunk, err := reader.ReadString('\n')
+			partial.WriteString(chunk)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			line := strings.TrimSuffix(partial.String(), "\n")
+			partial.Reset()
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+
+		if isRotated {
+			file.Close()
+			file = nil
+			partial.Reset()
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// rotated сообщает, что под именем name теперь другой файл или файла нет.
+func rotated(r *os.Root, name string, file *os.File) bool {
+	current, err := r.Stat(name)
+	if err != nil {
+		return true
+	}
+	opened, err := file.Stat()
+	return err != nil || !os.SameFile(current, opened)
+}
@@ -0,0 +1,252 @@
+package syslog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	FormatRFC5424 = "rfc5424"
+	FormatRFC3164 = "rfc3164"
+
+	nilValue = "-"
+)
+
+var (
+	ErrNoPriority = errors.New("сообщение не начинается с <PRI>")
+	ErrMalformed  = errors.New("некорректное сообщение syslog")
+)
+
+// Message - разобранное сообщение syslog. Незаданные поля пусты.
+type Message struct {
+	Format    string
+	Facility  int
+	Severity  int
+	Timestamp time.Time
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+	// StructuredData - параметры по элементам: SD-ID -> имя -> значение
+	StructuredData map[string]map[string]string
+	Text           string
+}
+
+// lineBreaks экранирует переводы строк: сообщение с длиной может их содержать,
+// а в файле каждое сообщение занимает одну строку.
+var lineBreaks = strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\r`)
+
+// Line возвращает строку для записи в файл: время, хост, приложение и текст.
+func (m Message) Line() string {
+	var b strings.Builder
+	if !m.Timestamp.IsZero() {
+		b.WriteString(m.Timestamp.Format(time.RFC3339))
+		b.WriteByte(' ')
+	}
+	if m.Hostname != "" {
+		b.WriteString(m.Hostname)
+		b.WriteByte(' ')
+	}
+	if m.AppName != "" {
+		b.WriteString(m.AppName)
+		if m.ProcID != "" {
+			b.WriteString("[" + m.ProcID + "]")
+		}
+		b.WriteString(": ")
+	}
+	b.WriteString(lineBreaks.Replace(m.Text))
+	return b.String()
+}
+
+// Parse разбирает сообщение в формате RFC 5424 или, если после <PRI> нет
+// версии протокола, RFC 3164. now нужен для RFC 3164, где у времени нет года.
+func Parse(data []byte, now time.Time) (Message, error) {
+	data = bytes.TrimRight(data, "\r\n\x00")
+	if !utf8.Valid(data) {
+		data = bytes.ToValidUTF8(data, []byte("\uFFFD"))
+	}
+	s := string(data)
+
+	pri, rest, err := parsePriority(s)
+	if err != nil {
+		return Message{}, err
+	}
+	msg := Message{Facility: pri / 8, Severity: pri % 8}
+
+	if version, after, ok := strings.Cut(rest, " "); ok && version == "1" {
+		msg.Format = FormatRFC5424
+		return parse5424(msg, after)
+	}
+	msg.Format = FormatRFC3164
+	return parse3164(msg, rest, now), nil
+}
+
+func parsePriority(s string) (int, string, error) {
+	end := strings.IndexByte(s, '>')
+	if !strings.HasPrefix(s, "<") || end < 2 || end > 4 {
+		return 0, "", ErrNoPriority
+	}
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri > 191 {
+		return 0, "", ErrNoPriority
+	}
+	return pri, s[end+1:], nil
+}
+
+// parse5424 разбирает часть после "<PRI>1 ":
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parse5424(msg Message, s string) (Message, error) {
+	fields := make([]string, 5)
+	for i := range fields {
+		field, rest, ok := strings.Cut(s, " ")
+		if !ok {
+			return Message{}, fmt.Errorf("%w: не хватает полей заголовка RFC 5424", ErrMalformed)
+		}
+		fields[i], s = field, rest
+	}
+
+	if fields[0] != nilValue {
+		ts, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return Message{}, fmt.Errorf("%w: время %q", ErrMalformed, fields[0])
+		}
+		msg.Timestamp = ts
+	}
+	msg.Hostname = value(fields[1])
+	msg.AppName = value(fields[2])
+	msg.ProcID = value(fields[3])
+	msg.MsgID = value(fields[4])
+
+	sd, rest, err := parseStructuredData(s)
+	if err != nil {
+		return Message{}, err
+	}
+	msg.StructuredData = sd
+	msg.Text = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff") // BOM перед текстом в UTF-8
+	return msg, nil
+}
+
+func value(field string) string {
+	if field == nilValue {
+		return ""
+	}
+	return field
+}
+
+// parseStructuredData разбирает "-" или последовательность элементов
+// [id name="value" ...]. В значениях экранируются \", \\ и \].
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	if rest, ok := strings.CutPrefix(s, nilValue); ok {
+		return nil, rest, nil
+	}
+
+	malformed := fmt.Errorf("%w: structured-data", ErrMalformed)
+	sd := make(map[string]map[string]string)
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return nil, "", malformed
+		}
+		params := make(map[string]string)
+		sd[s[:end]] = params
+		s = s[end:]
+
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			name, rest, ok := strings.Cut(s, `="`)
+			if !ok || name == "" {
+				return nil, "", malformed
+			}
+			var value strings.Builder
+			i := 0
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) && strings.IndexByte(`"\]`, rest[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			if i == len(rest) {
+				return nil, "", malformed
+			}
+			params[name] = value.String()
+			s = rest[i+1:]
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", malformed
+		}
+		s = s[1:]
+	}
+	if len(sd) == 0 {
+		return nil, "", malformed
+	}
+	return sd, s, nil
+}
+
+// parse3164 разбирает часть после <PRI> в формате BSD syslog:
+// "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG". Формат нестрогий, поэтому
+// все, что не удалось разобрать, остается в тексте сообщения.
+func parse3164(msg Message, s string, now time.Time) Message {
+	const stampLen = len(time.Stamp)
+	if len(s) > stampLen && s[stampLen] == ' ' {
+		if ts, err := time.ParseInLocation(time.Stamp, s[:stampLen], now.Location()); err == nil {
+			ts = ts.AddDate(now.Year(), 0, 0)
+			// сообщение конца прошлого года, полученное в начале нового
+			if ts.After(now.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			msg.Timestamp = ts
+			s = s[stampLen+1:]
+
+			if host, rest, ok := strings.Cut(s, " "); ok && host != "" && !isTag(host) {
+				msg.Hostname, s = host, rest
+			}
+		}
+	}
+
+	if end := tagEnd(s); end > 0 {
+		msg.AppName = s[:end]
+		rest := s[end:]
+		if strings.HasPrefix(rest, "[") {
+			if pid, after, ok := strings.Cut(rest[1:], "]"); ok {
+				msg.ProcID, rest = pid, after
+			}
+		}
+		if after, ok := strings.CutPrefix(rest, ":"); ok {
+			s = strings.TrimPrefix(after, " ")
+		} else {
+			msg.AppName, msg.ProcID = "", ""
+		}
+	}
+
+	msg.Text = s
+	return msg
+}
+
+// tagEnd возвращает длину TAG в начале s: до 32 символов из букв, цифр и
+// символов ._-/, за которыми следует '[' или ':'.
+func tagEnd(s string) int {
+	for i := 0; i < len(s) && i <= 32; i++ {
+		c := s[i]
+		switch {
+		case c == '[' || c == ':':
+			return i
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.IndexByte("._-/", c) >= 0:
+		default:
+			return 0
+		}
+	}
+	return 0
+}
+
+// isTag сообщает, что слово - это TAG приложения, а не имя хоста.
+func isTag(word string) bool {
+	end := tagEnd(word)
+	return end > 0 && (word[end] == ':' || strings.HasSuffix(word, ":"))
+}
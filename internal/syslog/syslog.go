@@ -0,0 +1,483 @@
+// Package syslog - прием сообщений syslog (RFC 5424 и RFC 3164) по UDP и TCP.
+// Источник определяется по IP-адресу отправителя и авторизуется токеном из
+// SyslogSources, файл выбирается правилами SyslogRules по app-name или
+// structured-data. В файлы, разрешенные источнику в SyslogSourceFiles,
+// сообщение отправляется с токеном пользователя файла из SyslogFileTokens,
+// в остальные - с токеном источника. По TCP поддерживаются оба способа
+// разделения сообщений из RFC 6587: с длиной перед сообщением и по переводу
+// строки.
+package syslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"path"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/fileid"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/metrics"
+)
+
+const defaultMaxMessageBytes = 64 << 10
+
+var syslogMessages = metrics.Default.NewCounterVec(
+	"app_syslog_messages_total", "Количество сообщений syslog по результату приема", "result")
+
+var ErrTooLong = errors.New("сообщение syslog длиннее допустимого")
+
+// source - токен для отправителей из подсети и файлы, в которые им можно
+// писать с токенами из SyslogFileTokens.
+type source struct {
+	prefix netip.Prefix
+	token  string
+	files  map[string]bool
+}
+
+type Server struct {
+	svc      *ingest.Service
+	cfg      *config.Config
+	sources  []source // от более узких подсетей к более широким
+	maxBytes int
+	now      func() time.Time
+
+	mutex      sync.Mutex
+	packetConn net.PacketConn
+	listeners  []net.Listener
+	conns      map[net.Conn]struct{}
+	closing    bool
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewServer проверяет источники и правила из конфигурации.
+func NewServer(svc *ingest.Service, cfg *config.Config) (*Server, error) {
+	s := &Server{
+		svc:      svc,
+		cfg:      cfg,
+		maxBytes: cfg.SyslogMaxMessageBytes,
+		now:      time.Now,
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+	}
+	if s.maxBytes <= 0 {
+		s.maxBytes = defaultMaxMessageBytes
+	}
+
+	for fileID, token := range cfg.SyslogFileTokens {
+		if err := fileid.Validate(fileID); err != nil {
+			return nil, fmt.Errorf("токен файла syslog %q: %w", fileID, err)
+		}
+		if token == "" {
+			return nil, fmt.Errorf("токен файла syslog %q не задан", fileID)
+		}
+	}
+	for addr := range cfg.SyslogSourceFiles {
+		if _, exists := cfg.SyslogSources[addr]; !exists {
+			return nil, fmt.Errorf("файлы источника syslog %q: источник не задан в SyslogSources", addr)
+		}
+	}
+
+	for addr, token := range cfg.SyslogSources {
+		prefix, err := parsePrefix(addr)
+		if err != nil {
+			return nil, fmt.Errorf("источник syslog %q: %w", addr, err)
+		}
+		src := source{prefix: prefix, token: token, files: make(map[string]bool)}
+		for _, fileID := range cfg.SyslogSourceFiles[addr] {
+			if _, exists := cfg.SyslogFileTokens[fileID]; !exists {
+				return nil, fmt.Errorf("файлы источника syslog %q: нет токена файла %q в SyslogFileTokens", addr, fileID)
+			}
+			src.files[fileID] = true
+		}
+		s.sources = append(s.sources, src)
+	}
+	sort.Slice(s.sources, func(i, j int) bool {
+		return s.sources[i].prefix.Bits() > s.sources[j].prefix.Bits()
+	})
+
+	for i, rule := range cfg.SyslogRules {
+		if err := validateRule(rule); err != nil {
+			return nil, fmt.Errorf("правило syslog %d: %w", i+1, err)
+		}
+	}
+	return s, nil
+}
+
+// Enabled сообщает, задан ли в конфигурации хотя бы один адрес.
+func Enabled(cfg *config.Config) bool {
+	return cfg.SyslogUDPAddr != "" || cfg.SyslogTCPAddr != ""
+}
+
+func parsePrefix(addr string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(addr); err == nil {
+		return prefix.Masked(), nil
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return netip.Prefix{}, errors.New("ожидается IP-адрес или подсеть")
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+func validateRule(rule config.SyslogRule) error {
+	if _, err := path.Match(rule.AppName, ""); err != nil {
+		return fmt.Errorf("шаблон app-name %q: %w", rule.AppName, err)
+	}
+	if rule.SDParam != "" && rule.SDID == "" {
+		return errors.New("для SDParam нужен SDID")
+	}
+	if rule.FileID == "" && rule.SDParam == "" {
+		return errors.New("нужен FileID или SDParam")
+	}
+	return nil
+}
+
+// source возвращает источник с адресом addr.
+func (s *Server) source(addr net.Addr) (source, bool) {
+	var ip netip.Addr
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.AddrPort().Addr()
+	case *net.TCPAddr:
+		ip = a.AddrPort().Addr()
+	default:
+		return source{}, false
+	}
+	ip = ip.Unmap()
+
+	for _, src := range s.sources {
+		if src.prefix.Contains(ip) {
+			return src, true
+		}
+	}
+	return source{}, false
+}
+
+// fileToken возвращает токен, с которым сообщение источника src отправляется
+// в файл fileID: токен пользователя файла, если файл разрешен источнику, иначе
+// токен самого источника.
+func (s *Server) fileToken(src source, fileID string) string {
+	if normalized, err := fileid.Normalize(fileID); err == nil && src.files[normalized] {
+		return s.cfg.SyslogFileTokens[normalized]
+	}
+	return src.token
+}
+
+// route возвращает fileID по первому подходящему правилу.
+func (s *Server) route(msg Message) (string, bool) {
+	for _, rule := range s.cfg.SyslogRules {
+		if matched, _ := path.Match(rule.AppName, msg.AppName); rule.AppName != "" && !matched {
+			continue
+		}
+
+		var params map[string]string
+		if rule.SDID != "" {
+			var exists bool
+			if params, exists = msg.StructuredData[rule.SDID]; !exists {
+				continue
+			}
+		}
+
+		fileID := rule.FileID
+		if rule.SDParam != "" {
+			value, exists := params[rule.SDParam]
+			if !exists {
+				continue
+			}
+			if fileID == "" {
+				fileID = value
+			}
+		}
+		return fileID, true
+	}
+	return "", false
+}
+
+func (s *Server) Name() string {
+	return "syslog"
+}
+
+// Serve открывает адреса из конфигурации и принимает сообщения до Shutdown.
+func (s *Server) Serve() error {
+	var (
+		serves []func() error
+		pc     net.PacketConn
+		err    error
+	)
+	if s.cfg.SyslogUDPAddr != "" {
+		if pc, err = net.ListenPacket("udp", s.cfg.SyslogUDPAddr); err != nil {
+			return err
+		}
+		serves = append(serves, func() error { return s.ServePacketConn(pc) })
+	}
+	if s.cfg.SyslogTCPAddr != "" {
+		lis, err := net.Listen("tcp", s.cfg.SyslogTCPAddr)
+		if err != nil {
+			if pc != nil {
+				pc.Close()
+			}
+			return err
+		}
+		serves = append(serves, func() error { return s.ServeListener(lis) })
+	}
+
+	errs := make(chan error, len(serves))
+	for _, serve := range serves {
+		go func() {
+			errs <- serve()
+		}()
+	}
+	for range serves {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServePacketConn принимает датаграммы syslog, по одному сообщению в каждой.
+func (s *Server) ServePacketConn(pc net.PacketConn) error {
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		pc.Close()
+		return nil
+	}
+	s.packetConn = pc
+	s.mutex.Unlock()
+
+	slog.Info("прием syslog по UDP запущен", "addr", pc.LocalAddr().String())
+	ctx := logger.WithRequestID(context.Background(), logger.NewID())
+	buf := make([]byte, s.maxBytes)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if s.stopping() {
+				return nil
+			}
+			return err
+		}
+		// по UDP повторить нельзя, поэтому сообщения сверх лимита отбрасываются
+		s.handle(ctx, addr, buf[:n], false)
+	}
+}
+
+// ServeListener принимает соединения syslog по TCP.
+func (s *Server) ServeListener(lis net.Listener) error {
+	s.mutex.Lock()
+	if s.closing {
+		s.mutex.Unlock()
+		lis.Close()
+		return nil
+	}
+	s.listeners = append(s.listeners, lis)
+	s.mutex.Unlock()
+
+	slog.Info("прием syslog по TCP запущен", "addr", lis.Addr().String())
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if s.stopping() {
+				return nil
+			}
+			return err
+		}
+		if !s.track(conn) {
+			conn.Close()
+			continue
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	ctx := logger.WithRequestID(context.Background(), logger.NewID())
+	log := logger.FromContext(ctx).With("remote", conn.RemoteAddr().String())
+	log.Debug("соединение syslog установлено")
+
+	r := bufio.NewReaderSize(conn, s.maxBytes)
+	for {
+		frame, err := readFrame(r, s.maxBytes)
+		// перевод строки после сообщения с длиной - не отдельное сообщение
+		if len(bytes.TrimSpace(frame)) > 0 {
+			s.handle(ctx, conn.RemoteAddr(), frame, true)
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !s.stopping() {
+				log.Warn("ошибка чтения соединения syslog", logger.KeyError, err)
+			}
+			return
+		}
+	}
+}
+
+// readFrame читает одно сообщение: "<длина> <сообщение>" (octet counting)
+// или строку до перевода строки (non-transparent framing).
+func readFrame(r *bufio.Reader, maxBytes int) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		prefix, err := r.ReadSlice(' ')
+		if err != nil {
+			return nil, fmt.Errorf("длина сообщения syslog: %w", err)
+		}
+		n, err := strconv.Atoi(string(prefix[:len(prefix)-1]))
+		if err != nil {
+			return nil, fmt.Errorf("длина сообщения syslog: %w", err)
+		}
+		if n > maxBytes {
+			return nil, ErrTooLong
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return nil, ErrTooLong
+	}
+	return bytes.Clone(line), err
+}
+
+// handle передает разобранное сообщение в файл, выбранный правилами. Если
+// wait, при превышении лимита скорости чтение приостанавливается.
+func (s *Server) handle(ctx context.Context, addr net.Addr, data []byte, wait bool) {
+	log := logger.FromContext(ctx).With("remote", addr.String())
+
+	src, exists := s.source(addr)
+	if !exists {
+		// по UDP это может быть кто угодно, поэтому такие сообщения не засоряют журнал
+		log.Debug("сообщение syslog от неизвестного источника")
+		syslogMessages.Inc("unknown_source")
+		return
+	}
+
+	msg, err := Parse(data, s.now())
+	if err != nil {
+		log.Warn("не удалось разобрать сообщение syslog", logger.KeyError, err)
+		syslogMessages.Inc("parse_error")
+		return
+	}
+
+	fileID, exists := s.route(msg)
+	if !exists {
+		log.Warn("нет правила для сообщения syslog", "app_name", msg.AppName)
+		syslogMessages.Inc("no_rule")
+		return
+	}
+	token := s.fileToken(src, fileID)
+
+	for {
+		_, err = s.svc.SendMessage(ctx, token, fileID, msg.Line())
+		var rateErr *handler.RateLimitError
+		if !wait || !errors.As(err, &rateErr) {
+			break
+		}
+		select {
+		case <-time.After(rateErr.RetryAfter):
+		case <-s.done:
+			syslogMessages.Inc(ingest.CodeUnavailable.String())
+			return
+		}
+	}
+	if err != nil {
+		log.Warn("сообщение syslog не принято", logger.KeyFileID, fileID, logger.KeyError, err)
+		syslogMessages.Inc(ingest.CodeOf(err).String())
+		return
+	}
+	syslogMessages.Inc("accepted")
+}
+
+// Shutdown перестает принимать сообщения и ждет, пока будут переданы
+// уже прочитанные из TCP-соединений.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	if !s.closing {
+		s.closing = true
+		close(s.done)
+	}
+	for _, lis := range s.listeners {
+		lis.Close()
+	}
+	for conn := range s.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	s.mutex.Unlock()
+	s.closePacketConn()
+
+	waited := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+func (s *Server) closePacketConn() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.packetConn != nil {
+		s.packetConn.Close()
+	}
+}
+
+func (s *Server) stopping() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) track(conn net.Conn) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	return true
+}
+
+func (s *Server) untrack(conn net.Conn) {
+	s.mutex.Lock()
+	delete(s.conns, conn)
+	s.mutex.Unlock()
+	s.wg.Done()
+}
@@ -0,0 +1,272 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		data     string
+		expected Message
+		err      error
+	}{
+		{
+			name: "RFC 5424 со structured-data",
+			data: `<165>1 2026-10-11T22:14:15.003Z mymachine.example.com evntslog 42 ID47 [exampleSDID@32473 iut="3" eventSource="Application" file="app\"1\]"][meta x="y"] ` + "\ufeff" + "An application event\n",
+			expected: Message{
+				Format: FormatRFC5424, Facility: 20, Severity: 5,
+				Timestamp: time.Date(2026, 10, 11, 22, 14, 15, 3e6, time.UTC),
+				Hostname:  "mymachine.example.com", AppName: "evntslog", ProcID: "42", MsgID: "ID47",
+				StructuredData: map[string]map[string]string{
+					"exampleSDID@32473": {"iut": "3", "eventSource": "Application", "file": `app"1]`},
+					"meta":              {"x": "y"},
+				},
+				Text: "An application event",
+			},
+		},
+		{
+			name: "RFC 5424 с пустыми полями",
+			data: "<34>1 - - - - - -",
+			expected: Message{
+				Format: FormatRFC5424, Facility: 4, Severity: 2,
+			},
+		},
+		{
+			name: "RFC 3164",
+			data: "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed",
+			expected: Message{
+				Format: FormatRFC3164, Facility: 4, Severity: 2,
+				Timestamp: time.Date(2025, 10, 11, 22, 14, 15, 0, time.UTC),
+				Hostname:  "mymachine", AppName: "su", ProcID: "123",
+				Text: "'su root' failed",
+			},
+		},
+		{
+			name: "RFC 3164 без хоста",
+			data: "<13>Jan  2 09:00:00 cron: job started",
+			expected: Message{
+				Format: FormatRFC3164, Facility: 1, Severity: 5,
+				Timestamp: time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC),
+				AppName:   "cron", Text: "job started",
+			},
+		},
+		{
+			name: "RFC 3164 без времени и тега",
+			data: "<13>just some text",
+			expected: Message{
+				Format: FormatRFC3164, Facility: 1, Severity: 5,
+				Text: "just some text",
+			},
+		},
+		{name: "без PRI", data: "hello", err: ErrNoPriority},
+		{name: "PRI вне диапазона", data: "<192>1 - - - - - -", err: ErrNoPriority},
+		{name: "неполный заголовок RFC 5424", data: "<34>1 - host app", err: ErrMalformed},
+		{name: "незакрытый элемент structured-data", data: `<34>1 - - - - - [id a="b" text`, err: ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Parse([]byte(tt.data), now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ожидалась ошибка %v, получено %v", tt.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(msg, tt.expected) {
+				t.Errorf("ожидалось %+v, получено %+v", tt.expected, msg)
+			}
+		})
+	}
+}
+
+func TestRoute(t *testing.T) {
+	cfg := &config.Config{SyslogRules: []config.SyslogRule{
+		{SDID: "ingest@32473", SDParam: "file"},
+		{AppName: "nginx*", FileID: "web"},
+		{AppName: "postgres", SDID: "db", FileID: "db"},
+	}}
+	s, err := NewServer(nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		msg    Message
+		fileID string
+	}{
+		{"fileID из structured-data", Message{AppName: "nginx", StructuredData: map[string]map[string]string{"ingest@32473": {"file": "custom"}}}, "custom"},
+		{"шаблон app-name", Message{AppName: "nginx-proxy"}, "web"},
+		{"app-name и элемент", Message{AppName: "postgres", StructuredData: map[string]map[string]string{"db": {}}}, "db"},
+		{"нет элемента", Message{AppName: "postgres"}, ""},
+		{"нет правила", Message{AppName: "sshd"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if fileID, _ := s.route(tt.msg); fileID != tt.fileID {
+				t.Errorf("ожидался fileID %q, получено %q", tt.fileID, fileID)
+			}
+		})
+	}
+}
+
+func TestNewServerRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{"некорректный источник", config.Config{SyslogSources: map[string]string{"localhost": "t"}}},
+		{"некорректный шаблон", config.Config{SyslogRules: []config.SyslogRule{{AppName: "[", FileID: "f"}}}},
+		{"SDParam без SDID", config.Config{SyslogRules: []config.SyslogRule{{SDParam: "file"}}}},
+		{"правило без файла", config.Config{SyslogRules: []config.SyslogRule{{AppName: "app"}}}},
+		{"некорректный файл токена", config.Config{SyslogFileTokens: map[string]string{"../etc": "t"}}},
+		{"пустой токен файла", config.Config{SyslogFileTokens: map[string]string{"file1": ""}}},
+		{"файлы неизвестного источника", config.Config{SyslogSourceFiles: map[string][]string{"10.0.0.1": {"file1"}}}},
+		{"файл источника без токена", config.Config{
+			SyslogSources:     map[string]string{"10.0.0.1": "t"},
+			SyslogSourceFiles: map[string][]string{"10.0.0.1": {"file1"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewServer(nil, &tt.cfg); err == nil {
+				t.Error("ожидалась ошибка конфигурации")
+			}
+		})
+	}
+}
+
+// setup запускает приложение с пользователями valid_token_1 (файл file1) и
+// valid_token_2 (файл file2) и возвращает сервер, который еще не принимает сообщения.
+func setup(t *testing.T, cfg *config.Config) *Server {
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := app.NewApp(cfg, &types.DefaultFileWriter{}, userRepo)
+	msgHandler := handler.NewMessageHandler(userRepo, application, cfg)
+	svc := ingest.NewService(application, msgHandler, userRepo)
+	for i, token := range cfg.ValidTokens {
+		user := ingest.NewUser{Token: token, FileID: fmt.Sprintf("file%d", i+1)}
+		if _, err := svc.AddUser(context.Background(), user); err != nil {
+			t.Fatalf("не удалось добавить пользователя: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		application.Start(ctx)
+		close(done)
+	}()
+
+	server, err := NewServer(svc, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Shutdown(context.Background())
+		cancel()
+		<-done
+	})
+	return server
+}
+
+func waitFile(t *testing.T, path string, expected []string) {
+	want := strings.Join(expected, "\n") + "\n"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if string(data) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ожидалось содержимое файла %q, получено %q", want, data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	cfg := &config.Config{
+		ValidTokens:    []string{"valid_token_1", "valid_token_2", "valid_token_3"},
+		WorkerInterval: 100 * time.Millisecond,
+		FilesDir:       t.TempDir(),
+		NumWorkers:     1,
+		MaxRetries:     3,
+		RetryInterval:  100 * time.Millisecond,
+		// токен источника с адреса 127.0.0.1 принадлежит пользователю file1,
+		// в file2 ему разрешено писать с токеном из SyslogFileTokens, в file3 - нет
+		SyslogSources: map[string]string{"127.0.0.0/8": "valid_token_2", "127.0.0.1": "valid_token_1"},
+		SyslogRules: []config.SyslogRule{
+			{AppName: "app", FileID: "file1"},
+			{AppName: "other", FileID: "file2"},
+			{SDID: "ingest", SDParam: "file"},
+		},
+		SyslogSourceFiles: map[string][]string{"127.0.0.1": {"file2"}},
+		SyslogFileTokens:  map[string]string{"file2": "valid_token_2", "file3": "valid_token_3"},
+	}
+	server := setup(t, cfg)
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServePacketConn(pc)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.ServeListener(lis)
+
+	udp, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	fmt.Fprint(udp, "<14>1 2026-10-18T10:00:00Z host app 1 - - over udp")
+	fmt.Fprint(udp, "<14>1 2026-10-18T10:00:00Z host other 1 - - routed")
+	fmt.Fprint(udp, `<14>1 - - sd - - [ingest file="file2"] from structured-data`)
+	// у file3 есть токен файла, но источнику этот файл не разрешен
+	fmt.Fprint(udp, `<14>1 - - sd - - [ingest file="file3"] rejected`)
+	waitFile(t, filepath.Join(cfg.FilesDir, "file1.txt"), []string{"2026-10-18T10:00:00Z host app[1]: over udp"})
+	waitFile(t, filepath.Join(cfg.FilesDir, "file2.txt"), []string{
+		"2026-10-18T10:00:00Z host other[1]: routed",
+		"sd: from structured-data",
+	})
+
+	tcp, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	w := bufio.NewWriter(tcp)
+	octet := "<14>1 - - app - - - octet\ncounted"
+	fmt.Fprintf(w, "%d %s\n", len(octet), octet)
+	fmt.Fprint(w, "<14>Oct 18 10:00:00 host app: line framed\n")
+	w.Flush()
+
+	waitFile(t, filepath.Join(cfg.FilesDir, "file1.txt"), []string{
+		"2026-10-18T10:00:00Z host app[1]: over udp",
+		`app: octet\ncounted`,
+		"2026-10-18T10:00:00Z host app: line framed",
+	})
+	if _, err := os.Stat(filepath.Join(cfg.FilesDir, "file3.txt")); !os.IsNotExist(err) {
+		t.Errorf("сообщение для чужого файла не должно было быть записано: %v", err)
+	}
+}
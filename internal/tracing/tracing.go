@@ -0,0 +1,182 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+const (
+	tracerName  = "github.com/asb1302/innopolis_go_assesment_1"
+	serviceName = "innopolis_go_assesment_1"
+
+	// ограничение на количество ссылок с батча записи на спаны сообщений
+	maxBatchLinks = 128
+)
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Setup настраивает глобальный провайдер трассировки по конфигу и возвращает
+// функцию, которая выгружает оставшиеся спаны при остановке приложения.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+	switch cfg.TracingExporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exp, err := otlptracehttp.New(ctx,
+			otlptracehttp.WithEndpoint(cfg.OTLPEndpoint),
+			otlptracehttp.WithInsecure(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось создать OTLP экспортер: %w", err)
+		}
+		exporter = exp
+	case "file":
+		f, err := os.OpenFile(cfg.TracingFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось открыть файл трассировки: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("не удалось создать файловый экспортер: %w", err)
+		}
+		exporter = exp
+		closeFile = f.Close
+	default:
+		return nil, fmt.Errorf("неизвестный экспортер трассировки %q", cfg.TracingExporter)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closeFile != nil {
+			if closeErr := closeFile(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Inject сохраняет контекст трассировки ctx в сообщении.
+func Inject(ctx context.Context, msg *types.Message) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		msg.Trace = carrier
+	}
+}
+
+// Extract восстанавливает контекст трассировки из сообщения.
+func Extract(msg types.Message) context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(msg.Trace))
+}
+
+// StartMessageSpan начинает спан этапа обработки сообщения как дочерний к предыдущему
+// этапу и сохраняет его контекст в сообщении, чтобы следующий этап продолжил цепочку.
+func StartMessageSpan(msg *types.Message, name string) trace.Span {
+	ctx, span := tracer().Start(Extract(*msg), name, trace.WithAttributes(
+		attribute.String("file_id", msg.FileID),
+		attribute.String("msg_id", msg.ID),
+	))
+	Inject(ctx, msg)
+	return span
+}
+
+// StartBatchSpan начинает спан записи батча со ссылками на спаны его сообщений.
+func StartBatchSpan(ctx context.Context, fileID string, messages []types.Message) (context.Context, trace.Span) {
+	var links []trace.Link
+	for _, msg := range messages {
+		if len(links) == maxBatchLinks {
+			break
+		}
+		if sc := trace.SpanContextFromContext(Extract(msg)); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+
+	return tracer().Start(ctx, "app.write_file",
+		trace.WithLinks(links...),
+		trace.WithAttributes(
+			attribute.String("file_id", fileID),
+			attribute.Int("messages", len(messages)),
+		),
+	)
+}
+
+// Start начинает дочерний спан, например для отдельной попытки записи.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Fail отмечает спан как завершившийся ошибкой.
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap нужен, чтобы через middleware проходил Hijack соединений WebSocket.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// HTTPMiddleware начинает серверный спан на каждый запрос, продолжая
+// трассировку из заголовка traceparent, если клиент его передал.
+func HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer().Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+// Проверяет, что файловый экспортер записывает цепочку спанов одного сообщения.
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), &config.Config{TracingExporter: "file", TracingFile: path})
+	if err != nil {
+		t.Fatalf("не удалось настроить трассировку: %v", err)
+	}
+
+	msg := types.Message{ID: "m1", FileID: "file1"}
+	first := StartMessageSpan(&msg, "stage.first")
+	first.End()
+	traceparent := msg.Trace["traceparent"]
+	second := StartMessageSpan(&msg, "stage.second")
+	second.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("не удалось выгрузить трассировку: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("не удалось прочитать файл трассировки: %v", err)
+	}
+	out := string(data)
+	for _, name := range []string{"stage.first", "stage.second"} {
+		if !strings.Contains(out, name) {
+			t.Errorf("Ожидался спан %s в файле трассировки", name)
+		}
+	}
+
+	// второй этап должен продолжать трассировку первого
+	traceID := strings.Split(traceparent, "-")[1]
+	if strings.Count(out, traceID) < 2 {
+		t.Errorf("Ожидалось, что оба спана относятся к трассировке %s", traceID)
+	}
+}
+
+func TestUnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), &config.Config{TracingExporter: "zipkin"}); err == nil {
+		t.Fatalf("ожидалась ошибка для неизвестного экспортера")
+	}
+}
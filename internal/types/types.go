@@ -1,35 +1,94 @@
 package types
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
 )
 
 type Message struct {
+	ID     string
 	Token  string
 	FileID string
 	Data   string
+	// версия схемы, по которой проверены данные (пусто - у файла нет схемы)
+	SchemaVersion string
+	// контекст трассировки (W3C traceparent), переносимый между этапами обработки
+	Trace map[string]string
+}
+
+// LogValue выводит сообщение структурированно, токен и данные скрываются логгером.
+func (m Message) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String(logger.KeyMsgID, m.ID),
+		slog.String(logger.KeyFileID, m.FileID),
+		slog.String(logger.KeyToken, m.Token),
+		slog.String(logger.KeyData, m.Data),
+	)
 }
 
 type User struct {
 	Token  string
 	FileID string
+	Tenant string // пустой - файл в корне каталога файлов
+}
+
+// FileKey возвращает идентификатор файла внутри приложения: fileID тенанта
+// уникален только в пределах тенанта и хранится в его подкаталоге.
+func FileKey(tenant, fileID string) string {
+	if tenant == "" {
+		return fileID
+	}
+	return tenant + "/" + fileID
+}
+
+// SplitFileKey разбирает идентификатор, полученный из FileKey.
+func SplitFileKey(key string) (tenant, fileID string) {
+	if i := strings.IndexByte(key, '/'); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
 }
 
 type AppInterface interface {
 	AddUser(User) error
-	SendMsg(Message)
+	SendMsg(Message) error
 }
 
 type FileWriter interface {
 	WriteToFile(filePath string, messages []Message) error
 }
 
-type DefaultFileWriter struct{}
+var ErrOutsideRoot = errors.New("путь к файлу выходит за пределы каталога файлов")
+
+// DefaultFileWriter дописывает сообщения в конец файла. Файл открывается
+// относительно Root (или каталога самого файла, если Root не задан) через
+// os.Root, поэтому запись не выходит за пределы каталога даже по символическим ссылкам.
+type DefaultFileWriter struct {
+	Root string
+}
 
 func (w *DefaultFileWriter) WriteToFile(filePath string, messages []Message) error {
-	log.Printf("запись в файл: %s", filePath)
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	slog.Debug("запись в файл", "path", filePath, "messages", len(messages))
+	root, name, err := OpenRoot(w.Root, filePath)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	// файлы тенантов лежат в подкаталогах
+	if dir := filepath.Dir(name); dir != "." {
+		if err := root.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	file, err := root.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
 	}
@@ -43,3 +102,25 @@ func (w *DefaultFileWriter) WriteToFile(filePath string, messages []Message) err
 
 	return nil
 }
+
+// OpenRoot открывает каталог rootDir и возвращает путь к файлу относительно него.
+// Если rootDir пустой, используется каталог самого файла, он создается при необходимости.
+func OpenRoot(rootDir, filePath string) (*os.Root, string, error) {
+	if rootDir == "" {
+		rootDir = filepath.Dir(filePath)
+		if err := os.MkdirAll(rootDir, 0755); err != nil {
+			return nil, "", err
+		}
+	}
+
+	name, err := filepath.Rel(rootDir, filePath)
+	if err != nil || !filepath.IsLocal(name) {
+		return nil, "", fmt.Errorf("%w: %s", ErrOutsideRoot, filePath)
+	}
+
+	root, err := os.OpenRoot(rootDir)
+	if err != nil {
+		return nil, "", err
+	}
+	return root, name, nil
+}
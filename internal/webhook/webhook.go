@@ -0,0 +1,457 @@
+// Package webhook отправляет получателям подписанные HTTP-уведомления о
+// событиях записи файлов. Доставка асинхронная: события ставятся в очередь,
+// неудачные попытки повторяются через отдельную очередь повторов с растущим
+// интервалом, результаты попыток сохраняются в журнале доставки.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/events"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/metrics"
+)
+
+// Типы событий.
+const (
+	EventFileFlushed       = "file.flushed"
+	EventBatchDeadLettered = "batch.dead_lettered"
+	EventCircuitOpened     = "circuit.opened"
+)
+
+// Заголовки запроса с уведомлением.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-ID"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	workers          = 2
+	maxRetryInterval = 5 * time.Minute
+	retryTick        = 50 * time.Millisecond
+)
+
+var (
+	deliveries = metrics.Default.NewCounterVec(
+		"app_webhook_deliveries_total", "Количество попыток доставки webhook", "result")
+	webhookPending = metrics.Default.NewGaugeVec(
+		"app_webhook_pending", "Количество недоставленных уведомлений, включая ожидающие повтора")
+)
+
+// Range - записанный диапазон файла: номера сообщений (с 1, включительно,
+// сохраняются между перезапусками в StateDir) и смещения в байтах в текущем
+// файле <fileID>.txt (конец не включается).
+type Range struct {
+	FirstSeq  int64 `json:"first_seq"`
+	LastSeq   int64 `json:"last_seq"`
+	ByteStart int64 `json:"byte_start"`
+	ByteEnd   int64 `json:"byte_end"`
+}
+
+// Event - тело уведомления.
+type Event struct {
+	ID       string    `json:"id"`
+	Type     string    `json:"type"`
+	Time     time.Time `json:"time"`
+	FileID   string    `json:"file_id"`
+	Messages int       `json:"messages,omitempty"`
+	Range    Range     `json:"range,omitzero"`
+	Error    string    `json:"error,omitempty"`
+	Failures int       `json:"failures,omitempty"` // неудавшиеся батчи подряд для circuit.opened
+	Until    time.Time `json:"until,omitzero"`     // до какого момента запись приостановлена
+}
+
+// Delivery - запись журнала доставки об одной попытке.
+type Delivery struct {
+	EventID  string        `json:"event_id"`
+	Type     string        `json:"type"`
+	URL      string        `json:"url"`
+	Attempt  int           `json:"attempt"`
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration_ns"`
+	Status   int           `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Result   string        `json:"result"` // delivered, retry, failed
+}
+
+// Sign возвращает подпись тела уведомления: HMAC-SHA256 ключом secret от
+// "<timestamp>.<body>" в виде "sha256=<hex>".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись уведомления на стороне получателя.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+type endpoint struct {
+	config.WebhookConfig
+}
+
+func (e endpoint) wants(event Event) bool {
+	if len(e.Events) > 0 && !slices.Contains(e.Events, event.Type) {
+		return false
+	}
+	if e.FileID != "" {
+		if ok, _ := path.Match(e.FileID, event.FileID); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type delivery struct {
+	endpoint *endpoint
+	event    Event
+	body     []byte
+	attempt  int
+	next     time.Time
+}
+
+// Dispatcher доставляет события получателям. nil Dispatcher события игнорирует.
+type Dispatcher struct {
+	cfg       *config.Config
+	endpoints []*endpoint
+	client    *http.Client
+
+	queue    chan *delivery
+	mutex    sync.Mutex
+	retries  []*delivery
+	pending  int
+	log      []Delivery
+	logNext  int
+	stopping bool
+
+	unsubscribe []func()
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher проверяет получателей из конфигурации. Без получателей
+// возвращает nil.
+func NewDispatcher(cfg *config.Config) (*Dispatcher, error) {
+	if len(cfg.Webhooks) == 0 {
+		return nil, nil
+	}
+
+	d := &Dispatcher{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.WebhookTimeout},
+		queue:  make(chan *delivery, max(cfg.WebhookQueueSize, 1)),
+	}
+	for i, wc := range cfg.Webhooks {
+		if wc.URL == "" {
+			return nil, fmt.Errorf("webhook %d: нужен URL", i+1)
+		}
+		if _, err := path.Match(wc.FileID, ""); err != nil {
+			return nil, fmt.Errorf("webhook %d: шаблон fileID: %w", i+1, err)
+		}
+		for _, typ := range wc.Events {
+			if typ != EventFileFlushed && typ != EventBatchDeadLettered && typ != EventCircuitOpened {
+				return nil, fmt.Errorf("webhook %d: неизвестное событие %q", i+1, typ)
+			}
+		}
+		d.endpoints = append(d.endpoints, &endpoint{wc})
+	}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	return d, nil
+}
+
+// Start запускает доставку.
+func (d *Dispatcher) Start() {
+	if d == nil {
+		return
+	}
+	for i := 0; i < workers; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+	d.wg.Add(1)
+	go d.scheduleRetries()
+}
+
+// Subscribe подписывает получателей на события записи файлов из bus.
+// Подписка снимается при Shutdown.
+func (d *Dispatcher) Subscribe(bus *events.Bus) {
+	if d == nil {
+		return
+	}
+	d.unsubscribe = append(d.unsubscribe,
+		events.Subscribe(bus, func(e events.BatchFlushed) {
+			d.Notify(Event{
+				Type:     EventFileFlushed,
+				FileID:   e.FileID,
+				Messages: e.Messages,
+				Range:    Range{FirstSeq: e.FirstSeq, LastSeq: e.LastSeq, ByteStart: e.ByteStart, ByteEnd: e.ByteEnd},
+			})
+		}),
+		events.Subscribe(bus, func(e events.BatchDeadLettered) {
+			d.Notify(Event{Type: EventBatchDeadLettered, FileID: e.FileID, Messages: e.Messages, Error: e.Err.Error()})
+		}),
+		events.Subscribe(bus, func(e events.CircuitOpened) {
+			d.Notify(Event{Type: EventCircuitOpened, FileID: e.FileID, Error: e.Err.Error(), Failures: e.Failures, Until: e.Until})
+		}),
+	)
+}
+
+// Shutdown прекращает прием событий и ждет доставки оставшихся, в том числе
+// ожидающих повтора, пока не истечет ctx. Недоставленные к этому моменту
+// уведомления теряются.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	for _, unsubscribe := range d.unsubscribe {
+		unsubscribe()
+	}
+	d.mutex.Lock()
+	d.stopping = true
+	d.mutex.Unlock()
+
+	ticker := time.NewTicker(retryTick)
+	defer ticker.Stop()
+	var err error
+wait:
+	for {
+		d.mutex.Lock()
+		pending := d.pending
+		d.mutex.Unlock()
+		if pending == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			slog.Warn("остановка без доставки части webhook", "pending", pending)
+			err = ctx.Err()
+			break wait
+		case <-ticker.C:
+		}
+	}
+
+	d.cancel()
+	d.wg.Wait()
+	return err
+}
+
+// Notify ставит событие в очередь доставки всем получателям, которые на него
+// подписаны. Если очередь заполнена, уведомление отбрасывается, чтобы не
+// задерживать запись файлов.
+func (d *Dispatcher) Notify(event Event) {
+	if d == nil {
+		return
+	}
+	if event.ID == "" {
+		event.ID = logger.NewID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("не удалось сформировать webhook", "event", event.Type, logger.KeyError, err)
+		return
+	}
+
+	for _, e := range d.endpoints {
+		if !e.wants(event) {
+			continue
+		}
+		dl := &delivery{endpoint: e, event: event, body: body}
+
+		d.mutex.Lock()
+		if d.stopping {
+			d.mutex.Unlock()
+			return
+		}
+		select {
+		case d.queue <- dl:
+			d.pending++
+			webhookPending.Set(float64(d.pending))
+		default:
+			deliveries.Inc("dropped")
+			slog.Warn("очередь webhook заполнена, уведомление отброшено", "event", event.Type, "url", e.URL, logger.KeyFileID, event.FileID)
+		}
+		d.mutex.Unlock()
+	}
+}
+
+// Deliveries возвращает журнал доставки, от старых попыток к новым.
+func (d *Dispatcher) Deliveries() []Delivery {
+	if d == nil {
+		return []Delivery{}
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	result := make([]Delivery, 0, len(d.log))
+	if len(d.log) == d.cfg.WebhookLogSize {
+		result = append(result, d.log[d.logNext:]...)
+		return append(result, d.log[:d.logNext]...)
+	}
+	return append(result, d.log...)
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for {
+		select {
+		case dl := <-d.queue:
+			d.attempt(dl)
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// scheduleRetries возвращает в очередь доставки уведомления, у которых
+// наступило время повтора.
+func (d *Dispatcher) scheduleRetries() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(retryTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			d.mutex.Lock()
+			waiting := d.retries[:0]
+			for _, dl := range d.retries {
+				if dl.next.After(now) {
+					waiting = append(waiting, dl)
+					continue
+				}
+				select {
+				case d.queue <- dl:
+				default:
+					waiting = append(waiting, dl)
+				}
+			}
+			clear(d.retries[len(waiting):])
+			d.retries = waiting
+			d.mutex.Unlock()
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) attempt(dl *delivery) {
+	dl.attempt++
+	start := time.Now()
+	status, err := d.send(dl)
+	entry := Delivery{
+		EventID:  dl.event.ID,
+		Type:     dl.event.Type,
+		URL:      dl.endpoint.URL,
+		Attempt:  dl.attempt,
+		Time:     start,
+		Duration: time.Since(start),
+		Status:   status,
+	}
+	log := slog.With("event", dl.event.Type, "event_id", dl.event.ID, "url", dl.endpoint.URL, logger.KeyAttempt, dl.attempt)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	switch {
+	case err == nil:
+		entry.Result = "delivered"
+		d.done()
+		log.Debug("webhook доставлен", "status", status)
+	case retryable(status) && dl.attempt < d.cfg.WebhookMaxAttempts:
+		entry.Result, entry.Error = "retry", err.Error()
+		dl.next = time.Now().Add(d.backoff(dl.attempt))
+		d.retries = append(d.retries, dl)
+		log.Warn("webhook не доставлен, повтор", "retry_at", dl.next, logger.KeyError, err)
+	default:
+		entry.Result, entry.Error = "failed", err.Error()
+		d.done()
+		log.Error("webhook не доставлен", logger.KeyError, err)
+	}
+	deliveries.Inc(entry.Result)
+	d.record(entry)
+}
+
+// send отправляет уведомление. Ответ 2xx - доставлено.
+func (d *Dispatcher) send(dl *delivery) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, dl.endpoint.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, dl.event.Type)
+	req.Header.Set(HeaderID, dl.event.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if dl.endpoint.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(dl.endpoint.Secret, timestamp, dl.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("получатель ответил %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// retryable сообщает, есть ли смысл повторять попытку: ошибки сети, 5xx,
+// 408 и 429 временные, остальные ответы 4xx - нет.
+func retryable(status int) bool {
+	return status == 0 || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// backoff - интервал перед повтором: WebhookRetryInterval, удваиваемый с каждой попыткой.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	interval := d.cfg.WebhookRetryInterval
+	for i := 1; i < attempt && interval < maxRetryInterval; i++ {
+		interval *= 2
+	}
+	return min(interval, maxRetryInterval)
+}
+
+// done отмечает уведомление доставленным или окончательно недоставленным.
+// Вызывающий должен удерживать d.mutex.
+func (d *Dispatcher) done() {
+	d.pending--
+	webhookPending.Set(float64(d.pending))
+}
+
+// record добавляет попытку в журнал, вытесняя самые старые записи.
+// Вызывающий должен удерживать d.mutex.
+func (d *Dispatcher) record(entry Delivery) {
+	if d.cfg.WebhookLogSize <= 0 {
+		return
+	}
+	if len(d.log) < d.cfg.WebhookLogSize {
+		d.log = append(d.log, entry)
+		return
+	}
+	d.log[d.logNext] = entry
+	d.logNext = (d.logNext + 1) % d.cfg.WebhookLogSize
+}
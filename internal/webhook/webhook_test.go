@@ -0,0 +1,225 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+)
+
+// receiver - получатель уведомлений, отвечающий статусами из statuses по
+// порядку (после них - 200).
+type receiver struct {
+	t        *testing.T
+	secret   string
+	mutex    sync.Mutex
+	statuses []int
+	events   []Event
+}
+
+func (rv *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if rv.secret != "" && !Verify(rv.secret, timestamp, body, r.Header.Get(HeaderSignature)) {
+		rv.t.Errorf("неверная подпись %q", r.Header.Get(HeaderSignature))
+	}
+
+	rv.mutex.Lock()
+	defer rv.mutex.Unlock()
+	if len(rv.statuses) > 0 {
+		status := rv.statuses[0]
+		rv.statuses = rv.statuses[1:]
+		w.WriteHeader(status)
+		return
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		rv.t.Errorf("некорректное тело уведомления: %v", err)
+	}
+	if r.Header.Get(HeaderEvent) != event.Type || r.Header.Get(HeaderID) != event.ID {
+		rv.t.Errorf("заголовки не соответствуют событию: %v", r.Header)
+	}
+	rv.events = append(rv.events, event)
+}
+
+func (rv *receiver) received() []Event {
+	rv.mutex.Lock()
+	defer rv.mutex.Unlock()
+	return append([]Event(nil), rv.events...)
+}
+
+func setupConfig(webhooks ...config.WebhookConfig) *config.Config {
+	return &config.Config{
+		Webhooks:             webhooks,
+		WebhookQueueSize:     10,
+		WebhookMaxAttempts:   3,
+		WebhookRetryInterval: 10 * time.Millisecond,
+		WebhookTimeout:       time.Second,
+		WebhookLogSize:       10,
+	}
+}
+
+func start(t *testing.T, cfg *config.Config) *Dispatcher {
+	d, err := NewDispatcher(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Start()
+	return d
+}
+
+func shutdown(t *testing.T, d *Dispatcher) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.Shutdown(ctx); err != nil {
+		t.Fatalf("не все уведомления доставлены: %v", err)
+	}
+}
+
+func results(d *Dispatcher) []string {
+	var result []string
+	for _, entry := range d.Deliveries() {
+		result = append(result, entry.Result)
+	}
+	return result
+}
+
+func TestDeliver(t *testing.T) {
+	rv := &receiver{t: t, secret: "s3cret"}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	d := start(t, setupConfig(config.WebhookConfig{URL: server.URL, Secret: "s3cret"}))
+	event := Event{
+		Type:     EventFileFlushed,
+		FileID:   "acme/file1",
+		Messages: 2,
+		Range:    Range{FirstSeq: 1, LastSeq: 2, ByteStart: 0, ByteEnd: 12},
+	}
+	d.Notify(event)
+	shutdown(t, d)
+
+	events := rv.received()
+	if len(events) != 1 {
+		t.Fatalf("ожидалось одно уведомление, получено %d", len(events))
+	}
+	got := events[0]
+	if got.ID == "" || got.Time.IsZero() {
+		t.Errorf("у события должны быть ID и время: %+v", got)
+	}
+	got.ID, got.Time = "", time.Time{}
+	if !reflect.DeepEqual(got, event) {
+		t.Errorf("ожидалось %+v, получено %+v", event, got)
+	}
+	if r := results(d); !reflect.DeepEqual(r, []string{"delivered"}) {
+		t.Errorf("неверный журнал доставки: %v", r)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		results  []string
+		received int
+	}{
+		{"временные ошибки", []int{503, 429}, []string{"retry", "retry", "delivered"}, 1},
+		{"попытки исчерпаны", []int{500, 500, 500}, []string{"retry", "retry", "failed"}, 0},
+		{"ошибка получателя не повторяется", []int{400}, []string{"failed"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rv := &receiver{t: t, statuses: tt.statuses}
+			server := httptest.NewServer(rv)
+			defer server.Close()
+
+			d := start(t, setupConfig(config.WebhookConfig{URL: server.URL}))
+			d.Notify(Event{Type: EventBatchDeadLettered, FileID: "file1", Error: "disk full"})
+			shutdown(t, d)
+
+			if r := results(d); !reflect.DeepEqual(r, tt.results) {
+				t.Errorf("ожидался журнал %v, получено %v", tt.results, r)
+			}
+			if n := len(rv.received()); n != tt.received {
+				t.Errorf("ожидалось уведомлений: %d, получено %d", tt.received, n)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	rv := &receiver{t: t}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	d := start(t, setupConfig(config.WebhookConfig{URL: server.URL, Events: []string{EventCircuitOpened}, FileID: "acme/*"}))
+	d.Notify(Event{Type: EventFileFlushed, FileID: "acme/file1"})
+	d.Notify(Event{Type: EventCircuitOpened, FileID: "file1"})
+	d.Notify(Event{Type: EventCircuitOpened, FileID: "acme/file1"})
+	shutdown(t, d)
+
+	events := rv.received()
+	if len(events) != 1 || events[0].Type != EventCircuitOpened || events[0].FileID != "acme/file1" {
+		t.Errorf("ожидалось только circuit.opened для acme/file1, получено %+v", events)
+	}
+}
+
+func TestDeliveryLogKeepsLatest(t *testing.T) {
+	rv := &receiver{t: t}
+	server := httptest.NewServer(rv)
+	defer server.Close()
+
+	cfg := setupConfig(config.WebhookConfig{URL: server.URL})
+	cfg.WebhookLogSize = 3
+	d := start(t, cfg)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		id := strconv.Itoa(i)
+		ids = append(ids, id)
+		d.Notify(Event{ID: id, Type: EventFileFlushed, FileID: "file1"})
+		// по одному, чтобы порядок попыток совпадал с порядком событий
+		for entries := d.Deliveries(); len(entries) == 0 || entries[len(entries)-1].EventID != id; entries = d.Deliveries() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	shutdown(t, d)
+
+	var logged []string
+	for _, entry := range d.Deliveries() {
+		logged = append(logged, entry.EventID)
+	}
+	if !reflect.DeepEqual(logged, ids[2:]) {
+		t.Errorf("ожидались последние попытки %v, получено %v", ids[2:], logged)
+	}
+}
+
+func TestNewDispatcherRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook config.WebhookConfig
+	}{
+		{"без URL", config.WebhookConfig{}},
+		{"неизвестное событие", config.WebhookConfig{URL: "http://localhost", Events: []string{"file.deleted"}}},
+		{"некорректный шаблон", config.WebhookConfig{URL: "http://localhost", FileID: "["}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDispatcher(setupConfig(tt.webhook)); err == nil {
+				t.Error("ожидалась ошибка конфигурации")
+			}
+		})
+	}
+
+	if d, err := NewDispatcher(setupConfig()); d != nil || err != nil {
+		t.Errorf("без получателей ожидался nil, получено %v (%v)", d, err)
+	}
+}
@@ -0,0 +1,299 @@
+// Package ws - прием сообщений через WebSocket для продюсеров, которые пишут
+// непрерывным потоком. Клиент авторизуется один раз при подключении (заголовок
+// Authorization: Bearer <token> или параметр token), затем отправляет сообщения
+// JSON-кадрами и получает на каждое подтверждение (ack) или отказ (nack):
+//
+//	-> {"id": "1", "file_id": "file1", "data": "Hello"}
+//	<- {"type": "ack", "id": "1", "msg_id": "..."}
+//	<- {"type": "nack", "id": "1", "code": "rate_limited", "error": "...", "retry_after_ms": 500}
+//
+// file_id можно не указывать, тогда используется файл пользователя. Когда общая
+// очередь приложения заполняется, сервер присылает {"type": "pause"} и до
+// {"type": "resume"} отклоняет сообщения с кодом unavailable.
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/logger"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/metrics"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+const (
+	flowCheckInterval = 100 * time.Millisecond
+	writeTimeout      = 10 * time.Second
+)
+
+var connections = metrics.Default.NewGaugeVec(
+	"app_websocket_connections", "Количество открытых соединений WebSocket")
+
+var ErrPaused = errors.New("прием приостановлен, дождитесь resume")
+
+type request struct {
+	ID     string `json:"id"`
+	FileID string `json:"file_id"`
+	Data   string `json:"data"`
+}
+
+type response struct {
+	Type         string `json:"type"`
+	ID           string `json:"id,omitempty"`
+	MsgID        string `json:"msg_id,omitempty"`
+	FileID       string `json:"file_id,omitempty"`
+	Code         string `json:"code,omitempty"`
+	Error        string `json:"error,omitempty"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+	QuotaWarning bool   `json:"quota_warning,omitempty"`
+}
+
+// Handler принимает соединения WebSocket и отслеживает открытые, чтобы
+// закрыть их при остановке сервера (http.Server.Shutdown их не ждет).
+type Handler struct {
+	svc *ingest.Service
+	cfg *config.Config
+
+	mutex   sync.Mutex
+	conns   map[*websocket.Conn]struct{}
+	closing bool
+}
+
+func NewHandler(svc *ingest.Service, cfg *config.Config) *Handler {
+	return &Handler{
+		svc:   svc,
+		cfg:   cfg,
+		conns: make(map[*websocket.Conn]struct{}),
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = r.URL.Query().Get("token")
+	}
+	user, err := h.svc.Authenticate(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		// Accept уже ответил клиенту
+		logger.FromContext(r.Context()).Warn("не удалось установить соединение WebSocket", logger.KeyError, err)
+		return
+	}
+	if !h.track(conn) {
+		conn.Close(websocket.StatusGoingAway, "сервер останавливается")
+		return
+	}
+	defer h.untrack(conn)
+
+	if h.cfg.WSMaxMessageBytes > 0 {
+		conn.SetReadLimit(h.cfg.WSMaxMessageBytes)
+	}
+
+	s := &session{
+		conn:  conn,
+		svc:   h.svc,
+		cfg:   h.cfg,
+		user:  user,
+		token: token,
+		log:   logger.FromContext(r.Context()).With(logger.KeyFileID, types.FileKey(user.Tenant, user.FileID)),
+	}
+	s.run(r.Context())
+}
+
+// Shutdown закрывает все соединения и перестает принимать новые.
+// Подходит для http.Server.RegisterOnShutdown.
+func (h *Handler) Shutdown() {
+	h.mutex.Lock()
+	h.closing = true
+	conns := make([]*websocket.Conn, 0, len(h.conns))
+	for conn := range h.conns {
+		conns = append(conns, conn)
+	}
+	h.mutex.Unlock()
+
+	for _, conn := range conns {
+		go conn.Close(websocket.StatusGoingAway, "сервер останавливается")
+	}
+}
+
+func (h *Handler) track(conn *websocket.Conn) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.closing {
+		return false
+	}
+	h.conns[conn] = struct{}{}
+	connections.Add(1)
+	return true
+}
+
+func (h *Handler) untrack(conn *websocket.Conn) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.conns, conn)
+	connections.Add(-1)
+}
+
+// session - одно соединение продюсера.
+type session struct {
+	conn   *websocket.Conn
+	svc    *ingest.Service
+	cfg    *config.Config
+	user   types.User
+	token  string
+	paused atomic.Bool
+	log    *slog.Logger
+}
+
+func (s *session) run(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer s.conn.CloseNow()
+
+	s.log.Info("соединение WebSocket установлено")
+	if err := s.write(ctx, response{Type: "ready", FileID: s.user.FileID}); err != nil {
+		return
+	}
+
+	go s.heartbeat(ctx)
+	go s.flowControl(ctx)
+
+	for {
+		_, data, err := s.conn.Read(ctx)
+		if err != nil {
+			switch websocket.CloseStatus(err) {
+			case websocket.StatusNormalClosure, websocket.StatusGoingAway:
+				s.log.Info("соединение WebSocket закрыто")
+			default:
+				s.log.Warn("соединение WebSocket прервано", logger.KeyError, err)
+			}
+			return
+		}
+
+		if err := s.write(ctx, s.handle(ctx, data)); err != nil {
+			s.log.Warn("не удалось отправить ответ", logger.KeyError, err)
+			return
+		}
+	}
+}
+
+// handle принимает одно сообщение клиента и возвращает ack или nack.
+func (s *session) handle(ctx context.Context, data []byte) response {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return response{Type: "nack", Code: ingest.CodeInvalidArgument.String(), Error: "некорректное сообщение: " + err.Error()}
+	}
+	if s.paused.Load() {
+		return response{Type: "nack", ID: req.ID, Code: ingest.CodeUnavailable.String(), Error: ErrPaused.Error()}
+	}
+
+	if req.FileID == "" {
+		req.FileID = s.user.FileID
+	}
+	msg, err := s.svc.SendMessage(ctx, s.token, req.FileID, req.Data)
+	if err != nil {
+		resp := response{Type: "nack", ID: req.ID, Code: ingest.CodeOf(err).String(), Error: err.Error()}
+		var rateErr *handler.RateLimitError
+		if errors.As(err, &rateErr) {
+			resp.RetryAfterMs = rateErr.RetryAfter.Milliseconds()
+		}
+		return resp
+	}
+
+	return response{Type: "ack", ID: req.ID, MsgID: msg.ID, QuotaWarning: s.svc.QuotaWarning(msg)}
+}
+
+// heartbeat проверяет, что клиент жив: если pong не пришел за WSPongTimeout,
+// соединение закрывается и цикл чтения завершается.
+func (s *session) heartbeat(ctx context.Context) {
+	if s.cfg.WSPingInterval <= 0 {
+		return
+	}
+	timeout := s.cfg.WSPongTimeout
+	if timeout <= 0 {
+		timeout = s.cfg.WSPingInterval
+	}
+
+	ticker := time.NewTicker(s.cfg.WSPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := s.conn.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log.Warn("нет ответа на ping, соединение закрывается", logger.KeyError, err)
+				s.conn.CloseNow()
+			}
+			return
+		}
+	}
+}
+
+// flowControl сообщает клиенту о приостановке приема, когда общая очередь
+// заполнена на WSPauseThreshold, и о возобновлении, когда она освободилась
+// до WSResumeThreshold.
+func (s *session) flowControl(ctx context.Context) {
+	pause := s.cfg.WSPauseThreshold
+	if pause <= 0 {
+		return
+	}
+	resume := min(s.cfg.WSResumeThreshold, pause)
+
+	ticker := time.NewTicker(flowCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		load := s.svc.QueueLoad()
+		switch {
+		case !s.paused.Load() && load >= pause:
+			s.paused.Store(true)
+			s.log.Info("прием через WebSocket приостановлен", "queue_load", load)
+			s.write(ctx, response{Type: "pause"})
+		case s.paused.Load() && load < resume:
+			s.paused.Store(false)
+			s.log.Info("прием через WebSocket возобновлен", "queue_load", load)
+			s.write(ctx, response{Type: "resume"})
+		}
+	}
+}
+
+// write отправляет ответ клиенту. Conn допускает одновременную запись
+// из цикла чтения, heartbeat и flowControl.
+func (s *session) write(ctx context.Context, resp response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+	return s.conn.Write(ctx, websocket.MessageText, data)
+}
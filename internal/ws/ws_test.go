@@ -0,0 +1,232 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+
+	"github.com/asb1302/innopolis_go_assesment_1/internal/app"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/config"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/handler"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/ingest"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/repository"
+	"github.com/asb1302/innopolis_go_assesment_1/internal/types"
+)
+
+func setupConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		ValidTokens:    []string{"valid_token_1", "valid_token_2"},
+		WorkerInterval: 100 * time.Millisecond,
+		FilesDir:       t.TempDir(),
+		NumWorkers:     1,
+		MaxRetries:     3,
+		RetryInterval:  100 * time.Millisecond,
+	}
+}
+
+// setup поднимает HTTP-сервер с обработчиком /ws и добавляет пользователя
+// valid_token_1 с файлом file1. Приложение не запускается, это делает start.
+func setup(t *testing.T, cfg *config.Config) (*Handler, string, func()) {
+	userRepo := repository.NewUserRepository(cfg.ValidTokens)
+	application := app.NewApp(cfg, &types.DefaultFileWriter{}, userRepo)
+	msgHandler := handler.NewMessageHandler(userRepo, application, cfg)
+	svc := ingest.NewService(application, msgHandler, userRepo)
+	if _, err := svc.AddUser(context.Background(), ingest.NewUser{Token: "valid_token_1", FileID: "file1"}); err != nil {
+		t.Fatalf("не удалось добавить пользователя: %v", err)
+	}
+
+	h := NewHandler(svc, cfg)
+	server := httptest.NewServer(h)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	started := false
+	start := func() {
+		started = true
+		go func() {
+			application.Start(ctx)
+			close(done)
+		}()
+	}
+	t.Cleanup(func() {
+		h.Shutdown()
+		server.Close()
+		cancel()
+		if started {
+			<-done
+		}
+	})
+
+	return h, "ws" + strings.TrimPrefix(server.URL, "http"), start
+}
+
+func dial(t *testing.T, url, token string) *websocket.Conn {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, _, err := websocket.Dial(context.Background(), url, &websocket.DialOptions{HTTPHeader: header})
+	if err != nil {
+		t.Fatalf("не удалось подключиться: %v", err)
+	}
+	t.Cleanup(func() { conn.CloseNow() })
+
+	if resp := read(t, conn); resp.Type != "ready" || resp.FileID != "file1" {
+		t.Fatalf("ожидалось приветствие ready, получено %+v", resp)
+	}
+	return conn
+}
+
+func read(t *testing.T, conn *websocket.Conn) response {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, data, err := conn.Read(ctx)
+	if err != nil {
+		t.Fatalf("не удалось прочитать ответ: %v", err)
+	}
+	var resp response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("некорректный ответ %s: %v", data, err)
+	}
+	return resp
+}
+
+func send(t *testing.T, conn *websocket.Conn, req string) response {
+	if err := conn.Write(context.Background(), websocket.MessageText, []byte(req)); err != nil {
+		t.Fatalf("не удалось отправить сообщение: %v", err)
+	}
+	return read(t, conn)
+}
+
+func TestRejectsUnknownToken(t *testing.T) {
+	_, url, _ := setup(t, setupConfig(t))
+
+	for _, token := range []string{"", "invalid_token", "valid_token_2"} {
+		_, resp, err := websocket.Dial(context.Background(), url+"?token="+token, nil)
+		if err == nil {
+			t.Fatalf("токен %q: ожидался отказ в подключении", token)
+		}
+		if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("токен %q: ожидался статус 401, получено %v", token, resp)
+		}
+	}
+}
+
+func TestAcksAndNacks(t *testing.T) {
+	_, url, start := setup(t, setupConfig(t))
+	start()
+	conn := dial(t, url, "valid_token_1")
+
+	tests := []struct {
+		name string
+		req  string
+		typ  string
+		code string
+	}{
+		{"сообщение", `{"id":"1","file_id":"file1","data":"Hello"}`, "ack", ""},
+		{"файл пользователя по умолчанию", `{"id":"2","data":"World"}`, "ack", ""},
+		{"чужой файл", `{"id":"3","file_id":"file2","data":"x"}`, "nack", "invalid_argument"},
+		{"пустые данные", `{"id":"4","file_id":"file1"}`, "nack", "invalid_argument"},
+		{"некорректный JSON", `{"id":`, "nack", "invalid_argument"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := send(t, conn, tt.req)
+			if resp.Type != tt.typ || resp.Code != tt.code {
+				t.Fatalf("ожидался %s %q, получено %+v", tt.typ, tt.code, resp)
+			}
+			if resp.Type == "ack" && resp.MsgID == "" {
+				t.Error("ожидался идентификатор принятого сообщения")
+			}
+		})
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	cfg := setupConfig(t)
+	// очередь на 1000 сообщений: пауза с третьего сообщения, возобновление на пустой
+	cfg.WSPauseThreshold = 0.003
+	cfg.WSResumeThreshold = 0.001
+	_, url, start := setup(t, cfg)
+	conn := dial(t, url, "valid_token_1")
+
+	// приложение не запущено, поэтому очередь не разбирается. pause может
+	// прийти раньше ack третьего сообщения
+	for range 3 {
+		if err := conn.Write(context.Background(), websocket.MessageText, []byte(`{"data":"x"}`)); err != nil {
+			t.Fatalf("не удалось отправить сообщение: %v", err)
+		}
+	}
+	frames := make(map[string]int)
+	for range 4 {
+		frames[read(t, conn).Type]++
+	}
+	if frames["ack"] != 3 || frames["pause"] != 1 {
+		t.Fatalf("ожидались 3 ack и pause, получено %v", frames)
+	}
+	if resp := send(t, conn, `{"id":"paused","data":"x"}`); resp.Type != "nack" || resp.Code != "unavailable" || resp.ID != "paused" {
+		t.Fatalf("во время паузы ожидался nack unavailable, получено %+v", resp)
+	}
+
+	start()
+	if resp := read(t, conn); resp.Type != "resume" {
+		t.Fatalf("ожидалось resume, получено %+v", resp)
+	}
+	if resp := send(t, conn, `{"data":"x"}`); resp.Type != "ack" {
+		t.Fatalf("после resume ожидался ack, получено %+v", resp)
+	}
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	cfg := setupConfig(t)
+	cfg.WSPingInterval = 50 * time.Millisecond
+	cfg.WSPongTimeout = 50 * time.Millisecond
+	h, url, _ := setup(t, cfg)
+
+	// клиент не читает из соединения и поэтому не отвечает на ping
+	conn, _, err := websocket.Dial(context.Background(), url+"?token=valid_token_1", nil)
+	if err != nil {
+		t.Fatalf("не удалось подключиться: %v", err)
+	}
+	defer conn.CloseNow()
+
+	waitOpen(t, h, 1)
+	waitOpen(t, h, 0)
+}
+
+func TestShutdownClosesConnections(t *testing.T) {
+	h, url, _ := setup(t, setupConfig(t))
+	conn := dial(t, url, "valid_token_1")
+
+	h.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _, err := conn.Read(ctx)
+	if status := websocket.CloseStatus(err); status != websocket.StatusGoingAway {
+		t.Errorf("ожидалось закрытие со статусом GoingAway, получено %v", err)
+	}
+}
+
+// waitOpen ждет, пока число открытых соединений станет равным n.
+func waitOpen(t *testing.T, h *Handler, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		h.mutex.Lock()
+		open := len(h.conns)
+		h.mutex.Unlock()
+		if open == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("ожидалось открытых соединений: %d, открыто: %d", n, open)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}